@@ -1,5 +1,7 @@
 package app
 
+import "time"
+
 type Error struct {
 	Code    int
 	Message string
@@ -9,6 +11,38 @@ func (e Error) Error() string {
 	return e.Message
 }
 
+// Locked returns LockedError carrying the time left on the lock, errors.Cause of it is LockedError.
+func Locked(retryAfter time.Duration) error {
+	return lockError{retryAfter: retryAfter}
+}
+
+// RetryAfter returns the time left on the lock of an error made by Locked, looking through wrapped errors.
+func RetryAfter(err error) (time.Duration, bool) {
+	for nil != err {
+		if lErr, ok := err.(lockError); ok {
+			return lErr.retryAfter, true
+		}
+		cause, ok := err.(interface{ Cause() error })
+		if !ok {
+			return 0, false
+		}
+		err = cause.Cause()
+	}
+	return 0, false
+}
+
+type lockError struct {
+	retryAfter time.Duration
+}
+
+func (e lockError) Error() string {
+	return LockedError.Message
+}
+
+func (e lockError) Cause() error {
+	return LockedError
+}
+
 type errorCode int
 
 const (
@@ -19,6 +53,13 @@ const (
 	NotFoundCode
 	InvalidCode
 	BadRequestCode
+	QuotaExceededCode
+	IdempotencyMismatchCode
+	IdempotencyConflictCode
+	TooManyAttemptsCode
+	InUseCode
+	LockedCode
+	WeakPasswordCode
 )
 
 func (e errorCode) Int() int {
@@ -27,7 +68,10 @@ func (e errorCode) Int() int {
 
 func (e errorCode) String() string {
 	return [...]string{"Internal Server Error", "Data already exists",
-		"Unauthenticated", "Unauthorized", "Data Not Found", "Invalid data", "Bad Request"}[e-1]
+		"Unauthenticated", "Unauthorized", "Data Not Found", "Invalid data", "Bad Request", "Quota Exceeded",
+		"Idempotency key was used with a different request", "Request with the same idempotency key is in progress",
+		"Too many attempts, try again later", "Data is still in use",
+		"Too many failed attempts, the account is temporarily locked", "Password is too weak"}[e-1]
 }
 
 var (
@@ -59,4 +103,32 @@ var (
 		Code:    BadRequestCode.Int(),
 		Message: BadRequestCode.String(),
 	}
+	QuotaExceededError = Error{
+		Code:    QuotaExceededCode.Int(),
+		Message: QuotaExceededCode.String(),
+	}
+	IdempotencyMismatchError = Error{
+		Code:    IdempotencyMismatchCode.Int(),
+		Message: IdempotencyMismatchCode.String(),
+	}
+	IdempotencyConflictError = Error{
+		Code:    IdempotencyConflictCode.Int(),
+		Message: IdempotencyConflictCode.String(),
+	}
+	TooManyAttemptsError = Error{
+		Code:    TooManyAttemptsCode.Int(),
+		Message: TooManyAttemptsCode.String(),
+	}
+	InUseError = Error{
+		Code:    InUseCode.Int(),
+		Message: InUseCode.String(),
+	}
+	LockedError = Error{
+		Code:    LockedCode.Int(),
+		Message: LockedCode.String(),
+	}
+	WeakPasswordError = Error{
+		Code:    WeakPasswordCode.Int(),
+		Message: WeakPasswordCode.String(),
+	}
 )
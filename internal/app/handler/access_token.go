@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"github.com/labstack/echo/v4"
+	"refactory/notes/internal/app"
+	"refactory/notes/internal/app/model"
+	"refactory/notes/internal/app/service"
+	"refactory/notes/internal/security/token"
+	"refactory/notes/internal/web"
+	"strconv"
+)
+
+type AccessTokenHandler interface {
+	CreateAccessToken(c echo.Context) error
+	ListAccessToken(c echo.Context) error
+	RevokeAccessToken(c echo.Context) error
+}
+
+type accessTokenHandler struct {
+	s service.AccessTokenService
+}
+
+func NewAccessTokenHandler(s service.AccessTokenService) *accessTokenHandler {
+	return &accessTokenHandler{s: s}
+}
+
+// @Router /me/tokens [post]
+// @Tags me
+// @Summary Create Personal Access Token
+// @Description The token is only returned once, send it as a Bearer token. Scopes are notes:read, notes:write, media:write, webhooks:read and webhooks:write
+// @Accept json
+// @Produce json
+// @Param payload body model.AccessTokenRequest true "body request"
+// @Success 200 {object} model.AccessTokenResponse
+func (a *accessTokenHandler) CreateAccessToken(c echo.Context) error {
+	var req model.AccessTokenRequest
+	if err := c.Bind(&req); nil != err {
+		return echo.ErrBadRequest
+	}
+	if err := c.Validate(&req); nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	session, ok := c.Get("session").(*token.Token)
+	if !ok {
+		return web.ResponseError(c, app.InternalError)
+	}
+
+	response, err := a.s.CreateAccessToken(c.Request().Context(), session.UserId, req)
+	if nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, response)
+}
+
+// @Router /me/tokens [get]
+// @Tags me
+// @Summary List Personal Access Token
+// @Description TODO
+// @Accept json
+// @Produce json
+// @Success 200 {array} model.AccessTokenResponse
+func (a *accessTokenHandler) ListAccessToken(c echo.Context) error {
+	session, ok := c.Get("session").(*token.Token)
+	if !ok {
+		return web.ResponseError(c, app.InternalError)
+	}
+
+	response, err := a.s.ListAccessToken(c.Request().Context(), session.UserId)
+	if nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, response)
+}
+
+// @Router /me/tokens/{id} [delete]
+// @Tags me
+// @Summary Revoke Personal Access Token
+// @Description TODO
+// @Accept json
+// @Produce json
+// @Param id path int true "token id"
+// @Success 200 {string} result
+func (a *accessTokenHandler) RevokeAccessToken(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if nil != err {
+		return echo.ErrBadRequest
+	}
+
+	session, ok := c.Get("session").(*token.Token)
+	if !ok {
+		return web.ResponseError(c, app.InternalError)
+	}
+
+	if err := a.s.RevokeAccessToken(c.Request().Context(), session.UserId, id); nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, "Token has revoked")
+}
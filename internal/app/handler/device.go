@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"github.com/labstack/echo/v4"
+	"refactory/notes/internal/app"
+	"refactory/notes/internal/app/model"
+	"refactory/notes/internal/security/token"
+	"refactory/notes/internal/web"
+)
+
+// @Router /me/sessions [get]
+// @Tags me
+// @Summary List Sessions
+// @Description Every device signed in to the account, last seen is updated when the device refreshes its token
+// @Accept json
+// @Produce json
+// @Success 200 {array} model.DeviceResponse
+func (u *userHandler) ListDevice(c echo.Context) error {
+	session, ok := c.Get("session").(*token.Token)
+	if !ok {
+		return web.ResponseError(c, app.InternalError)
+	}
+
+	response, err := u.userService.ListDevice(c.Request().Context(), *session)
+	if nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, response)
+}
+
+// @Router /me/sessions/{id} [delete]
+// @Tags me
+// @Summary Revoke Session
+// @Description Sign out the device, its access and refresh tokens stop working immediately
+// @Accept json
+// @Produce json
+// @Param id path string true "session id"
+// @Success 200 {string} result
+func (u *userHandler) RevokeDevice(c echo.Context) error {
+	session, ok := c.Get("session").(*token.Token)
+	if !ok {
+		return web.ResponseError(c, app.InternalError)
+	}
+
+	if err := u.userService.RevokeDevice(c.Request().Context(), *session, c.Param("id")); nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, "Session revoked")
+}
+
+// @Router /me/sessions [delete]
+// @Tags me
+// @Summary Revoke Other Sessions
+// @Description Sign out every device except the current one
+// @Accept json
+// @Produce json
+// @Success 200 {string} result
+func (u *userHandler) RevokeOtherDevices(c echo.Context) error {
+	session, ok := c.Get("session").(*token.Token)
+	if !ok {
+		return web.ResponseError(c, app.InternalError)
+	}
+
+	if err := u.userService.RevokeOtherDevices(c.Request().Context(), *session); nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, "Sessions revoked")
+}
+
+func client(c echo.Context) model.Client {
+	return model.Client{Ip: c.RealIP(), UserAgent: c.Request().UserAgent()}
+}
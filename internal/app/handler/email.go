@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"github.com/labstack/echo/v4"
+	"refactory/notes/internal/app"
+	"refactory/notes/internal/app/model"
+	"refactory/notes/internal/security/token"
+	"refactory/notes/internal/web"
+)
+
+// @Router /me/email/verify [post]
+// @Tags me
+// @Summary Confirm Email Change
+// @Description Switch to the pending email address with the code mailed to it
+// @Accept json
+// @Produce json
+// @Param payload body model.VerifyRequest true "body request"
+// @Success 200 {object} model.UserResponse
+func (u *userHandler) VerifyEmailChange(c echo.Context) error {
+	var req model.VerifyRequest
+	if err := c.Bind(&req); nil != err {
+		return echo.ErrBadRequest
+	}
+	if err := c.Validate(req); nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	session, ok := c.Get("session").(*token.Token)
+	if !ok {
+		return web.ResponseError(c, app.InternalError)
+	}
+
+	response, err := u.userService.VerifyEmailChange(c.Request().Context(), *session, req.Code)
+	if nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, response)
+}
+
+// @Router /me/email [delete]
+// @Tags me
+// @Summary Cancel Email Change
+// @Description Drop the pending email address, the current one stays in use
+// @Accept json
+// @Produce json
+// @Success 200 {string} result
+func (u *userHandler) CancelEmailChange(c echo.Context) error {
+	session, ok := c.Get("session").(*token.Token)
+	if !ok {
+		return web.ResponseError(c, app.InternalError)
+	}
+
+	if err := u.userService.CancelEmailChange(c.Request().Context(), *session); nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, "Email change cancelled")
+}
@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"github.com/labstack/echo/v4"
+	"refactory/notes/internal/app"
+	"refactory/notes/internal/app/model"
+	"refactory/notes/internal/app/service"
+	"refactory/notes/internal/security/token"
+	"refactory/notes/internal/web"
+	"strconv"
+)
+
+type ImpersonationHandler interface {
+	Impersonate(c echo.Context) error
+	ListImpersonation(c echo.Context) error
+	EndImpersonation(c echo.Context) error
+	ListMyImpersonation(c echo.Context) error
+	EndCurrentImpersonation(c echo.Context) error
+}
+
+type impersonationHandler struct {
+	s service.ImpersonationService
+}
+
+func NewImpersonationHandler(s service.ImpersonationService) *impersonationHandler {
+	return &impersonationHandler{s: s}
+}
+
+// @Router /admin/users/{id}/impersonate [post]
+// @Tags admin
+// @Summary Impersonate User
+// @Description Short lived token acting as the user for support, every request made with it is recorded and visible to the user
+// @Accept json
+// @Produce json
+// @Param id path int true "user id"
+// @Param payload body model.ImpersonateRequest true "body request"
+// @Success 200 {object} model.ImpersonateResponse
+func (i *impersonationHandler) Impersonate(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if nil != err {
+		return web.ResponseError(c, app.BadRequestError)
+	}
+
+	var req model.ImpersonateRequest
+	if err := c.Bind(&req); nil != err {
+		return echo.ErrBadRequest
+	}
+	if err := c.Validate(&req); nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	session, ok := c.Get("session").(*token.Token)
+	if !ok {
+		return web.ResponseError(c, app.InternalError)
+	}
+
+	response, err := i.s.Impersonate(c.Request().Context(), *session, id, req)
+	if nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, response)
+}
+
+// @Router /admin/impersonations [get]
+// @Tags admin
+// @Summary List Impersonation
+// @Description Latest impersonations with the requests made during them
+// @Accept json
+// @Produce json
+// @Success 200 {array} model.ImpersonationResponse
+func (i *impersonationHandler) ListImpersonation(c echo.Context) error {
+	response, err := i.s.ListImpersonation(c.Request().Context(), 0)
+	if nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, response)
+}
+
+// @Router /admin/impersonations/{id} [delete]
+// @Tags admin
+// @Summary End Impersonation
+// @Description The impersonation token stops working immediately
+// @Accept json
+// @Produce json
+// @Param id path int true "impersonation id"
+// @Success 200 {string} result
+func (i *impersonationHandler) EndImpersonation(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if nil != err {
+		return web.ResponseError(c, app.BadRequestError)
+	}
+
+	if err := i.s.EndImpersonation(c.Request().Context(), id); nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, "Impersonation ended")
+}
+
+// @Router /me/impersonations [get]
+// @Tags me
+// @Summary List My Impersonation
+// @Description Impersonations of the user by admins with the requests made during them
+// @Accept json
+// @Produce json
+// @Success 200 {array} model.ImpersonationResponse
+func (i *impersonationHandler) ListMyImpersonation(c echo.Context) error {
+	session, ok := c.Get("session").(*token.Token)
+	if !ok {
+		return web.ResponseError(c, app.InternalError)
+	}
+
+	response, err := i.s.ListImpersonation(c.Request().Context(), session.UserId)
+	if nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, response)
+}
+
+// @Router /me/impersonation [delete]
+// @Tags me
+// @Summary End Current Impersonation
+// @Description Ends the impersonation the token of the request belongs to
+// @Accept json
+// @Produce json
+// @Success 200 {string} result
+func (i *impersonationHandler) EndCurrentImpersonation(c echo.Context) error {
+	session, ok := c.Get("session").(*token.Token)
+	if !ok {
+		return web.ResponseError(c, app.InternalError)
+	}
+
+	if err := i.s.EndCurrentImpersonation(c.Request().Context(), *session); nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, "Impersonation ended")
+}
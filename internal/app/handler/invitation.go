@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"github.com/labstack/echo/v4"
+	"refactory/notes/internal/app"
+	"refactory/notes/internal/app/model"
+	"refactory/notes/internal/app/service"
+	"refactory/notes/internal/security/token"
+	"refactory/notes/internal/web"
+	"strconv"
+)
+
+type InvitationHandler interface {
+	CreateInvitation(c echo.Context) error
+	ListInvitation(c echo.Context) error
+	ResendInvitation(c echo.Context) error
+	RevokeInvitation(c echo.Context) error
+}
+
+type invitationHandler struct {
+	s service.InvitationService
+}
+
+func NewInvitationHandler(s service.InvitationService) *invitationHandler {
+	return &invitationHandler{s: s}
+}
+
+// @Router /admin/invitations [post]
+// @Tags admin
+// @Summary Create Invitation
+// @Description Mail a signup link, registering with it gives the user the role of the invitation
+// @Accept json
+// @Produce json
+// @Param payload body model.InvitationRequest true "body request"
+// @Success 200 {object} model.InvitationResponse
+func (i *invitationHandler) CreateInvitation(c echo.Context) error {
+	var req model.InvitationRequest
+	if err := c.Bind(&req); nil != err {
+		return echo.ErrBadRequest
+	}
+	if err := c.Validate(&req); nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	session, ok := c.Get("session").(*token.Token)
+	if !ok {
+		return web.ResponseError(c, app.InternalError)
+	}
+
+	response, err := i.s.CreateInvitation(c.Request().Context(), *session, req)
+	if nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, response)
+}
+
+// @Router /admin/invitations [get]
+// @Tags admin
+// @Summary List Invitation
+// @Description TODO
+// @Accept json
+// @Produce json
+// @Success 200 {array} model.InvitationResponse
+func (i *invitationHandler) ListInvitation(c echo.Context) error {
+	response, err := i.s.ListInvitation(c.Request().Context())
+	if nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, response)
+}
+
+// @Router /admin/invitations/{id}/resend [post]
+// @Tags admin
+// @Summary Resend Invitation
+// @Description Mail a new signup link, the previous link stops working
+// @Accept json
+// @Produce json
+// @Param id path int true "invitation id"
+// @Success 200 {object} model.InvitationResponse
+func (i *invitationHandler) ResendInvitation(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if nil != err {
+		return web.ResponseError(c, app.BadRequestError)
+	}
+
+	response, err := i.s.ResendInvitation(c.Request().Context(), id)
+	if nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, response)
+}
+
+// @Router /admin/invitations/{id} [delete]
+// @Tags admin
+// @Summary Revoke Invitation
+// @Description TODO
+// @Accept json
+// @Produce json
+// @Param id path int true "invitation id"
+// @Success 200 {string} result
+func (i *invitationHandler) RevokeInvitation(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if nil != err {
+		return web.ResponseError(c, app.BadRequestError)
+	}
+
+	if err := i.s.RevokeInvitation(c.Request().Context(), id); nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, "Invitation revoked")
+}
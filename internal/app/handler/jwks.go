@@ -0,0 +1,14 @@
+package handler
+
+import (
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"refactory/notes/internal/security/token"
+)
+
+// Jwks publishes the public keys tokens are signed with, served outside of /api at /.well-known/jwks.json.
+// The document is the plain JSON Web Key Set so that standard verifiers can consume it.
+func Jwks(c echo.Context) error {
+	c.Response().Header().Set("Cache-Control", "public, max-age=300")
+	return c.JSON(http.StatusOK, token.PublicKeys())
+}
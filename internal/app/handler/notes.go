@@ -5,6 +5,7 @@ import (
 	"refactory/notes/internal/app"
 	"refactory/notes/internal/app/model"
 	"refactory/notes/internal/app/service"
+	"refactory/notes/internal/config"
 	"refactory/notes/internal/security/token"
 	"refactory/notes/internal/web"
 	"strconv"
@@ -17,8 +18,13 @@ type NotesHandler interface {
 	EditNotes(c echo.Context) error
 	DeleteNotes(c echo.Context) error
 	ReActiveNotes(c echo.Context) error
+	NotesStats(c echo.Context) error
+	AdminStats(c echo.Context) error
+	Sync(c echo.Context) error
 }
 
+const maxStatsWindow = 365
+
 type notesHandler struct {
 	s service.NotesService
 }
@@ -34,6 +40,7 @@ func NewNotesHandler(s service.NotesService) *notesHandler {
 // @Accept json
 // @Produce json
 // @Param payload body model.NotesRequest true "body request"
+// @Param X-Org header int false "organization id, personal notes without it"
 // @Success 200 {object} model.NotesResponse
 func (n *notesHandler) CreateNotes(c echo.Context) error {
 	var req model.NotesRequest
@@ -50,6 +57,7 @@ func (n *notesHandler) CreateNotes(c echo.Context) error {
 	}
 
 	notes := model.NewNotes(0, session.UserId, req.Type, req.Title, req.Body, req.Secret)
+	notes.OrganizationId = organization(c)
 	response, err := n.s.CreateNotes(c.Request().Context(), notes)
 	if nil != err {
 		return web.ResponseError(c, err)
@@ -64,6 +72,7 @@ func (n *notesHandler) CreateNotes(c echo.Context) error {
 // @Description TODO
 // @Accept json
 // @Produce json
+// @Param X-Org header int false "organization id, personal notes without it"
 // @Success 200 {array} model.NotesResponse
 func (n *notesHandler) ListNotes(c echo.Context) error {
 	session, ok := c.Get("session").(*token.Token)
@@ -71,7 +80,7 @@ func (n *notesHandler) ListNotes(c echo.Context) error {
 		return web.ResponseError(c, app.InternalError)
 	}
 
-	result, err := n.s.GetNotes(c.Request().Context(), session.UserId, session.RoleId)
+	result, err := n.s.GetNotes(c.Request().Context(), session.UserId, organization(c), session.RoleId)
 	if nil != err {
 		return web.ResponseError(c, err)
 	}
@@ -86,6 +95,7 @@ func (n *notesHandler) ListNotes(c echo.Context) error {
 // @Accept json
 // @Produce json
 // @Param id path int true "id notes"
+// @Param X-Org header int false "organization id, personal notes without it"
 // @Success 200 {object} model.NotesResponse
 func (n *notesHandler) GetNotes(c echo.Context) error {
 	id, err := strconv.Atoi(c.Param("id"))
@@ -98,7 +108,7 @@ func (n *notesHandler) GetNotes(c echo.Context) error {
 		return web.ResponseError(c, app.InternalError)
 	}
 
-	result, err := n.s.DetailNotes(c.Request().Context(), session.UserId, id, session.RoleId)
+	result, err := n.s.DetailNotes(c.Request().Context(), session.UserId, organization(c), id, session.RoleId)
 	if nil != err {
 		return web.ResponseError(c, err)
 	}
@@ -113,6 +123,7 @@ func (n *notesHandler) GetNotes(c echo.Context) error {
 // @Accept json
 // @Produce json
 // @Param id path int true "id notes"
+// @Param X-Org header int false "organization id, personal notes without it"
 // @Success 200 {object} model.NotesResponse
 func (n *notesHandler) EditNotes(c echo.Context) error {
 	var req model.NotesRequest
@@ -132,7 +143,9 @@ func (n *notesHandler) EditNotes(c echo.Context) error {
 		return web.ResponseError(c, app.InternalError)
 	}
 
-	response, err := n.s.EditNotes(c.Request().Context(), model.NewNotes(id, session.UserId, req.Type, req.Title, req.Body, req.Secret))
+	notes := model.NewNotes(id, session.UserId, req.Type, req.Title, req.Body, req.Secret)
+	notes.OrganizationId = organization(c)
+	response, err := n.s.EditNotes(c.Request().Context(), notes)
 	if nil != err {
 		return web.ResponseError(c, err)
 	}
@@ -147,6 +160,7 @@ func (n *notesHandler) EditNotes(c echo.Context) error {
 // @Accept json
 // @Produce json
 // @Param id path int true "id notes"
+// @Param X-Org header int false "organization id, personal notes without it"
 // @Success 200 {string} result
 func (n *notesHandler) DeleteNotes(c echo.Context) error {
 	var req model.SecretRequest
@@ -163,7 +177,7 @@ func (n *notesHandler) DeleteNotes(c echo.Context) error {
 		web.ResponseError(c, app.InternalError)
 	}
 
-	if err := n.s.DeleteNotes(c.Request().Context(), session.UserId, id, req.Secret); nil != err {
+	if err := n.s.DeleteNotes(c.Request().Context(), session.UserId, organization(c), id, req.Secret); nil != err {
 		return web.ResponseError(c, err)
 	}
 
@@ -190,3 +204,92 @@ func (n *notesHandler) ReActiveNotes(c echo.Context) error {
 
 	return web.Response(c, "Notes has active")
 }
+
+// @Router /notes/stats [get]
+// @Tags notes
+// @Summary Notes Statistics
+// @Description Counts, word and character totals, daily creation and storage used by the current user
+// @Accept json
+// @Produce json
+// @Param days query int false "window of the daily creation count"
+// @Param X-Org header int false "organization id, personal notes without it"
+// @Success 200 {object} model.NotesStats
+func (n *notesHandler) NotesStats(c echo.Context) error {
+	days, err := statsWindow(c)
+	if nil != err {
+		return web.ResponseError(c, app.BadRequestError)
+	}
+
+	session, ok := c.Get("session").(*token.Token)
+	if !ok {
+		return web.ResponseError(c, app.InternalError)
+	}
+
+	result, err := n.s.NotesStats(c.Request().Context(), session.UserId, organization(c), days)
+	if nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, result)
+}
+
+// @Router /admin/stats [get]
+// @Tags admin
+// @Summary Notes Statistics For All Users
+// @Description TODO
+// @Accept json
+// @Produce json
+// @Param days query int false "window of the daily creation count"
+// @Success 200 {object} model.NotesStats
+func (n *notesHandler) AdminStats(c echo.Context) error {
+	days, err := statsWindow(c)
+	if nil != err {
+		return web.ResponseError(c, app.BadRequestError)
+	}
+
+	result, err := n.s.NotesStats(c.Request().Context(), 0, 0, days)
+	if nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, result)
+}
+
+func statsWindow(c echo.Context) (int, error) {
+	if c.QueryParam("days") == "" {
+		return config.Cfg().StatsWindow, nil
+	}
+
+	days, err := strconv.Atoi(c.QueryParam("days"))
+	if nil != err {
+		return 0, err
+	}
+	if days < 1 || days > maxStatsWindow {
+		return 0, app.BadRequestError
+	}
+
+	return days, nil
+}
+
+// @Router /sync [get]
+// @Tags notes
+// @Summary Delta Sync Notes
+// @Description Notes created, updated or deleted since the change token, omit the token for a full sync
+// @Accept json
+// @Produce json
+// @Param since query string false "change token returned by the previous sync"
+// @Param X-Org header int false "organization id, personal notes without it"
+// @Success 200 {object} model.SyncResponse
+func (n *notesHandler) Sync(c echo.Context) error {
+	session, ok := c.Get("session").(*token.Token)
+	if !ok {
+		return web.ResponseError(c, app.InternalError)
+	}
+
+	result, err := n.s.Sync(c.Request().Context(), session.UserId, organization(c), c.QueryParam("since"))
+	if nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, result)
+}
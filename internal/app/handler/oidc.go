@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"refactory/notes/internal/app"
+	"refactory/notes/internal/app/model"
+	"refactory/notes/internal/config"
+	"refactory/notes/internal/security/token"
+	"refactory/notes/internal/web"
+)
+
+const (
+	// oidcBindingCookie ties the authorization flow to the browser that started it, it is only sent to the callback.
+	oidcBindingCookie = "oidc_binding"
+	oidcCallbackPath  = "/api/oidc/callback"
+)
+
+func setOidcBinding(c echo.Context, binding string, maxAge int) {
+	c.SetCookie(&http.Cookie{Name: oidcBindingCookie, Value: binding, Path: oidcCallbackPath, MaxAge: maxAge,
+		HttpOnly: true, Secure: !config.Cfg().IsDev, SameSite: http.SameSiteLaxMode})
+}
+
+// @Router /oidc/login [get]
+// @Tags login
+// @Summary Single Sign-On Login
+// @Description Redirect to the identity provider, it redirects back to /oidc/callback
+// @Success 302
+func (u *userHandler) OidcLogin(c echo.Context) error {
+	authorization, err := u.userService.OidcLogin(c.Request().Context())
+	if nil != err {
+		return web.ResponseError(c, err)
+	}
+	setOidcBinding(c, authorization.Binding, int(config.Cfg().OidcStateTTL.Seconds()))
+
+	return c.Redirect(http.StatusFound, authorization.Url)
+}
+
+// @Router /oidc/callback [get]
+// @Tags login
+// @Summary Single Sign-On Callback
+// @Description Sign in with the authorization code, the account is created on the first login.
+// @Description Only accepted from the browser that started the flow, users with 2FA get a challenge token for /login/2fa
+// @Accept json
+// @Produce json
+// @Param state query string true "state"
+// @Param code query string true "authorization code"
+// @Success 200 {object} model.LoginResponse
+func (u *userHandler) OidcCallback(c echo.Context) error {
+	state, code := c.QueryParam("state"), c.QueryParam("code")
+	if c.QueryParam("error") != "" || state == "" || code == "" {
+		return web.ResponseError(c, app.UnauthenticateError)
+	}
+
+	var binding string
+	if cookie, err := c.Cookie(oidcBindingCookie); nil == err {
+		binding = cookie.Value
+	}
+	setOidcBinding(c, "", -1)
+
+	response, err := u.userService.OidcCallback(c.Request().Context(), state, code, binding, client(c))
+	if nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, response)
+}
+
+// @Router /me/oidc/link [post]
+// @Tags me
+// @Summary Link Single Sign-On Account
+// @Description Returns the identity provider URL, after signing in there the provider account is linked to the current user.
+// @Description The URL has to be opened in the browser that made this request, the callback requires the cookie set here
+// @Accept json
+// @Produce json
+// @Success 200 {object} model.OidcLinkResponse
+func (u *userHandler) OidcLink(c echo.Context) error {
+	session, ok := c.Get("session").(*token.Token)
+	if !ok {
+		return web.ResponseError(c, app.InternalError)
+	}
+
+	authorization, err := u.userService.OidcLink(c.Request().Context(), *session)
+	if nil != err {
+		return web.ResponseError(c, err)
+	}
+	setOidcBinding(c, authorization.Binding, int(config.Cfg().OidcStateTTL.Seconds()))
+
+	return web.Response(c, model.OidcLinkResponse{Url: authorization.Url})
+}
@@ -0,0 +1,275 @@
+package handler
+
+import (
+	"github.com/labstack/echo/v4"
+	"refactory/notes/internal/app"
+	"refactory/notes/internal/app/model"
+	"refactory/notes/internal/app/service"
+	"refactory/notes/internal/security/token"
+	"refactory/notes/internal/web"
+	"strconv"
+)
+
+type OrganizationHandler interface {
+	CreateOrganization(c echo.Context) error
+	ListOrganization(c echo.Context) error
+	DeleteOrganization(c echo.Context) error
+	OrganizationToken(c echo.Context) error
+	ListMember(c echo.Context) error
+	AddMember(c echo.Context) error
+	UpdateMember(c echo.Context) error
+	RemoveMember(c echo.Context) error
+}
+
+type organizationHandler struct {
+	s service.OrganizationService
+}
+
+func NewOrganizationHandler(s service.OrganizationService) *organizationHandler {
+	return &organizationHandler{s: s}
+}
+
+// organization is the organization selected for the request, zero for the personal notes of the user.
+func organization(c echo.Context) int {
+	orgId, _ := c.Get("org").(int)
+	return orgId
+}
+
+// @Router /orgs [post]
+// @Tags orgs
+// @Summary Create Organization
+// @Description The creator becomes the owner of the organization
+// @Accept json
+// @Produce json
+// @Param payload body model.OrganizationRequest true "body request"
+// @Success 200 {object} model.OrganizationResponse
+func (o *organizationHandler) CreateOrganization(c echo.Context) error {
+	var req model.OrganizationRequest
+	if err := c.Bind(&req); nil != err {
+		return echo.ErrBadRequest
+	}
+	if err := c.Validate(&req); nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	session, ok := c.Get("session").(*token.Token)
+	if !ok {
+		return web.ResponseError(c, app.InternalError)
+	}
+
+	response, err := o.s.CreateOrganization(c.Request().Context(), *session, req)
+	if nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, response)
+}
+
+// @Router /orgs [get]
+// @Tags orgs
+// @Summary List Organization
+// @Description Organizations of the current user with their role in each
+// @Accept json
+// @Produce json
+// @Success 200 {array} model.OrganizationResponse
+func (o *organizationHandler) ListOrganization(c echo.Context) error {
+	session, ok := c.Get("session").(*token.Token)
+	if !ok {
+		return web.ResponseError(c, app.InternalError)
+	}
+
+	response, err := o.s.ListOrganization(c.Request().Context(), *session)
+	if nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, response)
+}
+
+// @Router /orgs/{id} [delete]
+// @Tags orgs
+// @Summary Delete Organization
+// @Description Removes the organization with its shared notes, owners only
+// @Accept json
+// @Produce json
+// @Param id path int true "organization id"
+// @Success 200 {string} result
+func (o *organizationHandler) DeleteOrganization(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if nil != err {
+		return web.ResponseError(c, app.BadRequestError)
+	}
+
+	session, ok := c.Get("session").(*token.Token)
+	if !ok {
+		return web.ResponseError(c, app.InternalError)
+	}
+
+	if err := o.s.DeleteOrganization(c.Request().Context(), *session, id); nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, "Organization deleted")
+}
+
+// @Router /orgs/{id}/token [post]
+// @Tags orgs
+// @Summary Organization Token
+// @Description Access token with the organization as org claim, requests made with it do not need the X-Org header
+// @Accept json
+// @Produce json
+// @Param id path int true "organization id"
+// @Success 200 {object} model.OrganizationTokenResponse
+func (o *organizationHandler) OrganizationToken(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if nil != err {
+		return web.ResponseError(c, app.BadRequestError)
+	}
+
+	session, ok := c.Get("session").(*token.Token)
+	if !ok {
+		return web.ResponseError(c, app.InternalError)
+	}
+
+	response, err := o.s.OrganizationToken(c.Request().Context(), *session, id)
+	if nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, response)
+}
+
+// @Router /orgs/{id}/members [get]
+// @Tags orgs
+// @Summary List Member
+// @Description TODO
+// @Accept json
+// @Produce json
+// @Param id path int true "organization id"
+// @Success 200 {array} model.MemberResponse
+func (o *organizationHandler) ListMember(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if nil != err {
+		return web.ResponseError(c, app.BadRequestError)
+	}
+
+	session, ok := c.Get("session").(*token.Token)
+	if !ok {
+		return web.ResponseError(c, app.InternalError)
+	}
+
+	response, err := o.s.ListMember(c.Request().Context(), *session, id)
+	if nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, response)
+}
+
+// @Router /orgs/{id}/members [post]
+// @Tags orgs
+// @Summary Add Member
+// @Description Adds a verified user to the organization with the owner, member or viewer role, owners only
+// @Accept json
+// @Produce json
+// @Param id path int true "organization id"
+// @Param payload body model.MemberRequest true "body request"
+// @Success 200 {object} model.MemberResponse
+func (o *organizationHandler) AddMember(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if nil != err {
+		return web.ResponseError(c, app.BadRequestError)
+	}
+
+	var req model.MemberRequest
+	if err := c.Bind(&req); nil != err {
+		return echo.ErrBadRequest
+	}
+	if err := c.Validate(&req); nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	session, ok := c.Get("session").(*token.Token)
+	if !ok {
+		return web.ResponseError(c, app.InternalError)
+	}
+
+	response, err := o.s.AddMember(c.Request().Context(), *session, id, req)
+	if nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, response)
+}
+
+// @Router /orgs/{id}/members/{user_id} [put]
+// @Tags orgs
+// @Summary Update Member
+// @Description Changes the role of the member, owners only
+// @Accept json
+// @Produce json
+// @Param id path int true "organization id"
+// @Param user_id path int true "user id"
+// @Param payload body model.MemberRoleRequest true "body request"
+// @Success 200 {object} model.MemberResponse
+func (o *organizationHandler) UpdateMember(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if nil != err {
+		return web.ResponseError(c, app.BadRequestError)
+	}
+	userId, err := strconv.Atoi(c.Param("user_id"))
+	if nil != err {
+		return web.ResponseError(c, app.BadRequestError)
+	}
+
+	var req model.MemberRoleRequest
+	if err := c.Bind(&req); nil != err {
+		return echo.ErrBadRequest
+	}
+	if err := c.Validate(&req); nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	session, ok := c.Get("session").(*token.Token)
+	if !ok {
+		return web.ResponseError(c, app.InternalError)
+	}
+
+	response, err := o.s.UpdateMember(c.Request().Context(), *session, id, userId, req.Role)
+	if nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, response)
+}
+
+// @Router /orgs/{id}/members/{user_id} [delete]
+// @Tags orgs
+// @Summary Remove Member
+// @Description Owners remove members, every member can remove themself to leave the organization
+// @Accept json
+// @Produce json
+// @Param id path int true "organization id"
+// @Param user_id path int true "user id"
+// @Success 200 {string} result
+func (o *organizationHandler) RemoveMember(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if nil != err {
+		return web.ResponseError(c, app.BadRequestError)
+	}
+	userId, err := strconv.Atoi(c.Param("user_id"))
+	if nil != err {
+		return web.ResponseError(c, app.BadRequestError)
+	}
+
+	session, ok := c.Get("session").(*token.Token)
+	if !ok {
+		return web.ResponseError(c, app.InternalError)
+	}
+
+	if err := o.s.RemoveMember(c.Request().Context(), *session, id, userId); nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, "Member removed")
+}
@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"github.com/labstack/echo/v4"
+	"refactory/notes/internal/app"
+	"refactory/notes/internal/app/model"
+	"refactory/notes/internal/app/service"
+	"refactory/notes/internal/security/token"
+	"refactory/notes/internal/web"
+	"strconv"
+)
+
+type PolicyHandler interface {
+	ListPolicy(c echo.Context) error
+	AddPolicy(c echo.Context) error
+	RemovePolicy(c echo.Context) error
+	TestPolicy(c echo.Context) error
+	ListAudit(c echo.Context) error
+}
+
+type policyHandler struct {
+	s service.PolicyService
+}
+
+func NewPolicyHandler(s service.PolicyService) *policyHandler {
+	return &policyHandler{s: s}
+}
+
+// @Router /admin/policies [get]
+// @Tags admin
+// @Summary List Policy
+// @Description Casbin p and g rules currently enforced
+// @Accept json
+// @Produce json
+// @Param p_type query string false "p or g"
+// @Success 200 {array} model.PolicyResponse
+func (p *policyHandler) ListPolicy(c echo.Context) error {
+	pType := c.QueryParam("p_type")
+	if pType != "" && pType != "p" && pType != "g" {
+		return web.ResponseError(c, app.BadRequestError)
+	}
+
+	response, err := p.s.ListPolicy(c.Request().Context(), pType)
+	if nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, response)
+}
+
+// @Router /admin/policies [post]
+// @Tags admin
+// @Summary Add Policy
+// @Description The rule is validated against casbin/model.conf, p rules are subject, path and method, g rules are user and role
+// @Accept json
+// @Produce json
+// @Param payload body model.PolicyRequest true "body request"
+// @Success 200 {string} result
+func (p *policyHandler) AddPolicy(c echo.Context) error {
+	var req model.PolicyRequest
+	if err := c.Bind(&req); nil != err {
+		return echo.ErrBadRequest
+	}
+	if err := c.Validate(&req); nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	session, ok := c.Get("session").(*token.Token)
+	if !ok {
+		return web.ResponseError(c, app.InternalError)
+	}
+
+	if err := p.s.AddPolicy(c.Request().Context(), session.UserId, req); nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, "Policy has added")
+}
+
+// @Router /admin/policies [delete]
+// @Tags admin
+// @Summary Remove Policy
+// @Description TODO
+// @Accept json
+// @Produce json
+// @Param payload body model.PolicyRequest true "body request"
+// @Success 200 {string} result
+func (p *policyHandler) RemovePolicy(c echo.Context) error {
+	var req model.PolicyRequest
+	if err := c.Bind(&req); nil != err {
+		return echo.ErrBadRequest
+	}
+	if err := c.Validate(&req); nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	session, ok := c.Get("session").(*token.Token)
+	if !ok {
+		return web.ResponseError(c, app.InternalError)
+	}
+
+	if err := p.s.RemovePolicy(c.Request().Context(), session.UserId, req); nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, "Policy has removed")
+}
+
+// @Router /admin/policies/test [post]
+// @Tags admin
+// @Summary Test Policy
+// @Description Evaluate an access decision, path is the route pattern such as /api/notes/:id
+// @Accept json
+// @Produce json
+// @Param payload body model.PolicyTestRequest true "body request"
+// @Success 200 {object} model.PolicyTestResponse
+func (p *policyHandler) TestPolicy(c echo.Context) error {
+	var req model.PolicyTestRequest
+	if err := c.Bind(&req); nil != err {
+		return echo.ErrBadRequest
+	}
+	if err := c.Validate(&req); nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	response, err := p.s.TestPolicy(c.Request().Context(), req)
+	if nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, response)
+}
+
+// @Router /admin/policies/audit [get]
+// @Tags admin
+// @Summary List Policy Audit
+// @Description Latest policy changes made through the API
+// @Accept json
+// @Produce json
+// @Param limit query int false "number of entries, at most 500"
+// @Success 200 {array} model.PolicyAudit
+func (p *policyHandler) ListAudit(c echo.Context) error {
+	var limit int
+	if c.QueryParam("limit") != "" {
+		var err error
+		if limit, err = strconv.Atoi(c.QueryParam("limit")); nil != err {
+			return web.ResponseError(c, app.BadRequestError)
+		}
+	}
+
+	response, err := p.s.ListAudit(c.Request().Context(), limit)
+	if nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, response)
+}
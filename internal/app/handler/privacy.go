@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/common/log"
+	"net/http"
+	"refactory/notes/internal/app"
+	"refactory/notes/internal/app/service"
+	"refactory/notes/internal/security/token"
+	"refactory/notes/internal/web"
+)
+
+type PrivacyHandler interface {
+	Export(c echo.Context) error
+	RequestErasure(c echo.Context) error
+}
+
+type privacyHandler struct {
+	s service.PrivacyService
+}
+
+func NewPrivacyHandler(s service.PrivacyService) *privacyHandler {
+	return &privacyHandler{s: s}
+}
+
+// @Router /me/export [get]
+// @Tags me
+// @Summary Export Account Data
+// @Description ZIP archive of the profile, notes, media files and audit events of the user
+// @Produce application/zip
+// @Success 200 {file} file
+func (p *privacyHandler) Export(c echo.Context) error {
+	session, ok := c.Get("session").(*token.Token)
+	if !ok {
+		return web.ResponseError(c, app.InternalError)
+	}
+
+	export, err := p.s.Export(c.Request().Context(), session.UserId)
+	if nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, "application/zip")
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s-export.zip"`, session.Username))
+	c.Response().WriteHeader(http.StatusOK)
+
+	// the status is already sent, a failure can only cut the archive short
+	if err := p.s.WriteExport(c.Request().Context(), export, c.Response()); nil != err {
+		log.Error(err)
+	}
+
+	return nil
+}
+
+// @Router /me [delete]
+// @Tags me
+// @Summary Erase Account
+// @Description Deactivate the account and erase it with all its data once the grace period is over, an admin reactivating the user cancels the erasure
+// @Accept json
+// @Produce json
+// @Success 200 {object} model.ErasureResponse
+func (p *privacyHandler) RequestErasure(c echo.Context) error {
+	session, ok := c.Get("session").(*token.Token)
+	if !ok {
+		return web.ResponseError(c, app.InternalError)
+	}
+
+	response, err := p.s.RequestErasure(c.Request().Context(), *session)
+	if nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, response)
+}
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"github.com/labstack/echo/v4"
+	"refactory/notes/internal/app"
+	"refactory/notes/internal/app/model"
+	"refactory/notes/internal/app/service"
+	"refactory/notes/internal/web"
+	"strconv"
+)
+
+type QuotaHandler interface {
+	GetQuota(c echo.Context) error
+	UpdateQuota(c echo.Context) error
+}
+
+type quotaHandler struct {
+	s service.QuotaService
+}
+
+func NewQuotaHandler(s service.QuotaService) *quotaHandler {
+	return &quotaHandler{s: s}
+}
+
+// @Router /admin/users/{id}/quota [get]
+// @Tags admin
+// @Summary Get User Quota
+// @Description Effective limits and current usage of the user
+// @Accept json
+// @Produce json
+// @Param id path int true "user id"
+// @Success 200 {object} model.QuotaResponse
+func (q *quotaHandler) GetQuota(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if nil != err {
+		return web.ResponseError(c, app.BadRequestError)
+	}
+
+	response, err := q.s.GetQuota(c.Request().Context(), id)
+	if nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, response)
+}
+
+// @Router /admin/users/{id}/quota [put]
+// @Tags admin
+// @Summary Override User Quota
+// @Description Omitted limits use the configured default, sending no limit at all removes the override
+// @Accept json
+// @Produce json
+// @Param id path int true "user id"
+// @Param payload body model.QuotaRequest true "body request"
+// @Success 200 {object} model.QuotaResponse
+func (q *quotaHandler) UpdateQuota(c echo.Context) error {
+	var req model.QuotaRequest
+	id, err := strconv.Atoi(c.Param("id"))
+	if nil != err {
+		return web.ResponseError(c, app.BadRequestError)
+	}
+	if err := c.Bind(&req); nil != err {
+		return echo.ErrBadRequest
+	}
+	if err := c.Validate(&req); nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	response, err := q.s.UpdateQuota(c.Request().Context(), id, req)
+	if nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, response)
+}
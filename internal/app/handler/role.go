@@ -0,0 +1,191 @@
+package handler
+
+import (
+	"github.com/labstack/echo/v4"
+	"refactory/notes/internal/app/model"
+	"refactory/notes/internal/app/service"
+	"refactory/notes/internal/web"
+	"strconv"
+)
+
+type RoleHandler interface {
+	ListRole(c echo.Context) error
+	DetailRole(c echo.Context) error
+	CreateRole(c echo.Context) error
+	EditRole(c echo.Context) error
+	DeleteRole(c echo.Context) error
+	AssignRole(c echo.Context) error
+	UnassignRole(c echo.Context) error
+}
+
+type roleHandler struct {
+	s service.RoleService
+}
+
+func NewRoleHandler(s service.RoleService) *roleHandler {
+	return &roleHandler{s: s}
+}
+
+// @Router /admin/roles [get]
+// @Tags admin
+// @Summary List Role
+// @Description Roles with the number of users assigned to them
+// @Accept json
+// @Produce json
+// @Success 200 {array} model.RoleResponse
+func (r *roleHandler) ListRole(c echo.Context) error {
+	response, err := r.s.ListRole(c.Request().Context())
+	if nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, response)
+}
+
+// @Router /admin/roles/{id} [get]
+// @Tags admin
+// @Summary Detail Role
+// @Description TODO
+// @Accept json
+// @Produce json
+// @Param id path int true "role id"
+// @Success 200 {object} model.RoleResponse
+func (r *roleHandler) DetailRole(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if nil != err {
+		return echo.ErrBadRequest
+	}
+
+	response, err := r.s.DetailRole(c.Request().Context(), id)
+	if nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, response)
+}
+
+// @Router /admin/roles [post]
+// @Tags admin
+// @Summary Create Role
+// @Description Custom roles start without permissions, grant them through the Casbin policies
+// @Accept json
+// @Produce json
+// @Param payload body model.RoleRequest true "body request"
+// @Success 200 {object} model.RoleResponse
+func (r *roleHandler) CreateRole(c echo.Context) error {
+	var req model.RoleRequest
+	if err := c.Bind(&req); nil != err {
+		return echo.ErrBadRequest
+	}
+	if err := c.Validate(&req); nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	response, err := r.s.CreateRole(c.Request().Context(), req)
+	if nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, response)
+}
+
+// @Router /admin/roles/{id} [put]
+// @Tags admin
+// @Summary Rename Role
+// @Description The built-in user and admin roles can not be renamed
+// @Accept json
+// @Produce json
+// @Param id path int true "role id"
+// @Param payload body model.RoleRequest true "body request"
+// @Success 200 {object} model.RoleResponse
+func (r *roleHandler) EditRole(c echo.Context) error {
+	var req model.RoleRequest
+	id, err := strconv.Atoi(c.Param("id"))
+	if nil != err {
+		return echo.ErrBadRequest
+	}
+	if err := c.Bind(&req); nil != err {
+		return echo.ErrBadRequest
+	}
+	if err := c.Validate(&req); nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	response, err := r.s.UpdateRole(c.Request().Context(), id, req)
+	if nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, response)
+}
+
+// @Router /admin/roles/{id} [delete]
+// @Tags admin
+// @Summary Delete Role
+// @Description Only roles without users can be deleted, the built-in roles can not be deleted
+// @Accept json
+// @Produce json
+// @Param id path int true "role id"
+// @Success 200 {string} result
+func (r *roleHandler) DeleteRole(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if nil != err {
+		return echo.ErrBadRequest
+	}
+
+	if err := r.s.DeleteRole(c.Request().Context(), id); nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, "Role has deleted")
+}
+
+// @Router /admin/users/{id}/role [put]
+// @Tags admin
+// @Summary Assign Role
+// @Description The user has to login again to use the new role
+// @Accept json
+// @Produce json
+// @Param id path int true "user id"
+// @Param payload body model.AssignRoleRequest true "body request"
+// @Success 200 {string} result
+func (r *roleHandler) AssignRole(c echo.Context) error {
+	var req model.AssignRoleRequest
+	id, err := strconv.Atoi(c.Param("id"))
+	if nil != err {
+		return echo.ErrBadRequest
+	}
+	if err := c.Bind(&req); nil != err {
+		return echo.ErrBadRequest
+	}
+	if err := c.Validate(&req); nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	if err := r.s.AssignRole(c.Request().Context(), id, req.RoleId); nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, "Role has assigned")
+}
+
+// @Router /admin/users/{id}/role [delete]
+// @Tags admin
+// @Summary Unassign Role
+// @Description Put the user back on the default user role
+// @Accept json
+// @Produce json
+// @Param id path int true "user id"
+// @Success 200 {string} result
+func (r *roleHandler) UnassignRole(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if nil != err {
+		return echo.ErrBadRequest
+	}
+
+	if err := r.s.UnassignRole(c.Request().Context(), id); nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, "Role has unassigned")
+}
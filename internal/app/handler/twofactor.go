@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"github.com/labstack/echo/v4"
+	"refactory/notes/internal/app"
+	"refactory/notes/internal/app/model"
+	"refactory/notes/internal/security/token"
+	"refactory/notes/internal/web"
+	"strconv"
+)
+
+// @Router /me/2fa/enroll [post]
+// @Tags me
+// @Summary Enroll Two Factor Authentication
+// @Description Returns the otpauth URI and one-time recovery codes, 2FA is enforced after verification
+// @Accept json
+// @Produce json
+// @Success 200 {object} model.TwoFactorEnrollResponse
+func (u *userHandler) EnrollTwoFactor(c echo.Context) error {
+	session, ok := c.Get("session").(*token.Token)
+	if !ok {
+		return web.ResponseError(c, app.InternalError)
+	}
+
+	response, err := u.userService.EnrollTwoFactor(c.Request().Context(), *session)
+	if nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, response)
+}
+
+// @Router /me/2fa/verify [post]
+// @Tags me
+// @Summary Verify Two Factor Authentication
+// @Description Activate 2FA with a code of the authenticator app
+// @Accept json
+// @Produce json
+// @Param payload body model.TwoFactorRequest true "body request"
+// @Success 200 {string} result
+func (u *userHandler) VerifyTwoFactor(c echo.Context) error {
+	var req model.TwoFactorRequest
+	if err := c.Bind(&req); nil != err {
+		return echo.ErrBadRequest
+	}
+	if err := c.Validate(req); nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	session, ok := c.Get("session").(*token.Token)
+	if !ok {
+		return web.ResponseError(c, app.InternalError)
+	}
+
+	if err := u.userService.VerifyTwoFactor(c.Request().Context(), *session, req.Code); nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, "Two factor authentication has enabled")
+}
+
+// @Router /login/2fa [post]
+// @Tags login
+// @Summary Login Second Factor
+// @Description Exchange the challenge token from login and a TOTP or recovery code for a token pair
+// @Accept json
+// @Produce json
+// @Param payload body model.TwoFactorLoginRequest true "body request"
+// @Success 200 {object} model.LoginResponse
+func (u *userHandler) LoginTwoFactor(c echo.Context) error {
+	var req model.TwoFactorLoginRequest
+	if err := c.Bind(&req); nil != err {
+		return echo.ErrBadRequest
+	}
+	if err := c.Validate(req); nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	response, err := u.userService.LoginTwoFactor(c.Request().Context(), req.ChallengeToken, req.Code, client(c))
+	if nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, response)
+}
+
+// @Router /admin/users/{id}/2fa [delete]
+// @Tags admin
+// @Summary Reset Two Factor Authentication
+// @Description TODO
+// @Accept json
+// @Produce json
+// @Param id path int true "user id"
+// @Success 200 {string} result
+func (u *userHandler) ResetTwoFactor(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if nil != err {
+		return web.ResponseError(c, app.BadRequestError)
+	}
+
+	if err := u.userService.ResetTwoFactor(c.Request().Context(), id); nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, "Two factor authentication has reset")
+}
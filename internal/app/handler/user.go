@@ -9,6 +9,12 @@ import (
 	"refactory/notes/internal/security/token"
 	"refactory/notes/internal/web"
 	"strconv"
+	"strings"
+)
+
+const (
+	defaultPerPage = 20
+	maxPerPage     = 100
 )
 
 type UserHandler interface {
@@ -16,10 +22,33 @@ type UserHandler interface {
 	Login(c echo.Context) error
 	VerifyCode(c echo.Context) error
 	ListUser(c echo.Context) error
+	ExportUser(c echo.Context) error
 	DetailUser(c echo.Context) error
 	EditUser(c echo.Context) error
 	DeleteUser(c echo.Context) error
 	ActiveUser(c echo.Context) error
+	ForgotPassword(c echo.Context) error
+	ResetPassword(c echo.Context) error
+	Me(c echo.Context) error
+	UpdateMe(c echo.Context) error
+	ChangePassword(c echo.Context) error
+	Refresh(c echo.Context) error
+	Logout(c echo.Context) error
+	EnrollTwoFactor(c echo.Context) error
+	VerifyTwoFactor(c echo.Context) error
+	LoginTwoFactor(c echo.Context) error
+	ResetTwoFactor(c echo.Context) error
+	ResendVerification(c echo.Context) error
+	VerifyLink(c echo.Context) error
+	UnlockUser(c echo.Context) error
+	OidcLogin(c echo.Context) error
+	OidcCallback(c echo.Context) error
+	OidcLink(c echo.Context) error
+	ListDevice(c echo.Context) error
+	RevokeDevice(c echo.Context) error
+	RevokeOtherDevices(c echo.Context) error
+	VerifyEmailChange(c echo.Context) error
+	CancelEmailChange(c echo.Context) error
 }
 
 type userHandler struct {
@@ -33,7 +62,7 @@ func NewUserHandler(userService service.UserService) *userHandler {
 // @Router /registrasi [post]
 // @Tags registrasi
 // @Summary Create User
-// @Description TODO
+// @Description Registering requires an invitation token when registration is invite only
 // @Accept json
 // @Produce json
 // @Param payload body model.UserRequest true "body request"
@@ -106,7 +135,7 @@ func (u *userHandler) Login(c echo.Context) error {
 		return web.ResponseError(c, err)
 	}
 
-	resp, err := u.userService.Login(c.Request().Context(), req.Username, req.Password)
+	resp, err := u.userService.Login(c.Request().Context(), req.Username, req.Password, client(c))
 	if nil != err {
 		return web.ResponseError(c, err)
 	}
@@ -117,12 +146,24 @@ func (u *userHandler) Login(c echo.Context) error {
 // @Router /users [get]
 // @Tags users
 // @Summary List User
-// @Description TODO
+// @Description Page of the users matching the search and filters
 // @Accept json
 // @Produce json
-// @Success 200 {array} model.UserResponse
+// @Param q query string false "search in names, email and username"
+// @Param role_id query int false "role id"
+// @Param verified query bool false "verified users only, or unverified with false"
+// @Param active query bool false "active users only, or deactivated with false"
+// @Param sort query string false "id, username, email, first_name or last_name, prefixed with - for descending order"
+// @Param page query int false "page number starting at 1"
+// @Param per_page query int false "users per page, at most 100"
+// @Success 200 {object} model.UserListResponse
 func (u *userHandler) ListUser(c echo.Context) error {
-	response, err := u.userService.ListUser(c.Request().Context())
+	filter, err := userFilter(c)
+	if nil != err {
+		return web.ResponseError(c, app.BadRequestError)
+	}
+
+	response, err := u.userService.ListUser(c.Request().Context(), filter)
 	if nil != err {
 		return web.ResponseError(c, err)
 	}
@@ -130,6 +171,39 @@ func (u *userHandler) ListUser(c echo.Context) error {
 	return web.Response(c, response)
 }
 
+// @Router /admin/users/export [get]
+// @Tags admin
+// @Summary Export User
+// @Description CSV of every user matching the search and filters of the user listing
+// @Produce text/csv
+// @Param q query string false "search in names, email and username"
+// @Param role_id query int false "role id"
+// @Param verified query bool false "verified users only, or unverified with false"
+// @Param active query bool false "active users only, or deactivated with false"
+// @Param sort query string false "id, username, email, first_name or last_name, prefixed with - for descending order"
+// @Success 200 {file} file
+func (u *userHandler) ExportUser(c echo.Context) error {
+	filter, err := userFilter(c)
+	if nil != err {
+		return web.ResponseError(c, app.BadRequestError)
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, "text/csv")
+	c.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="users.csv"`)
+
+	if err := u.userService.ExportUser(c.Request().Context(), filter, c.Response()); nil != err {
+		// once the first rows are sent a failure can only cut the file short
+		if c.Response().Committed {
+			log.Error(err)
+			return nil
+		}
+		c.Response().Header().Del(echo.HeaderContentDisposition)
+		return web.ResponseError(c, err)
+	}
+
+	return nil
+}
+
 // @Router /users/{id} [get]
 // @Tags users
 // @Summary Detail User
@@ -159,20 +233,22 @@ func (u *userHandler) DetailUser(c echo.Context) error {
 // @Accept json
 // @Produce json
 // Param id path int true "user id"
-// @Param payload body model.UserRequest true "body request"
+// @Param payload body model.UpdateUserRequest true "body request"
 // @Success 200 {array} model.UserResponse
 func (u *userHandler) EditUser(c echo.Context) error {
-	var req model.UserRequest
+	var req model.UpdateUserRequest
 	id, err := strconv.Atoi(c.Param("id"))
 	if nil != err {
 		return web.ResponseError(c, app.BadRequestError)
 	}
-	c.Bind(&req)
+	if err := c.Bind(&req); nil != err {
+		return echo.ErrBadRequest
+	}
 	if err := c.Validate(req); nil != err {
 		return web.ResponseError(c, err)
 	}
 
-	response, err := u.userService.UpdateUser(c.Request().Context(), model.NewUser(id, req.FirstName, req.LastName, req.Email, req.Username, req.Password, req.Photo, 0))
+	response, err := u.userService.UpdateUser(c.Request().Context(), model.NewUser(id, req.FirstName, req.LastName, req.Email, req.Username, "", "", 0))
 	if nil != err {
 		log.Error(err)
 		return web.ResponseError(c, err)
@@ -222,3 +298,296 @@ func (u *userHandler) ActiveUser(c echo.Context) error {
 
 	return web.Response(c, "User has active")
 }
+
+// @Router /password/forgot [post]
+// @Tags password
+// @Summary Request Password Reset
+// @Description Mail a single use reset token, the response never reveals whether the account exists
+// @Accept json
+// @Produce json
+// @Param payload body model.ForgotPasswordRequest true "body request"
+// @Success 200 {string} result
+func (u *userHandler) ForgotPassword(c echo.Context) error {
+	var req model.ForgotPasswordRequest
+	if err := c.Bind(&req); nil != err {
+		return echo.ErrBadRequest
+	}
+
+	if err := c.Validate(req); nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	if err := u.userService.ForgotPassword(c.Request().Context(), req.Email); nil != err {
+		log.Error(err)
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, "If the email is registered, a reset token has been sent")
+}
+
+// @Router /password/reset [post]
+// @Tags password
+// @Summary Reset Password
+// @Description Set a new password with the mailed reset token, every existing session is revoked
+// @Accept json
+// @Produce json
+// @Param payload body model.ResetPasswordRequest true "body request"
+// @Success 200 {string} result
+func (u *userHandler) ResetPassword(c echo.Context) error {
+	var req model.ResetPasswordRequest
+	if err := c.Bind(&req); nil != err {
+		return echo.ErrBadRequest
+	}
+
+	if err := c.Validate(req); nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	if err := u.userService.ResetPassword(c.Request().Context(), req.Token, req.Password); nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, "Password has changed")
+}
+
+// @Router /me [get]
+// @Tags me
+// @Summary Current User Profile
+// @Description TODO
+// @Accept json
+// @Produce json
+// @Success 200 {object} model.UserResponse
+func (u *userHandler) Me(c echo.Context) error {
+	session, ok := c.Get("session").(*token.Token)
+	if !ok {
+		return web.ResponseError(c, app.InternalError)
+	}
+
+	response, err := u.userService.DetailUser(c.Request().Context(), session.UserId)
+	if nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, response)
+}
+
+// @Router /me [put]
+// @Tags me
+// @Summary Update Current User Profile
+// @Description A new email address is kept pending until it is confirmed at /me/email/verify
+// @Accept json
+// @Produce json
+// @Param payload body model.ProfileRequest true "body request"
+// @Success 200 {object} model.UserResponse
+func (u *userHandler) UpdateMe(c echo.Context) error {
+	var req model.ProfileRequest
+	if err := c.Bind(&req); nil != err {
+		return echo.ErrBadRequest
+	}
+	if err := c.Validate(req); nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	session, ok := c.Get("session").(*token.Token)
+	if !ok {
+		return web.ResponseError(c, app.InternalError)
+	}
+
+	response, err := u.userService.UpdateProfile(c.Request().Context(), *session, req)
+	if nil != err {
+		log.Error(err)
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, response)
+}
+
+// @Router /me/password [post]
+// @Tags me
+// @Summary Change Password
+// @Description Requires the current password, every other session is revoked and a new token is returned
+// @Accept json
+// @Produce json
+// @Param payload body model.ChangePasswordRequest true "body request"
+// @Success 200 {object} model.LoginResponse
+func (u *userHandler) ChangePassword(c echo.Context) error {
+	var req model.ChangePasswordRequest
+	if err := c.Bind(&req); nil != err {
+		return echo.ErrBadRequest
+	}
+	if err := c.Validate(req); nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	session, ok := c.Get("session").(*token.Token)
+	if !ok {
+		return web.ResponseError(c, app.InternalError)
+	}
+
+	response, err := u.userService.ChangePassword(c.Request().Context(), *session, req.CurrentPassword, req.NewPassword, client(c))
+	if nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, response)
+}
+
+// @Router /token/refresh [post]
+// @Tags login
+// @Summary Refresh Token
+// @Description Exchange a refresh token for a new token pair, a refresh token can only be used once
+// @Accept json
+// @Produce json
+// @Param payload body model.RefreshRequest true "body request"
+// @Success 200 {object} model.LoginResponse
+func (u *userHandler) Refresh(c echo.Context) error {
+	var req model.RefreshRequest
+	if err := c.Bind(&req); nil != err {
+		return echo.ErrBadRequest
+	}
+	if err := c.Validate(req); nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	response, err := u.userService.Refresh(c.Request().Context(), req.RefreshToken, client(c))
+	if nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, response)
+}
+
+// @Router /logout [post]
+// @Tags login
+// @Summary Logout
+// @Description Revoke the access token and, when given, the refresh token family
+// @Accept json
+// @Produce json
+// @Param payload body model.LogoutRequest false "body request"
+// @Success 200 {string} result
+func (u *userHandler) Logout(c echo.Context) error {
+	var req model.LogoutRequest
+	if err := c.Bind(&req); nil != err {
+		return echo.ErrBadRequest
+	}
+
+	session, ok := c.Get("session").(*token.Token)
+	if !ok {
+		return web.ResponseError(c, app.InternalError)
+	}
+
+	if err := u.userService.Logout(c.Request().Context(), *session, req.RefreshToken); nil != err {
+		log.Error(err)
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, "Logged out")
+}
+
+// @Router /verification/resend [post]
+// @Tags registrasi
+// @Summary Resend Verification
+// @Description Mail a new verification code and link, limited to once per cooldown
+// @Accept json
+// @Produce json
+// @Param payload body model.ResendVerificationRequest true "body request"
+// @Success 200 {string} result
+func (u *userHandler) ResendVerification(c echo.Context) error {
+	var req model.ResendVerificationRequest
+	if err := c.Bind(&req); nil != err {
+		return echo.ErrBadRequest
+	}
+	if err := c.Validate(req); nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	if err := u.userService.ResendVerification(c.Request().Context(), req.Email); nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, "If the account is waiting for verification, a new code has been sent")
+}
+
+// @Router /verification/link [get]
+// @Tags registrasi
+// @Summary Verify With Magic Link
+// @Description Verify the account with the token of the mailed link, no JWT required
+// @Accept json
+// @Produce json
+// @Param token query string true "link token"
+// @Success 200 {string} result
+func (u *userHandler) VerifyLink(c echo.Context) error {
+	link := c.QueryParam("token")
+	if link == "" {
+		return web.ResponseError(c, app.BadRequestError)
+	}
+
+	if err := u.userService.VerifyLink(c.Request().Context(), link); nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, "Account has verified")
+}
+
+// @Router /admin/users/{id}/lock [delete]
+// @Tags admin
+// @Summary Unlock User
+// @Description Lift the login lockout of the user
+// @Accept json
+// @Produce json
+// @Param id path int true "user id"
+// @Success 200 {string} result
+func (u *userHandler) UnlockUser(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if nil != err {
+		return web.ResponseError(c, app.BadRequestError)
+	}
+
+	if err := u.userService.UnlockUser(c.Request().Context(), id); nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, "User has unlocked")
+}
+
+func userFilter(c echo.Context) (model.UserFilter, error) {
+	filter := model.UserFilter{Query: c.QueryParam("q"), Page: 1, PerPage: defaultPerPage}
+
+	var err error
+	if value := c.QueryParam("role_id"); value != "" {
+		if filter.RoleId, err = strconv.Atoi(value); nil != err {
+			return filter, err
+		}
+	}
+	if value := c.QueryParam("verified"); value != "" {
+		verified, err := strconv.ParseBool(value)
+		if nil != err {
+			return filter, err
+		}
+		filter.Verified = &verified
+	}
+	if value := c.QueryParam("active"); value != "" {
+		active, err := strconv.ParseBool(value)
+		if nil != err {
+			return filter, err
+		}
+		filter.Active = &active
+	}
+	if value := c.QueryParam("page"); value != "" {
+		if filter.Page, err = strconv.Atoi(value); nil != err || filter.Page < 1 {
+			return filter, app.BadRequestError
+		}
+	}
+	if value := c.QueryParam("per_page"); value != "" {
+		if filter.PerPage, err = strconv.Atoi(value); nil != err || filter.PerPage < 1 || filter.PerPage > maxPerPage {
+			return filter, app.BadRequestError
+		}
+	}
+
+	filter.Sort = c.QueryParam("sort")
+	if strings.HasPrefix(filter.Sort, "-") {
+		filter.Sort, filter.Desc = filter.Sort[1:], true
+	}
+
+	return filter, nil
+}
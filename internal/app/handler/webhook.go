@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"github.com/labstack/echo/v4"
+	"refactory/notes/internal/app"
+	"refactory/notes/internal/app/model"
+	"refactory/notes/internal/app/service"
+	"refactory/notes/internal/security/token"
+	"refactory/notes/internal/web"
+	"strconv"
+)
+
+type WebhookHandler interface {
+	CreateWebhook(c echo.Context) error
+	ListWebhook(c echo.Context) error
+	DeleteWebhook(c echo.Context) error
+	ListDelivery(c echo.Context) error
+	ReplayDelivery(c echo.Context) error
+}
+
+type webhookHandler struct {
+	s service.WebhookService
+}
+
+func NewWebhookHandler(s service.WebhookService) *webhookHandler {
+	return &webhookHandler{s: s}
+}
+
+// @Router /webhooks [post]
+// @Tags webhooks
+// @Summary Register Webhook
+// @Description Subscribe an endpoint to note and user events, the signing secret is only returned once
+// @Accept json
+// @Produce json
+// @Param payload body model.WebhookRequest true "body request"
+// @Success 200 {object} model.WebhookResponse
+func (w *webhookHandler) CreateWebhook(c echo.Context) error {
+	var req model.WebhookRequest
+	if err := c.Bind(&req); nil != err {
+		return echo.ErrBadRequest
+	}
+	if err := c.Validate(&req); nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	session, ok := c.Get("session").(*token.Token)
+	if !ok {
+		return web.ResponseError(c, app.InternalError)
+	}
+
+	response, err := w.s.CreateWebhook(c.Request().Context(), session.UserId, req)
+	if nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, response)
+}
+
+// @Router /webhooks [get]
+// @Tags webhooks
+// @Summary List Webhook
+// @Description TODO
+// @Accept json
+// @Produce json
+// @Success 200 {array} model.WebhookResponse
+func (w *webhookHandler) ListWebhook(c echo.Context) error {
+	session, ok := c.Get("session").(*token.Token)
+	if !ok {
+		return web.ResponseError(c, app.InternalError)
+	}
+
+	result, err := w.s.ListWebhook(c.Request().Context(), session.UserId, session.RoleId)
+	if nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, result)
+}
+
+// @Router /webhooks/{id} [delete]
+// @Tags webhooks
+// @Summary Delete Webhook
+// @Description TODO
+// @Accept json
+// @Produce json
+// @Param id path int true "id webhook"
+// @Success 200 {string} result
+func (w *webhookHandler) DeleteWebhook(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if nil != err {
+		return echo.ErrBadRequest
+	}
+
+	session, ok := c.Get("session").(*token.Token)
+	if !ok {
+		return web.ResponseError(c, app.InternalError)
+	}
+
+	if err := w.s.DeleteWebhook(c.Request().Context(), session.UserId, id, session.RoleId); nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, "Webhook has deleted")
+}
+
+// @Router /webhooks/{id}/deliveries [get]
+// @Tags webhooks
+// @Summary List Webhook Deliveries
+// @Description TODO
+// @Accept json
+// @Produce json
+// @Param id path int true "id webhook"
+// @Success 200 {array} model.WebhookDeliveryResponse
+func (w *webhookHandler) ListDelivery(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if nil != err {
+		return echo.ErrBadRequest
+	}
+
+	session, ok := c.Get("session").(*token.Token)
+	if !ok {
+		return web.ResponseError(c, app.InternalError)
+	}
+
+	result, err := w.s.ListDelivery(c.Request().Context(), session.UserId, id, session.RoleId)
+	if nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, result)
+}
+
+// @Router /webhooks/deliveries/{id}/replay [post]
+// @Tags webhooks
+// @Summary Replay Webhook Delivery
+// @Description Queue a new delivery with the same event payload
+// @Accept json
+// @Produce json
+// @Param id path int true "id delivery"
+// @Success 200 {object} model.WebhookDeliveryResponse
+func (w *webhookHandler) ReplayDelivery(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if nil != err {
+		return echo.ErrBadRequest
+	}
+
+	session, ok := c.Get("session").(*token.Token)
+	if !ok {
+		return web.ResponseError(c, app.InternalError)
+	}
+
+	result, err := w.s.ReplayDelivery(c.Request().Context(), session.UserId, id, session.RoleId)
+	if nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	return web.Response(c, result)
+}
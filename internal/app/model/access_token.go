@@ -0,0 +1,39 @@
+package model
+
+import "time"
+
+// AccessToken is a personal access token, its scopes are casbin subjects prefixed with scope: that limit
+// the routes the token can reach on top of the policies of the user.
+type AccessToken struct {
+	Id         int
+	UserId     int
+	Username   string
+	RoleId     int
+	Name       string
+	Hash       string
+	Scopes     []string
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	CreatedAt  time.Time
+}
+
+type AccessTokenRequest struct {
+	Name      string     `json:"name" validate:"required,max=128"`
+	Scopes    []string   `json:"scopes" validate:"required,min=1,dive,oneof=notes:read notes:write media:write webhooks:read webhooks:write"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type AccessTokenResponse struct {
+	Id         int        `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	Token      string     `json:"token,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func NewAccessTokenResponse(t AccessToken, raw string) *AccessTokenResponse {
+	return &AccessTokenResponse{Id: t.Id, Name: t.Name, Scopes: t.Scopes, Token: raw, ExpiresAt: t.ExpiresAt,
+		LastUsedAt: t.LastUsedAt, CreatedAt: t.CreatedAt}
+}
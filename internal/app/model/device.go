@@ -0,0 +1,31 @@
+package model
+
+import "time"
+
+// Client describes where a login comes from, it is recorded on the device session.
+type Client struct {
+	Ip        string
+	UserAgent string
+}
+
+// Device is a signed in session of a user, its id is the family of the refresh tokens rotated from the login.
+type Device struct {
+	Id         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	Ip         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+}
+
+type DeviceResponse struct {
+	Id         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	Ip         string    `json:"ip"`
+	Current    bool      `json:"current"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+}
+
+func NewDeviceResponse(d Device, current bool) DeviceResponse {
+	return DeviceResponse{Id: d.Id, UserAgent: d.UserAgent, Ip: d.Ip, Current: current, CreatedAt: d.CreatedAt, LastSeenAt: d.LastSeenAt}
+}
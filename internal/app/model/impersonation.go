@@ -0,0 +1,55 @@
+package model
+
+import "time"
+
+// Impersonation is a support session where an admin acts as a user with a short lived token.
+type Impersonation struct {
+	Id            int
+	AdminId       int
+	AdminUsername string
+	UserId        int
+	Reason        string
+	Jti           string
+	ExpiresAt     time.Time
+	EndedAt       *time.Time
+	CreatedAt     time.Time
+	Requests      []ImpersonationRequest
+}
+
+// ImpersonationRequest is a request made with an impersonation token.
+type ImpersonationRequest struct {
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Status    int       `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ImpersonateRequest struct {
+	Reason string `json:"reason" validate:"required,max=512"`
+}
+
+type ImpersonateResponse struct {
+	Id        int       `json:"id"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type ImpersonationResponse struct {
+	Id        int                    `json:"id"`
+	Admin     string                 `json:"admin"`
+	UserId    int                    `json:"user_id"`
+	Reason    string                 `json:"reason"`
+	ExpiresAt time.Time              `json:"expires_at"`
+	EndedAt   *time.Time             `json:"ended_at,omitempty"`
+	CreatedAt time.Time              `json:"created_at"`
+	Requests  []ImpersonationRequest `json:"requests"`
+}
+
+func NewImpersonationResponse(i Impersonation) *ImpersonationResponse {
+	requests := i.Requests
+	if nil == requests {
+		requests = []ImpersonationRequest{}
+	}
+	return &ImpersonationResponse{Id: i.Id, Admin: i.AdminUsername, UserId: i.UserId, Reason: i.Reason, ExpiresAt: i.ExpiresAt,
+		EndedAt: i.EndedAt, CreatedAt: i.CreatedAt, Requests: requests}
+}
@@ -0,0 +1,58 @@
+package model
+
+import "time"
+
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationRevoked  = "revoked"
+	InvitationExpired  = "expired"
+)
+
+type Invitation struct {
+	Id         int
+	Email      string
+	RoleId     int
+	RoleName   string
+	Hash       string
+	InvitedBy  int
+	ExpiresAt  time.Time
+	AcceptedAt *time.Time
+	RevokedAt  *time.Time
+	CreatedAt  time.Time
+}
+
+// Status tells whether the invitation can still be used to sign up.
+func (i Invitation) Status() string {
+	switch {
+	case nil != i.AcceptedAt:
+		return InvitationAccepted
+	case nil != i.RevokedAt:
+		return InvitationRevoked
+	case time.Now().After(i.ExpiresAt):
+		return InvitationExpired
+	default:
+		return InvitationPending
+	}
+}
+
+type InvitationRequest struct {
+	Email     string     `json:"email" validate:"required,email"`
+	RoleId    int        `json:"role_id" validate:"required"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type InvitationResponse struct {
+	Id         int        `json:"id"`
+	Email      string     `json:"email"`
+	Role       string     `json:"role"`
+	Status     string     `json:"status"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	AcceptedAt *time.Time `json:"accepted_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func NewInvitationResponse(i Invitation) *InvitationResponse {
+	return &InvitationResponse{Id: i.Id, Email: i.Email, Role: i.RoleName, Status: i.Status(), ExpiresAt: i.ExpiresAt,
+		AcceptedAt: i.AcceptedAt, CreatedAt: i.CreatedAt}
+}
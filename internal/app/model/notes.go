@@ -1,13 +1,23 @@
 package model
 
 type Notes struct {
-	Id       int
-	UserId   int
-	Type     string
-	Title    string
-	Body     string
-	Secret   string
-	IsActive string
+	Id             int
+	UserId         int
+	Type           string
+	Title          string
+	Body           string
+	Secret         string
+	IsActive       bool
+	ChangeSeq      int64
+	ChangeTxid     int64
+	OrganizationId int
+}
+
+// ChangeCursor is the position of a sync client in the change feed, notes are ordered by the transaction
+// that wrote them and then by their change sequence.
+type ChangeCursor struct {
+	Txid int64
+	Seq  int64
 }
 
 func NewNotes(id int, userId int,
@@ -38,3 +48,27 @@ func NewNotesResponse(id int,
 type SecretRequest struct {
 	Secret string `json:"secret"`
 }
+
+type NotesStats struct {
+	Total        int            `json:"total"`
+	Active       int            `json:"active"`
+	Deleted      int            `json:"deleted"`
+	ByType       map[string]int `json:"by_type"`
+	Words        int64          `json:"words"`
+	Characters   int64          `json:"characters"`
+	StorageBytes int64          `json:"storage_bytes"`
+	Days         int            `json:"days"`
+	PerDay       []DailyCount   `json:"per_day"`
+}
+
+type DailyCount struct {
+	Date  string `json:"date"`
+	Count int    `json:"count"`
+}
+
+type SyncResponse struct {
+	Notes   []*NotesResponse `json:"notes"`
+	Deleted []int            `json:"deleted"`
+	Token   string           `json:"token"`
+	HasMore bool             `json:"has_more"`
+}
@@ -0,0 +1,22 @@
+package model
+
+// OidcState is kept between the redirect to the identity provider and the callback,
+// LinkUserId is set when a signed in user links the provider account to their local account.
+// Binding is the hash of the value set as cookie on the browser that started the flow.
+type OidcState struct {
+	Nonce      string `json:"nonce"`
+	Verifier   string `json:"verifier"`
+	LinkUserId int    `json:"link_user_id"`
+	Binding    string `json:"binding"`
+}
+
+// OidcAuthorization is a started authorization code flow, the callback only accepts it from a browser
+// holding Binding in its cookie.
+type OidcAuthorization struct {
+	Url     string
+	Binding string
+}
+
+type OidcLinkResponse struct {
+	Url string `json:"url"`
+}
@@ -0,0 +1,82 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleMember = "member"
+	OrgRoleViewer = "viewer"
+
+	// PersonalDomain is the Casbin domain of requests made outside of an organization.
+	PersonalDomain = "personal"
+)
+
+// OrganizationDomain is the Casbin domain of the requests made in the organization.
+func OrganizationDomain(id int) string {
+	return fmt.Sprintf("org:%d", id)
+}
+
+// OrganizationSubject is the Casbin subject holding the permissions of an organization role.
+func OrganizationSubject(role string) string {
+	return fmt.Sprintf("org:%s", role)
+}
+
+type Organization struct {
+	Id        int
+	Name      string
+	CreatedBy int
+	Role      string
+	CreatedAt time.Time
+}
+
+type Member struct {
+	OrganizationId int
+	UserId         int
+	Username       string
+	Role           string
+	CreatedAt      time.Time
+	// Deleted is set once the organization is deleted, its notes are then only served as tombstones by sync.
+	Deleted bool
+}
+
+type OrganizationRequest struct {
+	Name string `json:"name" validate:"required,max=120"`
+}
+
+type MemberRequest struct {
+	Username string `json:"username" validate:"required"`
+	Role     string `json:"role" validate:"required,oneof=owner member viewer"`
+}
+
+type MemberRoleRequest struct {
+	Role string `json:"role" validate:"required,oneof=owner member viewer"`
+}
+
+type OrganizationResponse struct {
+	Id        int       `json:"id"`
+	Name      string    `json:"name"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func NewOrganizationResponse(o Organization) *OrganizationResponse {
+	return &OrganizationResponse{Id: o.Id, Name: o.Name, Role: o.Role, CreatedAt: o.CreatedAt}
+}
+
+type MemberResponse struct {
+	UserId    int       `json:"user_id"`
+	Username  string    `json:"username"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func NewMemberResponse(m Member) *MemberResponse {
+	return &MemberResponse{UserId: m.UserId, Username: m.Username, Role: m.Role, CreatedAt: m.CreatedAt}
+}
+
+type OrganizationTokenResponse struct {
+	Token string `json:"token"`
+}
@@ -0,0 +1,41 @@
+package model
+
+import "time"
+
+const (
+	PolicyActionAdd    = "add"
+	PolicyActionRemove = "remove"
+)
+
+type PolicyRequest struct {
+	PType string   `json:"p_type" validate:"required,oneof=p g"`
+	Rule  []string `json:"rule" validate:"required,min=1,dive,required"`
+}
+
+type PolicyResponse struct {
+	PType string   `json:"p_type"`
+	Rule  []string `json:"rule"`
+}
+
+// PolicyTestRequest evaluates a request in the personal domain unless Domain names an organization such as org:1.
+type PolicyTestRequest struct {
+	Subject string `json:"subject" validate:"required"`
+	Domain  string `json:"domain"`
+	Path    string `json:"path" validate:"required"`
+	Method  string `json:"method" validate:"required"`
+}
+
+type PolicyTestResponse struct {
+	Allowed bool     `json:"allowed"`
+	Matched []string `json:"matched"`
+}
+
+// PolicyAudit records a policy change, UserId is nil once the user who made it has been erased.
+type PolicyAudit struct {
+	Id        int       `json:"id"`
+	UserId    *int      `json:"user_id"`
+	Action    string    `json:"action"`
+	PType     string    `json:"p_type"`
+	Rule      []string  `json:"rule"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,54 @@
+package model
+
+import "time"
+
+// ExportProfile is the profile part of the account export.
+type ExportProfile struct {
+	Id          int    `json:"id"`
+	FirstName   string `json:"first_name"`
+	LastName    string `json:"last_name"`
+	Email       string `json:"email"`
+	Username    string `json:"username"`
+	Role        string `json:"role"`
+	IsVerified  bool   `json:"is_verified"`
+	IsActive    bool   `json:"is_active"`
+	TotpEnabled bool   `json:"totp_enabled"`
+}
+
+type ExportNote struct {
+	Id        int       `json:"id"`
+	Type      string    `json:"type"`
+	Title     string    `json:"title"`
+	Body      string    `json:"body"`
+	Secret    string    `json:"secret"`
+	IsActive  bool      `json:"is_active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ExportMedia describes a media file, the file itself is written next to the listing in the archive.
+type ExportMedia struct {
+	Id        int       `json:"id"`
+	MimeType  string    `json:"mime_type"`
+	File      string    `json:"file"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Erasure is an account whose grace period ended and is waiting to be erased.
+type Erasure struct {
+	UserId   int
+	Username string
+}
+
+type ErasureResponse struct {
+	EraseAt time.Time `json:"erase_at"`
+}
+
+// AccountExport is everything written to the export archive except the content of the media files.
+type AccountExport struct {
+	Profile    *ExportProfile
+	Notes      []ExportNote
+	Media      []ExportMedia
+	Audit      []PolicyAudit
+	Deliveries []*WebhookDeliveryResponse
+}
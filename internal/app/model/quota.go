@@ -0,0 +1,31 @@
+package model
+
+// Quota holds the effective limits of a user, a zero limit means unlimited.
+type Quota struct {
+	UserId        int
+	MaxNotes      int
+	MaxBodySize   int
+	MaxMediaBytes int64
+	IsOverride    bool
+}
+
+type QuotaRequest struct {
+	MaxNotes      *int   `json:"max_notes" validate:"omitempty,min=0"`
+	MaxBodySize   *int   `json:"max_body_size" validate:"omitempty,min=0"`
+	MaxMediaBytes *int64 `json:"max_media_bytes" validate:"omitempty,min=0"`
+}
+
+type QuotaResponse struct {
+	UserId         int   `json:"user_id"`
+	MaxNotes       int   `json:"max_notes"`
+	MaxBodySize    int   `json:"max_body_size"`
+	MaxMediaBytes  int64 `json:"max_media_bytes"`
+	UsedNotes      int   `json:"used_notes"`
+	UsedMediaBytes int64 `json:"used_media_bytes"`
+	IsOverride     bool  `json:"is_override"`
+}
+
+func NewQuotaResponse(quota Quota, usedNotes int, usedMediaBytes int64) *QuotaResponse {
+	return &QuotaResponse{UserId: quota.UserId, MaxNotes: quota.MaxNotes, MaxBodySize: quota.MaxBodySize,
+		MaxMediaBytes: quota.MaxMediaBytes, UsedNotes: usedNotes, UsedMediaBytes: usedMediaBytes, IsOverride: quota.IsOverride}
+}
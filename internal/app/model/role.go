@@ -0,0 +1,35 @@
+package model
+
+// Built-in roles seeded by the migrations, they can not be renamed or deleted.
+const (
+	RoleUserId    = 1
+	RoleAdminId   = 2
+	RoleUserName  = "user"
+	RoleAdminName = "admin"
+)
+
+type Role struct {
+	Id       int
+	Name     string
+	IsActive bool
+	Users    int
+}
+
+type RoleRequest struct {
+	Name string `json:"name" validate:"required,alphanum,lowercase,max=64"`
+}
+
+type AssignRoleRequest struct {
+	RoleId int `json:"role_id" validate:"required,min=1"`
+}
+
+type RoleResponse struct {
+	Id       int    `json:"id"`
+	Name     string `json:"name"`
+	IsActive bool   `json:"is_active"`
+	Users    int    `json:"users"`
+}
+
+func NewRoleResponse(role Role) *RoleResponse {
+	return &RoleResponse{Id: role.Id, Name: role.Name, IsActive: role.IsActive, Users: role.Users}
+}
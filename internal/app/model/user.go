@@ -1,17 +1,20 @@
 package model
 
 type User struct {
-	Id         int
-	FirstName  string
-	LastName   string
-	Email      string
-	Username   string
-	Password   string
-	Photo      string
-	MediaId    int
-	Role       int
-	IsVerified bool
-	IsActive   bool
+	Id          int
+	FirstName   string
+	LastName    string
+	Email       string
+	Username    string
+	Password    string
+	Photo       string
+	MediaId     int
+	Role        int
+	RoleName    string
+	IsVerified  bool
+	IsActive    bool
+	TotpSecret  string
+	TotpEnabled bool
 }
 
 func NewUser(id int, firstName string, lastName string, email string, username string, password string, photo string, role int) *User {
@@ -19,28 +22,74 @@ func NewUser(id int, firstName string, lastName string, email string, username s
 }
 
 type UserRequest struct {
+	FirstName       string `json:"first_name" validate:"required"`
+	LastName        string `json:"last_name" validate:"required"`
+	Email           string `json:"email" validate:"required,email"`
+	Username        string `json:"username" validate:"required,alphanum,max=128"`
+	Password        string `json:"password" validate:"required,min=6,max=128"`
+	Photo           string `json:"photo"`
+	InvitationToken string `json:"invitation_token"`
+}
+
+type UpdateUserRequest struct {
 	FirstName string `json:"first_name" validate:"required"`
 	LastName  string `json:"last_name" validate:"required"`
 	Email     string `json:"email" validate:"required,email"`
 	Username  string `json:"username" validate:"required,alphanum,max=128"`
-	Password  string `json:"password" validate:"required,min=6,max=128"`
-	Photo     string `json:"photo"`
+}
+
+type ProfileRequest struct {
+	FirstName string `json:"first_name" validate:"required"`
+	LastName  string `json:"last_name" validate:"required"`
+	Email     string `json:"email" validate:"required,email"`
+}
+
+// EmailChange is a requested email address waiting for the code mailed to it.
+type EmailChange struct {
+	Email     string
+	CodeHash  string
+	ExpiresAt int64
+	Attempts  int64
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required,min=6,max=128,nefield=CurrentPassword"`
 }
 
 type UserResponse struct {
-	Id        int    `json:"id_user"`
-	FirstName string `json:"first_name"`
-	LastName  string `json:"last_name"`
-	Email     string `json:"email"`
-	Username  string `json:"username"`
-	Password  string `json:"password"`
-	Photo     string `json:"photo"`
-	Role      string `json:"role"`
-	Token     string `json:"token,omitempty"`
+	Id           int    `json:"id_user"`
+	FirstName    string `json:"first_name"`
+	LastName     string `json:"last_name"`
+	Email        string `json:"email"`
+	PendingEmail string `json:"pending_email,omitempty"`
+	Username     string `json:"username"`
+	Photo        string `json:"photo"`
+	Role         string `json:"role"`
+	Token        string `json:"token,omitempty"`
 }
 
-func NewUserResponse(id int, firstName string, lastName string, email string, username string, password string, photo string, role string, token string) *UserResponse {
-	return &UserResponse{Id: id, FirstName: firstName, LastName: lastName, Email: email, Username: username, Password: password, Photo: photo, Role: role, Token: token}
+func NewUserResponse(id int, firstName string, lastName string, email string, username string, photo string, role string, token string) *UserResponse {
+	return &UserResponse{Id: id, FirstName: firstName, LastName: lastName, Email: email, Username: username, Photo: photo, Role: role, Token: token}
+}
+
+// UserFilter narrows the admin user listing, nil flags match both values and Query searches names, email and username.
+type UserFilter struct {
+	Query    string
+	RoleId   int
+	Verified *bool
+	Active   *bool
+	Sort     string
+	Desc     bool
+	Page     int
+	PerPage  int
+}
+
+type UserListResponse struct {
+	Users   []*UserResponse `json:"users"`
+	Total   int             `json:"total"`
+	Page    int             `json:"page"`
+	PerPage int             `json:"per_page"`
 }
 
 type LoginRequest struct {
@@ -49,25 +98,76 @@ type LoginRequest struct {
 }
 
 type LoginResponse struct {
-	Username string `json:"username"`
-	Token    string `json:"token"`
+	Username       string `json:"username"`
+	Token          string `json:"token,omitempty"`
+	RefreshToken   string `json:"refresh_token,omitempty"`
+	TwoFactor      bool   `json:"two_factor,omitempty"`
+	ChallengeToken string `json:"challenge_token,omitempty"`
 }
 
 func NewLoginResponse(username string, token string) *LoginResponse {
 	return &LoginResponse{Username: username, Token: token}
 }
 
+// RefreshToken is the server side state of an opaque refresh token, every rotation of a login shares the same family.
+type RefreshToken struct {
+	UserId   int    `json:"user_id"`
+	Username string `json:"username"`
+	Family   string `json:"family"`
+	IssuedAt int64  `json:"issued_at"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
 type Session struct {
-	UserId     int    `json:"user_id"`
-	Username   string `json:"username"`
-	Email      string `json:"email"`
-	Code       int    `json:"code"`
-	RoleId     int    `json:"role_id"`
-	IsVerified bool   `json:"is_verified"`
-	IsSent     bool   `json:"is_sent"`
-	IsActive   bool   `json:"is_active"`
+	UserId         int    `json:"user_id"`
+	SessionId      string `json:"session_id,omitempty"`
+	OrganizationId int    `json:"organization_id,omitempty"`
+	Username       string `json:"username"`
+	Email          string `json:"email"`
+	Code           int    `json:"code"`
+	CodeExpiresAt  int64  `json:"code_expires_at"`
+	LinkToken      string `json:"link_token,omitempty"`
+	RoleId         int    `json:"role_id"`
+	IsVerified     bool   `json:"is_verified"`
+	IsSent         bool   `json:"is_sent"`
+	IsActive       bool   `json:"is_active"`
 }
 
 type VerifyRequest struct {
-	Code int `json:"code" validate: "required"`
+	Code int `json:"code" validate:"required"`
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=6,max=128"`
+}
+
+type TwoFactorEnrollResponse struct {
+	Secret        string   `json:"secret"`
+	Uri           string   `json:"uri"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type TwoFactorRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	Code           string `json:"code" validate:"required"`
 }
@@ -0,0 +1,101 @@
+package model
+
+import "time"
+
+const (
+	EventNoteCreated      = "note.created"
+	EventNoteUpdated      = "note.updated"
+	EventNoteDeleted      = "note.deleted"
+	EventUserVerified     = "user.verified"
+	EventUserDeactivated  = "user.deactivated"
+	DeliveryStatusPending = "pending"
+	DeliveryStatusSuccess = "delivered"
+	DeliveryStatusFailed  = "failed"
+)
+
+type Webhook struct {
+	Id        int
+	UserId    int
+	Url       string
+	Secret    string
+	Events    []string
+	IsActive  bool
+	CreatedAt time.Time
+}
+
+func NewWebhook(id int, userId int, url string, secret string, events []string) *Webhook {
+	return &Webhook{Id: id, UserId: userId, Url: url, Secret: secret, Events: events, IsActive: true}
+}
+
+type WebhookRequest struct {
+	Url    string   `json:"url" validate:"required,url"`
+	Events []string `json:"events" validate:"required,min=1,dive,oneof=note.created note.updated note.deleted user.verified user.deactivated"`
+}
+
+type WebhookResponse struct {
+	Id        int       `json:"id"`
+	Url       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"secret,omitempty"`
+	IsActive  bool      `json:"is_active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func NewWebhookResponse(id int, url string, events []string, secret string, isActive bool, createdAt time.Time) *WebhookResponse {
+	return &WebhookResponse{Id: id, Url: url, Events: events, Secret: secret, IsActive: isActive, CreatedAt: createdAt}
+}
+
+type WebhookDelivery struct {
+	Id            int
+	WebhookId     int
+	Url           string
+	Secret        string
+	Event         string
+	Payload       string
+	Status        string
+	Attempts      int
+	ResponseCode  int
+	LastError     string
+	NextAttemptAt time.Time
+	DeliveredAt   *time.Time
+	CreatedAt     time.Time
+}
+
+type WebhookDeliveryResponse struct {
+	Id            int        `json:"id"`
+	WebhookId     int        `json:"webhook_id"`
+	Event         string     `json:"event"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	ResponseCode  int        `json:"response_code"`
+	LastError     string     `json:"last_error,omitempty"`
+	NextAttemptAt time.Time  `json:"next_attempt_at"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+func NewWebhookDeliveryResponse(d WebhookDelivery) *WebhookDeliveryResponse {
+	return &WebhookDeliveryResponse{Id: d.Id, WebhookId: d.WebhookId, Event: d.Event, Status: d.Status, Attempts: d.Attempts,
+		ResponseCode: d.ResponseCode, LastError: d.LastError, NextAttemptAt: d.NextAttemptAt, DeliveredAt: d.DeliveredAt, CreatedAt: d.CreatedAt}
+}
+
+// WebhookEvent is the envelope posted to every subscribed endpoint.
+type WebhookEvent struct {
+	Event     string      `json:"event"`
+	UserId    int         `json:"user_id"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+type NotesPayload struct {
+	Id     int    `json:"id"`
+	UserId int    `json:"user_id"`
+	Type   string `json:"type,omitempty"`
+	Title  string `json:"title,omitempty"`
+	Body   string `json:"body,omitempty"`
+}
+
+type UserPayload struct {
+	Id       int    `json:"id"`
+	Username string `json:"username,omitempty"`
+}
@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"refactory/notes/internal/app"
+	"refactory/notes/internal/app/model"
+)
+
+type AccessTokenRepository interface {
+	InsertAccessToken(ctx context.Context, accessToken *model.AccessToken) error
+	ListAccessToken(ctx context.Context, userId int) ([]model.AccessToken, error)
+	RevokeAccessToken(ctx context.Context, userId int, id int) error
+	UseAccessToken(ctx context.Context, hash string) (model.AccessToken, error)
+}
+
+type accessTokenRepository struct {
+	db *sqlx.DB
+}
+
+func NewAccessTokenRepository(db *sqlx.DB) AccessTokenRepository {
+	return &accessTokenRepository{db: db}
+}
+
+func (a *accessTokenRepository) InsertAccessToken(ctx context.Context, accessToken *model.AccessToken) error {
+	if err := a.db.QueryRowContext(ctx, `INSERT INTO notes.access_tokens (user_id, name, token_hash, scopes, expires_at)
+								VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at`,
+		accessToken.UserId, accessToken.Name, accessToken.Hash, pq.Array(accessToken.Scopes), accessToken.ExpiresAt).
+		Scan(&accessToken.Id, &accessToken.CreatedAt); nil != err {
+		return errors.Wrap(err, "[db] InsertAccessToken - insert data")
+	}
+
+	return nil
+}
+
+func (a *accessTokenRepository) ListAccessToken(ctx context.Context, userId int) ([]model.AccessToken, error) {
+	var result []model.AccessToken
+
+	rows, err := a.db.QueryContext(ctx, `SELECT id, user_id, name, scopes, expires_at, last_used_at, created_at FROM notes.access_tokens
+								WHERE user_id=$1 AND revoked_at IS NULL ORDER BY id`, userId)
+	if nil != err {
+		return nil, errors.Wrap(err, "[db] ListAccessToken - query")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var accessToken model.AccessToken
+		if err := rows.Scan(&accessToken.Id, &accessToken.UserId, &accessToken.Name, pq.Array(&accessToken.Scopes),
+			&accessToken.ExpiresAt, &accessToken.LastUsedAt, &accessToken.CreatedAt); nil != err {
+			return nil, errors.Wrap(err, "[db] ListAccessToken - scan")
+		}
+		result = append(result, accessToken)
+	}
+
+	return result, nil
+}
+
+func (a *accessTokenRepository) RevokeAccessToken(ctx context.Context, userId int, id int) error {
+	rs, err := a.db.ExecContext(ctx, `UPDATE notes.access_tokens SET revoked_at=now() WHERE id=$1 AND user_id=$2 AND revoked_at IS NULL`, id, userId)
+	if nil != err {
+		return errors.Wrap(err, "[db] RevokeAccessToken - exec query")
+	}
+
+	revoked, _ := rs.RowsAffected()
+	if revoked == 0 {
+		return app.NotFoundError
+	}
+
+	return nil
+}
+
+// UseAccessToken finds the active token of an active user by its hash and records its usage.
+func (a *accessTokenRepository) UseAccessToken(ctx context.Context, hash string) (model.AccessToken, error) {
+	var result model.AccessToken
+
+	err := a.db.QueryRowContext(ctx, `UPDATE notes.access_tokens t SET last_used_at=now() FROM notes."user" u
+								WHERE t.token_hash=$1 AND u.id=t.user_id AND u.is_active AND t.revoked_at IS NULL
+								AND (t.expires_at IS NULL OR t.expires_at > now())
+								RETURNING t.id, t.user_id, u.username, u.role_id, t.name, t.scopes, t.expires_at, t.created_at`, hash).
+		Scan(&result.Id, &result.UserId, &result.Username, &result.RoleId, &result.Name, pq.Array(&result.Scopes),
+			&result.ExpiresAt, &result.CreatedAt)
+	if nil != err {
+		if sql.ErrNoRows == err {
+			return result, app.UnauthenticateError
+		}
+		return result, errors.Wrap(err, "[db] UseAccessToken - query")
+	}
+
+	return result, nil
+}
@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	redisv8 "github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+	"refactory/notes/internal/app"
+	"refactory/notes/internal/app/model"
+	"refactory/notes/internal/config"
+	"refactory/notes/internal/security/token"
+	"sort"
+	"time"
+)
+
+func devicesKey(userId int) string {
+	return fmt.Sprintf("devices:%d", userId)
+}
+
+// SaveDevice stores the device session in the hash of the user, the hash lives as long as the newest refresh token.
+func (u *userRepository) SaveDevice(ctx context.Context, userId int, device model.Device) error {
+	value, err := json.Marshal(device)
+	if nil != err {
+		return err
+	}
+
+	if _, err := u.cache.Conn().TxPipelined(ctx, func(pipe redisv8.Pipeliner) error {
+		pipe.HSet(ctx, devicesKey(userId), device.Id, value)
+		pipe.Expire(ctx, devicesKey(userId), config.Cfg().RefreshTokenTTL)
+		return nil
+	}); nil != err {
+		return errors.Wrap(err, "[rdr] SaveDevice - save to cache")
+	}
+
+	return nil
+}
+
+// TouchDevice records the refresh of a device session, sessions started before devices were tracked are added on their next refresh.
+func (u *userRepository) TouchDevice(ctx context.Context, userId int, id string, client model.Client) error {
+	now := time.Now()
+	device := model.Device{Id: id, CreatedAt: now}
+
+	value, err := u.cache.Conn().HGet(ctx, devicesKey(userId), id).Result()
+	if nil != err && redisv8.Nil != err {
+		return errors.Wrap(err, "[rdr] TouchDevice - get cache")
+	}
+	if nil == err {
+		if err := json.Unmarshal([]byte(value), &device); nil != err {
+			return errors.Wrap(err, "[rdr] TouchDevice - decode device")
+		}
+	}
+
+	device.Ip = client.Ip
+	device.UserAgent = client.UserAgent
+	device.LastSeenAt = now
+
+	return u.SaveDevice(ctx, userId, device)
+}
+
+// ListDevice returns the device sessions of the user, most recently seen first.
+// Sessions idle for longer than a refresh token lives can not come back and are dropped.
+func (u *userRepository) ListDevice(ctx context.Context, userId int) ([]model.Device, error) {
+	var result []model.Device
+
+	values, err := u.cache.Conn().HGetAll(ctx, devicesKey(userId)).Result()
+	if nil != err {
+		return nil, errors.Wrap(err, "[rdr] ListDevice - get cache")
+	}
+
+	var expired []string
+	for id, value := range values {
+		var device model.Device
+		if err := json.Unmarshal([]byte(value), &device); nil != err {
+			return nil, errors.Wrap(err, "[rdr] ListDevice - decode device")
+		}
+		if time.Since(device.LastSeenAt) > config.Cfg().RefreshTokenTTL {
+			expired = append(expired, id)
+			continue
+		}
+		result = append(result, device)
+	}
+
+	if len(expired) > 0 {
+		if err := u.cache.Conn().HDel(ctx, devicesKey(userId), expired...).Err(); nil != err {
+			return nil, errors.Wrap(err, "[rdr] ListDevice - delete cache")
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].LastSeenAt.After(result[j].LastSeenAt)
+	})
+
+	return result, nil
+}
+
+// RevokeDevice removes the device session and revokes its refresh token family, which rejects its access tokens as well.
+func (u *userRepository) RevokeDevice(ctx context.Context, userId int, id string) error {
+	removed, err := u.cache.Conn().HDel(ctx, devicesKey(userId), id).Result()
+	if nil != err {
+		return errors.Wrap(err, "[rdr] RevokeDevice - delete cache")
+	}
+	if removed == 0 {
+		return app.NotFoundError
+	}
+
+	if err := u.cache.Conn().Set(ctx, token.FamilyRevokedKey(id), 1, config.Cfg().RefreshTokenTTL).Err(); nil != err {
+		return errors.Wrap(err, "[rdr] RevokeDevice - save to cache")
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	redisv8 "github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+	"refactory/notes/internal/app"
+	"refactory/notes/internal/app/model"
+	"strconv"
+	"time"
+)
+
+func emailChangeKey(userId int) string {
+	return fmt.Sprintf("email:change:%d", userId)
+}
+
+// SaveEmailChange replaces any pending email change of the user, it is dropped once the code expires.
+func (u *userRepository) SaveEmailChange(ctx context.Context, userId int, change model.EmailChange, ttl time.Duration) error {
+	if _, err := u.cache.Conn().TxPipelined(ctx, func(pipe redisv8.Pipeliner) error {
+		pipe.Del(ctx, emailChangeKey(userId))
+		pipe.HSet(ctx, emailChangeKey(userId), "email", change.Email, "code", change.CodeHash, "expires_at", change.ExpiresAt, "attempts", 0)
+		pipe.Expire(ctx, emailChangeKey(userId), ttl)
+		return nil
+	}); nil != err {
+		return errors.Wrap(err, "[rdr] SaveEmailChange - save to cache")
+	}
+
+	return nil
+}
+
+func (u *userRepository) FindEmailChange(ctx context.Context, userId int) (model.EmailChange, error) {
+	var result model.EmailChange
+
+	values, err := u.cache.Conn().HGetAll(ctx, emailChangeKey(userId)).Result()
+	if nil != err {
+		return result, errors.Wrap(err, "[rdr] FindEmailChange - get cache")
+	}
+	// a hash without the email is what a failed attempt leaves behind when it races the expiry
+	if values["email"] == "" {
+		return result, app.NotFoundError
+	}
+
+	result.Email = values["email"]
+	result.CodeHash = values["code"]
+	result.ExpiresAt, _ = strconv.ParseInt(values["expires_at"], 10, 64)
+	result.Attempts, _ = strconv.ParseInt(values["attempts"], 10, 64)
+
+	return result, nil
+}
+
+// FailEmailChange counts a wrong confirmation code and returns the attempts made so far.
+func (u *userRepository) FailEmailChange(ctx context.Context, userId int) (int64, error) {
+	attempts, err := u.cache.Conn().HIncrBy(ctx, emailChangeKey(userId), "attempts", 1).Result()
+	if nil != err {
+		return 0, errors.Wrap(err, "[rdr] FailEmailChange - save to cache")
+	}
+
+	return attempts, nil
+}
+
+func (u *userRepository) DeleteEmailChange(ctx context.Context, userId int) error {
+	deleted, err := u.cache.Conn().Del(ctx, emailChangeKey(userId)).Result()
+	if nil != err {
+		return errors.Wrap(err, "[rdr] DeleteEmailChange - delete cache")
+	}
+	if deleted == 0 {
+		return app.NotFoundError
+	}
+
+	return nil
+}
+
+func (u *userRepository) UpdateEmail(ctx context.Context, userId int, email string) error {
+	rs, err := u.db.ExecContext(ctx, `UPDATE notes."user" SET email=$2 WHERE id=$1 AND is_active`, userId, email)
+	if nil != err {
+		return errors.Wrap(err, "[db] UpdateEmail - update data")
+	}
+	if updated, _ := rs.RowsAffected(); updated == 0 {
+		return app.NotFoundError
+	}
+
+	return nil
+}
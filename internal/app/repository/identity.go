@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/casbin/casbin/v2"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"refactory/notes/internal/app"
+	"refactory/notes/internal/app/model"
+	"refactory/notes/internal/db/redis"
+	"time"
+)
+
+type IdentityRepository interface {
+	SaveOidcState(ctx context.Context, state string, oidcState model.OidcState, ttl time.Duration) error
+	ConsumeOidcState(ctx context.Context, state string) (model.OidcState, error)
+	FindIdentity(ctx context.Context, issuer string, subject string) (*model.User, error)
+	LinkIdentity(ctx context.Context, userId int, issuer string, subject string, email string) error
+	ProvisionUser(ctx context.Context, user *model.User, issuer string, subject string) error
+}
+
+type identityRepository struct {
+	db       *sqlx.DB
+	cache    redis.Client
+	enforcer *casbin.SyncedEnforcer
+}
+
+func NewIdentityRepository(db *sqlx.DB, cache redis.Client, enforcer *casbin.SyncedEnforcer) IdentityRepository {
+	return &identityRepository{db: db, cache: cache, enforcer: enforcer}
+}
+
+func (i *identityRepository) SaveOidcState(ctx context.Context, state string, oidcState model.OidcState, ttl time.Duration) error {
+	value, err := json.Marshal(oidcState)
+	if nil != err {
+		return err
+	}
+
+	if err := i.cache.Conn().Set(ctx, fmt.Sprintf("oidc:state:%s", state), value, ttl).Err(); nil != err {
+		return errors.Wrap(err, "[rdr] SaveOidcState - save to cache")
+	}
+
+	return nil
+}
+
+// ConsumeOidcState returns the state of an authorization request and removes it, so every callback can only be used once.
+func (i *identityRepository) ConsumeOidcState(ctx context.Context, state string) (model.OidcState, error) {
+	var result model.OidcState
+
+	value, err := consume(ctx, i.cache, fmt.Sprintf("oidc:state:%s", state))
+	if nil != err {
+		return result, errors.Wrap(err, "[rdr] ConsumeOidcState - get cache")
+	}
+	if err := json.Unmarshal([]byte(value), &result); nil != err {
+		return result, errors.Wrap(err, "[rdr] ConsumeOidcState - decode state")
+	}
+
+	return result, nil
+}
+
+func (i *identityRepository) FindIdentity(ctx context.Context, issuer string, subject string) (*model.User, error) {
+	var result model.User
+
+	err := i.db.QueryRowContext(ctx, `SELECT u.id, u.first_name, u.last_name, u.email, u.username, u.is_verified, u.role_id, r.name, u.is_active,
+								coalesce(u.totp_enabled, false)
+								FROM notes.user_identities i JOIN notes."user" u ON u.id = i.user_id JOIN notes.roles r ON r.id = u.role_id
+								WHERE i.issuer=$1 AND i.subject=$2`, issuer, subject).
+		Scan(&result.Id, &result.FirstName, &result.LastName, &result.Email, &result.Username, &result.IsVerified,
+			&result.Role, &result.RoleName, &result.IsActive, &result.TotpEnabled)
+	if nil != err {
+		if sql.ErrNoRows == err {
+			return nil, app.NotFoundError
+		}
+		return nil, errors.Wrap(err, "[db] FindIdentity - query")
+	}
+
+	return &result, nil
+}
+
+func (i *identityRepository) LinkIdentity(ctx context.Context, userId int, issuer string, subject string, email string) error {
+	if _, err := i.db.ExecContext(ctx, `INSERT INTO notes.user_identities (user_id, issuer, subject, email) VALUES ($1, $2, $3, $4)`,
+		userId, issuer, subject, email); nil != err {
+		if vErr, ok := err.(*pq.Error); ok && vErr.Code == "23505" {
+			return app.DuplicateError
+		}
+		return errors.Wrap(err, "[db] LinkIdentity - insert data")
+	}
+
+	return nil
+}
+
+// ProvisionUser creates a verified user without a password for an identity seen for the first time,
+// a taken username is reported as app.DuplicateError.
+func (i *identityRepository) ProvisionUser(ctx context.Context, user *model.User, issuer string, subject string) error {
+	tx, err := i.db.BeginTxx(ctx, nil)
+	if nil != err {
+		return errors.Wrap(err, "[db] ProvisionUser - begin transaction")
+	}
+	defer tx.Rollback()
+
+	if err := tx.QueryRowContext(ctx, `INSERT INTO notes."user" (first_name, last_name, email, password, username, role_id, is_verified)
+								VALUES ($1, $2, $3, '', $4, $5, true) RETURNING id, (SELECT name FROM notes.roles WHERE id=$5)`,
+		user.FirstName, user.LastName, user.Email, user.Username, user.Role).Scan(&user.Id, &user.RoleName); nil != err {
+		if vErr, ok := err.(*pq.Error); ok && vErr.Code == "23505" {
+			return app.DuplicateError
+		}
+		return errors.Wrap(err, "[db] ProvisionUser - insert user")
+	}
+
+	if _, err := tx.ExecContext(ctx, `INSERT INTO notes.user_identities (user_id, issuer, subject, email) VALUES ($1, $2, $3, $4)`,
+		user.Id, issuer, subject, user.Email); nil != err {
+		return errors.Wrap(err, "[db] ProvisionUser - insert identity")
+	}
+
+	if err := tx.Commit(); nil != err {
+		return errors.Wrap(err, "[db] ProvisionUser - commit")
+	}
+	user.IsVerified = true
+	user.IsActive = true
+
+	return syncRole(i.enforcer, user.Username, user.RoleName)
+}
@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"refactory/notes/internal/app"
+	"refactory/notes/internal/app/model"
+)
+
+type ImpersonationRepository interface {
+	InsertImpersonation(ctx context.Context, impersonation *model.Impersonation) error
+	EndImpersonation(ctx context.Context, id int) (*model.Impersonation, error)
+	RecordImpersonation(ctx context.Context, impersonationId int, method string, path string, status int) error
+	ListImpersonation(ctx context.Context, userId int, limit int) ([]model.Impersonation, error)
+}
+
+type impersonationRepository struct {
+	db *sqlx.DB
+}
+
+func NewImpersonationRepository(db *sqlx.DB) ImpersonationRepository {
+	return &impersonationRepository{db: db}
+}
+
+func (i *impersonationRepository) InsertImpersonation(ctx context.Context, impersonation *model.Impersonation) error {
+	if err := i.db.QueryRowContext(ctx, `INSERT INTO notes.impersonations (admin_id, user_id, reason, jti, expires_at)
+								VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at`,
+		impersonation.AdminId, impersonation.UserId, impersonation.Reason, impersonation.Jti, impersonation.ExpiresAt).
+		Scan(&impersonation.Id, &impersonation.CreatedAt); nil != err {
+		return errors.Wrap(err, "[db] InsertImpersonation - insert data")
+	}
+
+	return nil
+}
+
+// EndImpersonation closes an impersonation still running, the caller denies its token until it expires.
+func (i *impersonationRepository) EndImpersonation(ctx context.Context, id int) (*model.Impersonation, error) {
+	var result model.Impersonation
+
+	if err := i.db.QueryRowContext(ctx, `UPDATE notes.impersonations SET ended_at=now()
+								WHERE id=$1 AND ended_at IS NULL AND expires_at > now() RETURNING id, user_id, jti, expires_at`, id).
+		Scan(&result.Id, &result.UserId, &result.Jti, &result.ExpiresAt); nil != err {
+		if sql.ErrNoRows == err {
+			return nil, app.NotFoundError
+		}
+		return nil, errors.Wrap(err, "[db] EndImpersonation - update data")
+	}
+
+	return &result, nil
+}
+
+func (i *impersonationRepository) RecordImpersonation(ctx context.Context, impersonationId int, method string, path string, status int) error {
+	if _, err := i.db.ExecContext(ctx, `INSERT INTO notes.impersonation_requests (impersonation_id, method, path, status) VALUES ($1, $2, $3, $4)`,
+		impersonationId, method, path, status); nil != err {
+		return errors.Wrap(err, "[db] RecordImpersonation - insert data")
+	}
+
+	return nil
+}
+
+// ListImpersonation returns the latest impersonations with the requests made during them, a zero user returns every user.
+func (i *impersonationRepository) ListImpersonation(ctx context.Context, userId int, limit int) ([]model.Impersonation, error) {
+	var result []model.Impersonation
+
+	rows, err := i.db.QueryContext(ctx, `SELECT i.id, coalesce(i.admin_id, 0), coalesce(a.username, ''), i.user_id, i.reason, i.expires_at, i.ended_at, i.created_at
+								FROM notes.impersonations i LEFT JOIN notes."user" a ON a.id = i.admin_id
+								WHERE i.user_id=$1 OR $1=0 ORDER BY i.id DESC LIMIT $2`, userId, limit)
+	if nil != err {
+		return nil, errors.Wrap(err, "[db] ListImpersonation - query")
+	}
+	defer rows.Close()
+
+	var ids []int64
+	index := make(map[int]int)
+	for rows.Next() {
+		var impersonation model.Impersonation
+		if err := rows.Scan(&impersonation.Id, &impersonation.AdminId, &impersonation.AdminUsername, &impersonation.UserId,
+			&impersonation.Reason, &impersonation.ExpiresAt, &impersonation.EndedAt, &impersonation.CreatedAt); nil != err {
+			return nil, errors.Wrap(err, "[db] ListImpersonation - scan")
+		}
+		index[impersonation.Id] = len(result)
+		ids = append(ids, int64(impersonation.Id))
+		result = append(result, impersonation)
+	}
+	if len(ids) == 0 {
+		return result, nil
+	}
+
+	requests, err := i.db.QueryContext(ctx, `SELECT impersonation_id, method, path, status, created_at FROM notes.impersonation_requests
+								WHERE impersonation_id = ANY($1) ORDER BY id`, pq.Array(ids))
+	if nil != err {
+		return nil, errors.Wrap(err, "[db] ListImpersonation - query requests")
+	}
+	defer requests.Close()
+
+	for requests.Next() {
+		var id int
+		var request model.ImpersonationRequest
+		if err := requests.Scan(&id, &request.Method, &request.Path, &request.Status, &request.CreatedAt); nil != err {
+			return nil, errors.Wrap(err, "[db] ListImpersonation - scan requests")
+		}
+		result[index[id]].Requests = append(result[index[id]].Requests, request)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"refactory/notes/internal/app"
+	"refactory/notes/internal/app/model"
+	"time"
+)
+
+type InvitationRepository interface {
+	InsertInvitation(ctx context.Context, invitation *model.Invitation) error
+	ListInvitation(ctx context.Context) ([]model.Invitation, error)
+	RenewInvitation(ctx context.Context, id int, hash string, expiresAt time.Time) (*model.Invitation, error)
+	RevokeInvitation(ctx context.Context, id int) error
+	ClaimInvitation(ctx context.Context, hash string, email string) (*model.Invitation, error)
+	ClaimInvitationByEmail(ctx context.Context, email string) (*model.Invitation, error)
+	ReleaseInvitation(ctx context.Context, id int) error
+}
+
+type invitationRepository struct {
+	db *sqlx.DB
+}
+
+func NewInvitationRepository(db *sqlx.DB) InvitationRepository {
+	return &invitationRepository{db: db}
+}
+
+const invitationColumns = `i.id, i.email, i.role_id, r.name, coalesce(i.invited_by, 0), i.expires_at, i.accepted_at, i.revoked_at, i.created_at`
+
+func scanInvitation(row interface{ Scan(...interface{}) error }) (*model.Invitation, error) {
+	var i model.Invitation
+	if err := row.Scan(&i.Id, &i.Email, &i.RoleId, &i.RoleName, &i.InvitedBy, &i.ExpiresAt, &i.AcceptedAt, &i.RevokedAt, &i.CreatedAt); nil != err {
+		return nil, err
+	}
+
+	return &i, nil
+}
+
+func (i *invitationRepository) InsertInvitation(ctx context.Context, invitation *model.Invitation) error {
+	if err := i.db.QueryRowContext(ctx, `INSERT INTO notes.invitations (email, role_id, token_hash, invited_by, expires_at)
+								VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at, (SELECT name FROM notes.roles WHERE id=$2)`,
+		invitation.Email, invitation.RoleId, invitation.Hash, invitation.InvitedBy, invitation.ExpiresAt).
+		Scan(&invitation.Id, &invitation.CreatedAt, &invitation.RoleName); nil != err {
+		if vErr, ok := err.(*pq.Error); ok && vErr.Code == "23503" {
+			return app.NotFoundError
+		}
+		return errors.Wrap(err, "[db] InsertInvitation - insert data")
+	}
+
+	return nil
+}
+
+func (i *invitationRepository) ListInvitation(ctx context.Context) ([]model.Invitation, error) {
+	var result []model.Invitation
+
+	rows, err := i.db.QueryContext(ctx, `SELECT `+invitationColumns+` FROM notes.invitations i JOIN notes.roles r ON r.id = i.role_id
+								ORDER BY i.id DESC`)
+	if nil != err {
+		return nil, errors.Wrap(err, "[db] ListInvitation - query")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		invitation, err := scanInvitation(rows)
+		if nil != err {
+			return nil, errors.Wrap(err, "[db] ListInvitation - scan")
+		}
+		result = append(result, *invitation)
+	}
+
+	return result, nil
+}
+
+// RenewInvitation replaces the token of an invitation that was neither accepted nor revoked, the previous link stops working.
+func (i *invitationRepository) RenewInvitation(ctx context.Context, id int, hash string, expiresAt time.Time) (*model.Invitation, error) {
+	invitation, err := scanInvitation(i.db.QueryRowContext(ctx, `UPDATE notes.invitations i SET token_hash=$2, expires_at=$3 FROM notes.roles r
+								WHERE i.id=$1 AND r.id = i.role_id AND i.accepted_at IS NULL AND i.revoked_at IS NULL
+								RETURNING `+invitationColumns, id, hash, expiresAt))
+	if nil != err {
+		if sql.ErrNoRows == err {
+			return nil, app.NotFoundError
+		}
+		return nil, errors.Wrap(err, "[db] RenewInvitation - update data")
+	}
+
+	return invitation, nil
+}
+
+func (i *invitationRepository) RevokeInvitation(ctx context.Context, id int) error {
+	rs, err := i.db.ExecContext(ctx, `UPDATE notes.invitations SET revoked_at=now() WHERE id=$1 AND accepted_at IS NULL AND revoked_at IS NULL`, id)
+	if nil != err {
+		return errors.Wrap(err, "[db] RevokeInvitation - update data")
+	}
+	if affected, _ := rs.RowsAffected(); affected == 0 {
+		return app.NotFoundError
+	}
+
+	return nil
+}
+
+// ClaimInvitation marks the pending invitation of the token as accepted, it must have been sent to the given email.
+func (i *invitationRepository) ClaimInvitation(ctx context.Context, hash string, email string) (*model.Invitation, error) {
+	invitation, err := scanInvitation(i.db.QueryRowContext(ctx, `UPDATE notes.invitations i SET accepted_at=now() FROM notes.roles r
+								WHERE i.token_hash=$1 AND lower(i.email)=lower($2) AND r.id = i.role_id
+								AND i.accepted_at IS NULL AND i.revoked_at IS NULL AND i.expires_at > now()
+								RETURNING `+invitationColumns, hash, email))
+	if nil != err {
+		if sql.ErrNoRows == err {
+			return nil, app.NotFoundError
+		}
+		return nil, errors.Wrap(err, "[db] ClaimInvitation - update data")
+	}
+
+	return invitation, nil
+}
+
+// ClaimInvitationByEmail accepts the newest pending invitation of the email, used when signing up through single sign-on.
+func (i *invitationRepository) ClaimInvitationByEmail(ctx context.Context, email string) (*model.Invitation, error) {
+	invitation, err := scanInvitation(i.db.QueryRowContext(ctx, `UPDATE notes.invitations i SET accepted_at=now() FROM notes.roles r
+								WHERE r.id = i.role_id AND i.id = (SELECT id FROM notes.invitations
+									WHERE lower(email)=lower($1) AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > now()
+									ORDER BY id DESC LIMIT 1 FOR UPDATE SKIP LOCKED)
+								RETURNING `+invitationColumns, email))
+	if nil != err {
+		if sql.ErrNoRows == err {
+			return nil, app.NotFoundError
+		}
+		return nil, errors.Wrap(err, "[db] ClaimInvitationByEmail - update data")
+	}
+
+	return invitation, nil
+}
+
+// ReleaseInvitation puts back an invitation claimed by a registration that failed afterwards.
+func (i *invitationRepository) ReleaseInvitation(ctx context.Context, id int) error {
+	if _, err := i.db.ExecContext(ctx, `UPDATE notes.invitations SET accepted_at=null WHERE id=$1`, id); nil != err {
+		return errors.Wrap(err, "[db] ReleaseInvitation - update data")
+	}
+
+	return nil
+}
@@ -9,7 +9,7 @@ import (
 )
 
 type MediaRepository interface {
-	InsertMedia(ctx context.Context, userId int, mime string, file []byte) (int, error)
+	InsertMedia(ctx context.Context, userId int, mime string, file []byte, maxBytes int64) (int, error)
 	SelectMedia(ctx context.Context, id int) (string, []byte, error)
 }
 
@@ -21,14 +21,33 @@ func NewMediaRepository(db *sqlx.DB) MediaRepository {
 	return &mediaRepository{db: db}
 }
 
-func (m *mediaRepository) InsertMedia(ctx context.Context, userId int, mime string, file []byte) (int, error) {
+// InsertMedia stores the file as the picture of the user unless their media would exceed maxBytes, a zero maxBytes
+// means unlimited. The usage is summed under a lock of the user so that concurrent uploads cannot exceed it together.
+func (m *mediaRepository) InsertMedia(ctx context.Context, userId int, mime string, file []byte, maxBytes int64) (int, error) {
 	var mediaId int
-	tx, err := m.db.Begin()
+	tx, err := m.db.BeginTxx(ctx, nil)
 	if nil != err {
 		return 0, errors.Wrap(err, "[db] InsertMedia - begin transaction")
 	}
 
-	rows := tx.QueryRow(`INSERT INTO notes.media(mime_type, file) VALUES ($1, $2) RETURNING id`, mime, file)
+	if maxBytes > 0 {
+		if err := lockQuota(ctx, tx, userId); nil != err {
+			tx.Rollback()
+			return 0, err
+		}
+
+		var used int64
+		if err := tx.QueryRowContext(ctx, `SELECT coalesce(sum(octet_length(file)), 0) FROM notes.media WHERE user_id=$1`, userId).Scan(&used); nil != err {
+			tx.Rollback()
+			return 0, errors.Wrap(err, "[db] InsertMedia - sum usage")
+		}
+		if used+int64(len(file)) > maxBytes {
+			tx.Rollback()
+			return 0, app.QuotaExceededError
+		}
+	}
+
+	rows := tx.QueryRow(`INSERT INTO notes.media(user_id, mime_type, file) VALUES ($1, $2, $3) RETURNING id`, userId, mime, file)
 	if rows.Err() != nil {
 		return 0, errors.Wrap(err, "[db] InsertMedia - insert media file")
 	}
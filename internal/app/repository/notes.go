@@ -4,52 +4,81 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"github.com/go-redis/cache/v8"
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
 	"refactory/notes/internal/app"
 	"refactory/notes/internal/app/model"
+	"refactory/notes/internal/config"
+	"refactory/notes/internal/db/redis"
 )
 
 type NotesRepository interface {
-	InsertNotes(ctx context.Context, notes *model.Notes) error
-	GetNotes(ctx context.Context, userId int, roleId int) ([]model.Notes, error)
-	DetailNotes(ctx context.Context, userId int, id int, roleId int) (model.Notes, error)
-	GetSecret(ctx context.Context, id int) (string, error)
+	InsertNotes(ctx context.Context, notes *model.Notes, maxNotes int) error
+	GetNotes(ctx context.Context, userId int, orgId int, roleId int) ([]model.Notes, error)
+	DetailNotes(ctx context.Context, userId int, orgId int, id int, roleId int) (model.Notes, error)
+	GetSecret(ctx context.Context, orgId int, id int) (string, error)
 	UpdateNotes(ctx context.Context, notes *model.Notes) error
-	DeleteNotes(ctx context.Context, userId int, id int) error
+	DeleteNotes(ctx context.Context, userId int, orgId int, id int) error
 	ReActiveNotes(ctx context.Context, id int) error
+	NotesStats(ctx context.Context, userId int, orgId int, days int) (model.NotesStats, error)
+	ChangedNotes(ctx context.Context, userId int, orgId int, since model.ChangeCursor, limit int) ([]model.Notes, error)
 }
 
+// statsScope filters the stats by organization, by the personal notes of a user or not at all, $1 is the user and $2 the organization.
+const statsScope = `(CASE WHEN $2 > 0 THEN organization_id=$2 WHEN $1 > 0 THEN user_id=$1 AND organization_id IS NULL ELSE true END)`
+
 type notesRepository struct {
-	db *sqlx.DB
+	db    *sqlx.DB
+	cache redis.Client
 }
 
-func NewNotesRepository(db *sqlx.DB) NotesRepository {
-	return &notesRepository{db: db}
+func NewNotesRepository(db *sqlx.DB, cache redis.Client) NotesRepository {
+	return &notesRepository{db: db, cache: cache}
 }
 
-func (n notesRepository) InsertNotes(ctx context.Context, notes *model.Notes) error {
-	stmt, err := n.db.Prepare(`INSERT INTO notes."notes" (user_id, type, title, body, secret)
-								VALUES ($1, $2, $3, $4, $5) RETURNING id`)
+// InsertNotes adds the note unless the user already has maxNotes active notes, a zero maxNotes means unlimited.
+// The count and the insert run under a lock of the user so that concurrent creates cannot exceed the limit together.
+func (n notesRepository) InsertNotes(ctx context.Context, notes *model.Notes, maxNotes int) error {
+	tx, err := n.db.BeginTxx(ctx, nil)
 	if nil != err {
-		return errors.Wrap(err, "[db] InsertNotes - prepare statement")
+		return errors.Wrap(err, "[db] InsertNotes - begin transaction")
 	}
+	defer tx.Rollback()
+
+	if maxNotes > 0 {
+		if err := lockQuota(ctx, tx, notes.UserId); nil != err {
+			return err
+		}
 
-	if err := stmt.QueryRowContext(ctx, notes.UserId, notes.Type, notes.Title, notes.Body, notes.Secret).Scan(&notes.Id); nil != err {
+		var count int
+		if err := tx.QueryRowContext(ctx, `SELECT count(*) FROM notes.notes WHERE user_id=$1 AND is_active`, notes.UserId).Scan(&count); nil != err {
+			return errors.Wrap(err, "[db] InsertNotes - count notes")
+		}
+		if count >= maxNotes {
+			return app.QuotaExceededError
+		}
+	}
+
+	if err := tx.QueryRowContext(ctx, `INSERT INTO notes."notes" (user_id, type, title, body, secret, organization_id)
+								VALUES ($1, $2, $3, $4, $5, nullif($6, 0)) RETURNING id`,
+		notes.UserId, notes.Type, notes.Title, notes.Body, notes.Secret, notes.OrganizationId).Scan(&notes.Id); nil != err {
 		return errors.Wrap(err, "[db] InsertNotes - insert data")
 	}
 
+	if err := tx.Commit(); nil != err {
+		return errors.Wrap(err, "[db] InsertNotes - commit")
+	}
+
 	return nil
 }
 
-func (n notesRepository) GetNotes(ctx context.Context, userId int, roleId int) ([]model.Notes, error) {
+// GetNotes lists the notes of the organization, or the personal notes of the user outside of an organization.
+func (n notesRepository) GetNotes(ctx context.Context, userId int, orgId int, roleId int) ([]model.Notes, error) {
 	var result []model.Notes
 
-	b := newBuilder(n.db).
-		baseQuery(`SELECT id, type, title, body, secret from notes.notes`)
-	if roleId == roleUser {
-		b.addParam("user_id", userId).addParam("is_active", nil)
-	}
+	b := scopeNotes(newBuilder(n.db).
+		baseQuery(`SELECT id, type, title, body, secret from notes.notes`), userId, orgId, roleId)
 
 	rows, err := b.build().query(ctx)
 
@@ -71,13 +100,10 @@ func (n notesRepository) GetNotes(ctx context.Context, userId int, roleId int) (
 	return result, nil
 }
 
-func (n notesRepository) DetailNotes(ctx context.Context, userId int, id int, roleId int) (model.Notes, error) {
+func (n notesRepository) DetailNotes(ctx context.Context, userId int, orgId int, id int, roleId int) (model.Notes, error) {
 	var result model.Notes
 
-	query := newBuilder(n.db).baseQuery(`SELECT id, type, title, body, secret from notes.notes`).addParam("id", id)
-	if roleId == roleUser {
-		query.addParam("user_id", userId).addParam("is_active", nil)
-	}
+	query := scopeNotes(newBuilder(n.db).baseQuery(`SELECT id, type, title, body, secret from notes.notes`).addParam("id", id), userId, orgId, roleId)
 
 	rows, err := query.build().query(ctx)
 	if nil != err {
@@ -99,12 +125,12 @@ func (n notesRepository) DetailNotes(ctx context.Context, userId int, id int, ro
 	return result, nil
 }
 
-func (n notesRepository) GetSecret(ctx context.Context, id int) (string, error) {
+func (n notesRepository) GetSecret(ctx context.Context, orgId int, id int) (string, error) {
 	var result string
 
-	rows, err := newBuilder(n.db).
+	rows, err := scopeOrganization(newBuilder(n.db).
 		baseQuery(`SELECT secret FROM notes.notes`).
-		addParam("id", id).
+		addParam("id", id), orgId).
 		build().query(ctx)
 
 	if nil != err {
@@ -126,17 +152,14 @@ func (n notesRepository) GetSecret(ctx context.Context, id int) (string, error)
 }
 
 func (n notesRepository) UpdateNotes(ctx context.Context, notes *model.Notes) error {
-	query := `UPDATE notes.notes SET type=$1, title=$2, body=$3, secret=$4 where id=$5`
-	if roleUser == 0 {
-		query = fmt.Sprintf("%s AND user_id=%d", query, notes.UserId)
-	}
-
+	query := `UPDATE notes.notes SET type=$1, title=$2, body=$3, secret=$4, updated_at=now()
+				where id=$5 AND organization_id IS NOT DISTINCT FROM nullif($6, 0)`
 	stmt, err := n.db.PrepareContext(ctx, query)
 	if nil != err {
 		return errors.Wrap(err, "[db] UpdateNotes - prepare statement")
 	}
 
-	rs, err := stmt.ExecContext(ctx, notes.Type, notes.Title, notes.Body, notes.Secret, notes.Id)
+	rs, err := stmt.ExecContext(ctx, notes.Type, notes.Title, notes.Body, notes.Secret, notes.Id, notes.OrganizationId)
 	if nil != err {
 		return errors.Wrap(err, "[db] UpdateNotes - update notes")
 	}
@@ -149,17 +172,14 @@ func (n notesRepository) UpdateNotes(ctx context.Context, notes *model.Notes) er
 	return nil
 }
 
-func (n notesRepository) DeleteNotes(ctx context.Context, userId int, id int) error {
-	query := `UPDATE notes.notes SET is_active=false where id=$1`
-	if roleUser == 0 {
-		query = fmt.Sprintf("%s AND user_id=%d", query, userId)
-	}
+func (n notesRepository) DeleteNotes(ctx context.Context, userId int, orgId int, id int) error {
+	query := `UPDATE notes.notes SET is_active=false, updated_at=now() where id=$1 AND organization_id IS NOT DISTINCT FROM nullif($2, 0)`
 	stmt, err := n.db.PrepareContext(ctx, query)
 	if nil != err {
 		return errors.Wrap(err, "[db] DeleteNotes - prepare statement")
 	}
 
-	rs, err := stmt.ExecContext(ctx, id)
+	rs, err := stmt.ExecContext(ctx, id, orgId)
 	if nil != err {
 		return errors.Wrap(err, "[db] DeleteNotes - exec query delete")
 	}
@@ -173,7 +193,7 @@ func (n notesRepository) DeleteNotes(ctx context.Context, userId int, id int) er
 }
 
 func (n notesRepository) ReActiveNotes(ctx context.Context, id int) error {
-	stmt, err := n.db.PrepareContext(ctx, `UPDATE notes.notes SET is_active=true where id=$1`)
+	stmt, err := n.db.PrepareContext(ctx, `UPDATE notes.notes SET is_active=true, updated_at=now() where id=$1`)
 	if nil != err {
 		return errors.Wrap(err, "[db] ReActiveNotes - prepare statement")
 	}
@@ -189,3 +209,128 @@ func (n notesRepository) ReActiveNotes(ctx context.Context, id int) error {
 
 	return nil
 }
+
+// NotesStats aggregates the notes and media of a user, a zero userId aggregates across all users.
+// With an organization only the notes of the organization are aggregated, media stays personal and is left out.
+// The result is cached in redis for a short time since the aggregation scans every note of the user.
+func (n notesRepository) NotesStats(ctx context.Context, userId int, orgId int, days int) (model.NotesStats, error) {
+	var result model.NotesStats
+
+	err := n.cache.Cache().Once(&cache.Item{
+		Ctx:            ctx,
+		Key:            fmt.Sprintf("stats:notes:%d:%d:%d", userId, orgId, days),
+		Value:          &result,
+		TTL:            config.Cfg().StatsTTL,
+		SkipLocalCache: true,
+		Do: func(item *cache.Item) (interface{}, error) {
+			return n.selectStats(item.Context(), userId, orgId, days)
+		},
+	})
+	if nil != err {
+		return result, errors.Wrap(err, "[db] NotesStats - get cache")
+	}
+
+	return result, nil
+}
+
+func (n notesRepository) selectStats(ctx context.Context, userId int, orgId int, days int) (model.NotesStats, error) {
+	result := model.NotesStats{Days: days, ByType: make(map[string]int)}
+
+	if err := n.db.QueryRowContext(ctx, `SELECT count(*), count(*) FILTER (WHERE is_active), count(*) FILTER (WHERE NOT is_active),
+							coalesce(sum(array_length(regexp_split_to_array(btrim(body), '\s+'), 1)) FILTER (WHERE btrim(body) <> ''), 0),
+							coalesce(sum(char_length(body)), 0)
+							FROM notes.notes WHERE `+statsScope, userId, orgId).
+		Scan(&result.Total, &result.Active, &result.Deleted, &result.Words, &result.Characters); nil != err {
+		return result, errors.Wrap(err, "[db] NotesStats - query totals")
+	}
+
+	rows, err := n.db.QueryContext(ctx, `SELECT type, count(*) FROM notes.notes WHERE `+statsScope+` GROUP BY type`, userId, orgId)
+	if nil != err {
+		return result, errors.Wrap(err, "[db] NotesStats - query types")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var types string
+		var count int
+		if err := rows.Scan(&types, &count); nil != err {
+			return result, errors.Wrap(err, "[db] NotesStats - scan types")
+		}
+		result.ByType[types] = count
+	}
+
+	daily, err := n.db.QueryContext(ctx, `SELECT to_char(d, 'YYYY-MM-DD'), count(id)
+							FROM generate_series(current_date - ($3::int - 1), current_date, interval '1 day') d
+							LEFT JOIN notes.notes ON created_at::date = d::date AND `+statsScope+`
+							GROUP BY d ORDER BY d`, userId, orgId, days)
+	if nil != err {
+		return result, errors.Wrap(err, "[db] NotesStats - query daily")
+	}
+	defer daily.Close()
+
+	for daily.Next() {
+		var day model.DailyCount
+		if err := daily.Scan(&day.Date, &day.Count); nil != err {
+			return result, errors.Wrap(err, "[db] NotesStats - scan daily")
+		}
+		result.PerDay = append(result.PerDay, day)
+	}
+
+	if orgId != 0 {
+		return result, nil
+	}
+	if err := n.db.QueryRowContext(ctx, `SELECT coalesce(sum(octet_length(file)), 0) FROM notes.media WHERE ($1 = 0 OR user_id=$1)`, userId).
+		Scan(&result.StorageBytes); nil != err {
+		return result, errors.Wrap(err, "[db] NotesStats - query storage")
+	}
+
+	return result, nil
+}
+
+// ChangedNotes returns the notes of the organization or the personal notes of the user, including deleted ones,
+// changed after the cursor. Only notes written by transactions older than every transaction still in flight are
+// returned, a transaction committing later always sorts after the notes already returned.
+func (n notesRepository) ChangedNotes(ctx context.Context, userId int, orgId int, since model.ChangeCursor, limit int) ([]model.Notes, error) {
+	var result []model.Notes
+
+	rows, err := n.db.QueryContext(ctx, `SELECT id, type, title, body, secret, is_active, change_txid, change_seq FROM notes.notes
+							WHERE (CASE WHEN $5 > 0 THEN organization_id=$5 ELSE user_id=$1 AND organization_id IS NULL END)
+							AND (change_txid, change_seq) > ($2, $3) AND change_txid < txid_snapshot_xmin(txid_current_snapshot())
+							ORDER BY change_txid, change_seq LIMIT $4`, userId, since.Txid, since.Seq, limit, orgId)
+	if nil != err {
+		return nil, errors.Wrap(err, "[db] ChangedNotes - query")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		notes := model.Notes{UserId: userId, OrganizationId: orgId}
+		if err := rows.Scan(&notes.Id, &notes.Type, &notes.Title, &notes.Body, &notes.Secret, &notes.IsActive, &notes.ChangeTxid, &notes.ChangeSeq); nil != err {
+			return nil, errors.Wrap(err, "[db] ChangedNotes - scan rows")
+		}
+		result = append(result, notes)
+	}
+
+	return result, nil
+}
+
+// scopeNotes limits the query to the active notes of the organization, or to the personal notes of the user,
+// admins see every personal note including deleted ones.
+func scopeNotes(b *builder, userId int, orgId int, roleId int) *builder {
+	scopeOrganization(b, orgId)
+	if orgId != 0 {
+		return b.addParam("is_active", nil)
+	}
+	if roleId != model.RoleAdminId {
+		b.addParam("user_id", userId).addParam("is_active", nil)
+	}
+
+	return b
+}
+
+func scopeOrganization(b *builder, orgId int) *builder {
+	if orgId != 0 {
+		return b.addParam("organization_id", orgId)
+	}
+
+	return b.addParam("organization_id IS NULL", nil)
+}
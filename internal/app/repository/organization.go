@@ -0,0 +1,231 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"github.com/casbin/casbin/v2"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"refactory/notes/internal/app"
+	"refactory/notes/internal/app/model"
+)
+
+type OrganizationRepository interface {
+	InsertOrganization(ctx context.Context, organization *model.Organization, username string) error
+	ListOrganization(ctx context.Context, userId int) ([]model.Organization, error)
+	DeleteOrganization(ctx context.Context, id int) error
+	FindMember(ctx context.Context, orgId int, userId int) (model.Member, error)
+	ListMember(ctx context.Context, orgId int) ([]model.Member, error)
+	AddMember(ctx context.Context, orgId int, username string, role string) (*model.Member, error)
+	UpdateMember(ctx context.Context, orgId int, userId int, role string) (*model.Member, error)
+	RemoveMember(ctx context.Context, orgId int, userId int) error
+}
+
+type organizationRepository struct {
+	db       *sqlx.DB
+	enforcer *casbin.SyncedEnforcer
+}
+
+func NewOrganizationRepository(db *sqlx.DB, enforcer *casbin.SyncedEnforcer) OrganizationRepository {
+	return &organizationRepository{db: db, enforcer: enforcer}
+}
+
+// InsertOrganization creates the organization with its creator as owner.
+func (o *organizationRepository) InsertOrganization(ctx context.Context, organization *model.Organization, username string) error {
+	tx, err := o.db.BeginTxx(ctx, nil)
+	if nil != err {
+		return errors.Wrap(err, "[db] InsertOrganization - begin transaction")
+	}
+	defer tx.Rollback()
+
+	if err := tx.QueryRowContext(ctx, `INSERT INTO notes.organizations (name, created_by) VALUES ($1, $2) RETURNING id, created_at`,
+		organization.Name, organization.CreatedBy).Scan(&organization.Id, &organization.CreatedAt); nil != err {
+		return errors.Wrap(err, "[db] InsertOrganization - insert organization")
+	}
+
+	if _, err := tx.ExecContext(ctx, `INSERT INTO notes.organization_members (organization_id, user_id, role) VALUES ($1, $2, $3)`,
+		organization.Id, organization.CreatedBy, model.OrgRoleOwner); nil != err {
+		return errors.Wrap(err, "[db] InsertOrganization - insert owner")
+	}
+
+	if err := tx.Commit(); nil != err {
+		return errors.Wrap(err, "[db] InsertOrganization - commit")
+	}
+	organization.Role = model.OrgRoleOwner
+
+	return syncMember(o.enforcer, username, organization.Id, model.OrgRoleOwner)
+}
+
+// ListOrganization returns the organizations of the user with the role they have in each.
+func (o *organizationRepository) ListOrganization(ctx context.Context, userId int) ([]model.Organization, error) {
+	var result []model.Organization
+
+	rows, err := o.db.QueryContext(ctx, `SELECT o.id, o.name, coalesce(o.created_by, 0), m.role, o.created_at
+								FROM notes.organizations o JOIN notes.organization_members m ON m.organization_id = o.id
+								WHERE m.user_id=$1 AND o.deleted_at IS NULL ORDER BY o.name`, userId)
+	if nil != err {
+		return nil, errors.Wrap(err, "[db] ListOrganization - query")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var organization model.Organization
+		if err := rows.Scan(&organization.Id, &organization.Name, &organization.CreatedBy, &organization.Role, &organization.CreatedAt); nil != err {
+			return nil, errors.Wrap(err, "[db] ListOrganization - scan")
+		}
+		result = append(result, organization)
+	}
+
+	return result, nil
+}
+
+// DeleteOrganization marks the organization deleted and deletes its notes, the members and their roles are kept so
+// they still receive the tombstones of the notes through sync.
+func (o *organizationRepository) DeleteOrganization(ctx context.Context, id int) error {
+	tx, err := o.db.BeginTxx(ctx, nil)
+	if nil != err {
+		return errors.Wrap(err, "[db] DeleteOrganization - begin transaction")
+	}
+	defer tx.Rollback()
+
+	rs, err := tx.ExecContext(ctx, `UPDATE notes.organizations SET deleted_at=now() WHERE id=$1 AND deleted_at IS NULL`, id)
+	if nil != err {
+		return errors.Wrap(err, "[db] DeleteOrganization - mark deleted")
+	}
+	if deleted, _ := rs.RowsAffected(); deleted == 0 {
+		return app.NotFoundError
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE notes.notes SET is_active=false WHERE organization_id=$1 AND is_active`, id); nil != err {
+		return errors.Wrap(err, "[db] DeleteOrganization - delete notes")
+	}
+
+	if err := tx.Commit(); nil != err {
+		return errors.Wrap(err, "[db] DeleteOrganization - commit")
+	}
+
+	return nil
+}
+
+func (o *organizationRepository) FindMember(ctx context.Context, orgId int, userId int) (model.Member, error) {
+	var result model.Member
+
+	err := o.db.QueryRowContext(ctx, `SELECT m.organization_id, m.user_id, u.username, m.role, m.created_at, o.deleted_at IS NOT NULL
+								FROM notes.organization_members m JOIN notes."user" u ON u.id = m.user_id
+								JOIN notes.organizations o ON o.id = m.organization_id
+								WHERE m.organization_id=$1 AND m.user_id=$2`, orgId, userId).
+		Scan(&result.OrganizationId, &result.UserId, &result.Username, &result.Role, &result.CreatedAt, &result.Deleted)
+	if nil != err {
+		if sql.ErrNoRows == err {
+			return result, app.NotFoundError
+		}
+		return result, errors.Wrap(err, "[db] FindMember - query")
+	}
+
+	return result, nil
+}
+
+func (o *organizationRepository) ListMember(ctx context.Context, orgId int) ([]model.Member, error) {
+	var result []model.Member
+
+	rows, err := o.db.QueryContext(ctx, `SELECT m.organization_id, m.user_id, u.username, m.role, m.created_at
+								FROM notes.organization_members m JOIN notes."user" u ON u.id = m.user_id
+								WHERE m.organization_id=$1 ORDER BY u.username`, orgId)
+	if nil != err {
+		return nil, errors.Wrap(err, "[db] ListMember - query")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var member model.Member
+		if err := rows.Scan(&member.OrganizationId, &member.UserId, &member.Username, &member.Role, &member.CreatedAt); nil != err {
+			return nil, errors.Wrap(err, "[db] ListMember - scan")
+		}
+		result = append(result, member)
+	}
+
+	return result, nil
+}
+
+// AddMember adds an active and verified user to the organization, a user who already is a member is reported as app.DuplicateError.
+func (o *organizationRepository) AddMember(ctx context.Context, orgId int, username string, role string) (*model.Member, error) {
+	result := model.Member{OrganizationId: orgId, Username: username, Role: role}
+
+	err := o.db.QueryRowContext(ctx, `INSERT INTO notes.organization_members (organization_id, user_id, role)
+								SELECT $1, id, $3 FROM notes."user" WHERE username=$2 AND is_active AND is_verified
+								RETURNING user_id, created_at`, orgId, username, role).
+		Scan(&result.UserId, &result.CreatedAt)
+	if nil != err {
+		if sql.ErrNoRows == err {
+			return nil, app.NotFoundError
+		}
+		if vErr, ok := err.(*pq.Error); ok {
+			switch vErr.Code {
+			case "23505":
+				return nil, app.DuplicateError
+			case "23503":
+				return nil, app.NotFoundError
+			}
+		}
+		return nil, errors.Wrap(err, "[db] AddMember - insert data")
+	}
+
+	if err := syncMember(o.enforcer, result.Username, orgId, role); nil != err {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (o *organizationRepository) UpdateMember(ctx context.Context, orgId int, userId int, role string) (*model.Member, error) {
+	result := model.Member{OrganizationId: orgId, UserId: userId, Role: role}
+
+	err := o.db.QueryRowContext(ctx, `UPDATE notes.organization_members m SET role=$3 FROM notes."user" u
+								WHERE m.organization_id=$1 AND m.user_id=$2 AND u.id = m.user_id RETURNING u.username, m.created_at`,
+		orgId, userId, role).Scan(&result.Username, &result.CreatedAt)
+	if nil != err {
+		if sql.ErrNoRows == err {
+			return nil, app.NotFoundError
+		}
+		return nil, errors.Wrap(err, "[db] UpdateMember - query")
+	}
+
+	if err := syncMember(o.enforcer, result.Username, orgId, role); nil != err {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (o *organizationRepository) RemoveMember(ctx context.Context, orgId int, userId int) error {
+	var username string
+	err := o.db.QueryRowContext(ctx, `DELETE FROM notes.organization_members m USING notes."user" u
+								WHERE m.organization_id=$1 AND m.user_id=$2 AND u.id = m.user_id RETURNING u.username`, orgId, userId).
+		Scan(&username)
+	if nil != err {
+		if sql.ErrNoRows == err {
+			return app.NotFoundError
+		}
+		return errors.Wrap(err, "[db] RemoveMember - query")
+	}
+
+	if _, err := o.enforcer.DeleteRolesForUserInDomain(username, model.OrganizationDomain(orgId)); nil != err {
+		return errors.Wrap(err, "[casbin] RemoveMember - delete roles")
+	}
+
+	return nil
+}
+
+// syncMember makes the organization role the only grouping policy of the user in the domain of the organization.
+func syncMember(enforcer *casbin.SyncedEnforcer, username string, orgId int, role string) error {
+	domain := model.OrganizationDomain(orgId)
+	if _, err := enforcer.DeleteRolesForUserInDomain(username, domain); nil != err {
+		return errors.Wrap(err, "[casbin] syncMember - delete roles")
+	}
+	if _, err := enforcer.AddRoleForUserInDomain(username, model.OrganizationSubject(role), domain); nil != err {
+		return errors.Wrap(err, "[casbin] syncMember - add role")
+	}
+
+	return nil
+}
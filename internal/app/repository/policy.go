@@ -0,0 +1,189 @@
+package repository
+
+import (
+	"context"
+	"github.com/casbin/casbin/v2"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/log"
+	"refactory/notes/internal/app"
+	"refactory/notes/internal/app/model"
+)
+
+type PolicyRepository interface {
+	ListPolicy(ctx context.Context, pType string) ([]model.PolicyResponse, error)
+	AddPolicy(ctx context.Context, userId int, req model.PolicyRequest) error
+	RemovePolicy(ctx context.Context, userId int, req model.PolicyRequest) error
+	TestPolicy(ctx context.Context, req model.PolicyTestRequest) (*model.PolicyTestResponse, error)
+	ListAudit(ctx context.Context, limit int) ([]model.PolicyAudit, error)
+}
+
+type policyRepository struct {
+	db       *sqlx.DB
+	enforcer *casbin.SyncedEnforcer
+}
+
+func NewPolicyRepository(db *sqlx.DB, enforcer *casbin.SyncedEnforcer) PolicyRepository {
+	return &policyRepository{db: db, enforcer: enforcer}
+}
+
+// ListPolicy returns the p and g rules loaded in the enforcer, an empty type returns both.
+func (p *policyRepository) ListPolicy(ctx context.Context, pType string) ([]model.PolicyResponse, error) {
+	var result []model.PolicyResponse
+
+	if pType == "" || pType == "p" {
+		for _, rule := range p.enforcer.GetNamedPolicy("p") {
+			result = append(result, model.PolicyResponse{PType: "p", Rule: rule})
+		}
+	}
+	if pType == "" || pType == "g" {
+		for _, rule := range p.enforcer.GetNamedGroupingPolicy("g") {
+			result = append(result, model.PolicyResponse{PType: "g", Rule: rule})
+		}
+	}
+
+	return result, nil
+}
+
+// AddPolicy writes the audit record in a transaction that is only committed once the enforcer saved the rule,
+// a rule whose audit record cannot be committed is removed again.
+func (p *policyRepository) AddPolicy(ctx context.Context, userId int, req model.PolicyRequest) error {
+	if err := p.validate(req); nil != err {
+		return err
+	}
+
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if nil != err {
+		return errors.Wrap(err, "[db] AddPolicy - begin transaction")
+	}
+	defer tx.Rollback()
+
+	if err := auditPolicy(ctx, tx, userId, model.PolicyActionAdd, req); nil != err {
+		return err
+	}
+
+	added, err := p.addRule(req)
+	if nil != err {
+		return errors.Wrap(err, "[casbin] AddPolicy - add rule")
+	}
+	if !added {
+		return app.DuplicateError
+	}
+
+	if err := tx.Commit(); nil != err {
+		if _, rErr := p.removeRule(req); nil != rErr {
+			log.Error(errors.Wrap(rErr, "[casbin] AddPolicy - revert rule"))
+		}
+		return errors.Wrap(err, "[db] AddPolicy - commit")
+	}
+
+	return nil
+}
+
+// RemovePolicy is the counterpart of AddPolicy, the rule is added back when its audit record cannot be committed.
+func (p *policyRepository) RemovePolicy(ctx context.Context, userId int, req model.PolicyRequest) error {
+	if err := p.validate(req); nil != err {
+		return err
+	}
+
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if nil != err {
+		return errors.Wrap(err, "[db] RemovePolicy - begin transaction")
+	}
+	defer tx.Rollback()
+
+	if err := auditPolicy(ctx, tx, userId, model.PolicyActionRemove, req); nil != err {
+		return err
+	}
+
+	removed, err := p.removeRule(req)
+	if nil != err {
+		return errors.Wrap(err, "[casbin] RemovePolicy - remove rule")
+	}
+	if !removed {
+		return app.NotFoundError
+	}
+
+	if err := tx.Commit(); nil != err {
+		if _, rErr := p.addRule(req); nil != rErr {
+			log.Error(errors.Wrap(rErr, "[casbin] RemovePolicy - revert rule"))
+		}
+		return errors.Wrap(err, "[db] RemovePolicy - commit")
+	}
+
+	return nil
+}
+
+func (p *policyRepository) addRule(req model.PolicyRequest) (bool, error) {
+	if req.PType == "g" {
+		return p.enforcer.AddNamedGroupingPolicy(req.PType, req.Rule)
+	}
+	return p.enforcer.AddNamedPolicy(req.PType, req.Rule)
+}
+
+func (p *policyRepository) removeRule(req model.PolicyRequest) (bool, error) {
+	if req.PType == "g" {
+		return p.enforcer.RemoveNamedGroupingPolicy(req.PType, req.Rule)
+	}
+	return p.enforcer.RemoveNamedPolicy(req.PType, req.Rule)
+}
+
+// TestPolicy evaluates the request the same way the authorization middleware does, path is the route pattern such as /api/notes/:id.
+func (p *policyRepository) TestPolicy(ctx context.Context, req model.PolicyTestRequest) (*model.PolicyTestResponse, error) {
+	domain := req.Domain
+	if domain == "" {
+		domain = model.PersonalDomain
+	}
+
+	allowed, matched, err := p.enforcer.EnforceEx(req.Subject, domain, req.Path, req.Method)
+	if nil != err {
+		return nil, errors.Wrap(err, "[casbin] TestPolicy - enforce")
+	}
+
+	return &model.PolicyTestResponse{Allowed: allowed, Matched: matched}, nil
+}
+
+func (p *policyRepository) ListAudit(ctx context.Context, limit int) ([]model.PolicyAudit, error) {
+	var result []model.PolicyAudit
+
+	rows, err := p.db.QueryContext(ctx, `SELECT id, user_id, action, p_type, rule, created_at FROM notes.policy_audits
+								ORDER BY id DESC LIMIT $1`, limit)
+	if nil != err {
+		return nil, errors.Wrap(err, "[db] ListAudit - query")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var audit model.PolicyAudit
+		if err := rows.Scan(&audit.Id, &audit.UserId, &audit.Action, &audit.PType, pq.Array(&audit.Rule), &audit.CreatedAt); nil != err {
+			return nil, errors.Wrap(err, "[db] ListAudit - scan")
+		}
+		result = append(result, audit)
+	}
+
+	return result, nil
+}
+
+// validate checks the rule against the sections and the number of fields declared in casbin/model.conf.
+func (p *policyRepository) validate(req model.PolicyRequest) error {
+	assertions, ok := p.enforcer.GetModel()[req.PType]
+	if !ok {
+		return app.BadRequestError
+	}
+	assertion, ok := assertions[req.PType]
+	if !ok || len(assertion.Tokens) != len(req.Rule) {
+		return app.BadRequestError
+	}
+
+	return nil
+}
+
+func auditPolicy(ctx context.Context, tx *sqlx.Tx, userId int, action string, req model.PolicyRequest) error {
+	if _, err := tx.ExecContext(ctx, `INSERT INTO notes.policy_audits (user_id, action, p_type, rule) VALUES ($1, $2, $3, $4)`,
+		userId, action, req.PType, pq.Array(req.Rule)); nil != err {
+		return errors.Wrap(err, "[db] auditPolicy - insert data")
+	}
+
+	return nil
+}
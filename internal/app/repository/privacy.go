@@ -0,0 +1,237 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"github.com/casbin/casbin/v2"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/log"
+	"refactory/notes/internal/app"
+	"refactory/notes/internal/app/model"
+	"time"
+)
+
+type PrivacyRepository interface {
+	ExportProfile(ctx context.Context, userId int) (*model.ExportProfile, error)
+	ExportNotes(ctx context.Context, userId int) ([]model.ExportNote, error)
+	ExportMedia(ctx context.Context, userId int) ([]model.ExportMedia, error)
+	ExportAudit(ctx context.Context, userId int) ([]model.PolicyAudit, error)
+	ExportDelivery(ctx context.Context, userId int) ([]model.WebhookDelivery, error)
+	ScheduleErasure(ctx context.Context, userId int, at time.Time) (time.Time, error)
+	DueErasure(ctx context.Context, limit int) ([]model.Erasure, error)
+	EraseUser(ctx context.Context, userId int) error
+}
+
+type privacyRepository struct {
+	db       *sqlx.DB
+	enforcer *casbin.SyncedEnforcer
+}
+
+func NewPrivacyRepository(db *sqlx.DB, enforcer *casbin.SyncedEnforcer) PrivacyRepository {
+	return &privacyRepository{db: db, enforcer: enforcer}
+}
+
+func (p *privacyRepository) ExportProfile(ctx context.Context, userId int) (*model.ExportProfile, error) {
+	var result model.ExportProfile
+
+	if err := p.db.QueryRowContext(ctx, `SELECT u.id, u.first_name, u.last_name, u.email, u.username, r.name, u.is_verified, u.is_active, u.totp_enabled
+								FROM notes."user" u JOIN notes.roles r ON r.id = u.role_id WHERE u.id=$1`, userId).
+		Scan(&result.Id, &result.FirstName, &result.LastName, &result.Email, &result.Username, &result.Role, &result.IsVerified,
+			&result.IsActive, &result.TotpEnabled); nil != err {
+		if sql.ErrNoRows == err {
+			return nil, app.NotFoundError
+		}
+		return nil, errors.Wrap(err, "[db] ExportProfile - query")
+	}
+
+	return &result, nil
+}
+
+// ExportNotes returns every note of the user, including the deleted ones still kept in the database.
+func (p *privacyRepository) ExportNotes(ctx context.Context, userId int) ([]model.ExportNote, error) {
+	result := []model.ExportNote{}
+
+	rows, err := p.db.QueryContext(ctx, `SELECT id, type, coalesce(title, ''), coalesce(body, ''), coalesce(secret, ''), is_active, created_at, updated_at
+								FROM notes.notes WHERE user_id=$1 ORDER BY id`, userId)
+	if nil != err {
+		return nil, errors.Wrap(err, "[db] ExportNotes - query")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var note model.ExportNote
+		if err := rows.Scan(&note.Id, &note.Type, &note.Title, &note.Body, &note.Secret, &note.IsActive, &note.CreatedAt, &note.UpdatedAt); nil != err {
+			return nil, errors.Wrap(err, "[db] ExportNotes - scan")
+		}
+		result = append(result, note)
+	}
+
+	return result, nil
+}
+
+// ExportMedia lists the media of the user without their content, files are read one at a time while writing the archive.
+func (p *privacyRepository) ExportMedia(ctx context.Context, userId int) ([]model.ExportMedia, error) {
+	result := []model.ExportMedia{}
+
+	rows, err := p.db.QueryContext(ctx, `SELECT id, mime_type, created_at FROM notes.media WHERE user_id=$1 ORDER BY id`, userId)
+	if nil != err {
+		return nil, errors.Wrap(err, "[db] ExportMedia - query")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var media model.ExportMedia
+		if err := rows.Scan(&media.Id, &media.MimeType, &media.CreatedAt); nil != err {
+			return nil, errors.Wrap(err, "[db] ExportMedia - scan")
+		}
+		result = append(result, media)
+	}
+
+	return result, nil
+}
+
+func (p *privacyRepository) ExportAudit(ctx context.Context, userId int) ([]model.PolicyAudit, error) {
+	result := []model.PolicyAudit{}
+
+	rows, err := p.db.QueryContext(ctx, `SELECT id, user_id, action, p_type, rule, created_at FROM notes.policy_audits
+								WHERE user_id=$1 ORDER BY id`, userId)
+	if nil != err {
+		return nil, errors.Wrap(err, "[db] ExportAudit - query")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var audit model.PolicyAudit
+		if err := rows.Scan(&audit.Id, &audit.UserId, &audit.Action, &audit.PType, pq.Array(&audit.Rule), &audit.CreatedAt); nil != err {
+			return nil, errors.Wrap(err, "[db] ExportAudit - scan")
+		}
+		result = append(result, audit)
+	}
+
+	return result, nil
+}
+
+// ExportDelivery returns the webhook deliveries of the user, they record every event emitted for the account.
+func (p *privacyRepository) ExportDelivery(ctx context.Context, userId int) ([]model.WebhookDelivery, error) {
+	var result []model.WebhookDelivery
+
+	rows, err := p.db.QueryContext(ctx, `SELECT d.id, d.webhook_id, w.url, d.event, d.payload, d.status, d.attempts, d.response_code,
+								d.last_error, d.next_attempt_at, d.delivered_at, d.created_at
+								FROM notes.webhook_deliveries d JOIN notes.webhooks w ON w.id = d.webhook_id
+								WHERE w.user_id=$1 ORDER BY d.id`, userId)
+	if nil != err {
+		return nil, errors.Wrap(err, "[db] ExportDelivery - query")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d model.WebhookDelivery
+		if err := rows.Scan(&d.Id, &d.WebhookId, &d.Url, &d.Event, &d.Payload, &d.Status, &d.Attempts, &d.ResponseCode,
+			&d.LastError, &d.NextAttemptAt, &d.DeliveredAt, &d.CreatedAt); nil != err {
+			return nil, errors.Wrap(err, "[db] ExportDelivery - scan")
+		}
+		result = append(result, d)
+	}
+
+	return result, nil
+}
+
+// ScheduleErasure deactivates the user until the erasure runs, asking again keeps the time of the first request.
+func (p *privacyRepository) ScheduleErasure(ctx context.Context, userId int, at time.Time) (time.Time, error) {
+	var eraseAt time.Time
+
+	if err := p.db.QueryRowContext(ctx, `UPDATE notes."user" SET erase_at=coalesce(erase_at, $2), is_active=false
+								WHERE id=$1 RETURNING erase_at`, userId, at).Scan(&eraseAt); nil != err {
+		if sql.ErrNoRows == err {
+			return eraseAt, app.NotFoundError
+		}
+		return eraseAt, errors.Wrap(err, "[db] ScheduleErasure - update data")
+	}
+
+	return eraseAt, nil
+}
+
+func (p *privacyRepository) DueErasure(ctx context.Context, limit int) ([]model.Erasure, error) {
+	var result []model.Erasure
+
+	rows, err := p.db.QueryContext(ctx, `SELECT id, username FROM notes."user" WHERE erase_at <= now() ORDER BY erase_at LIMIT $1`, limit)
+	if nil != err {
+		return nil, errors.Wrap(err, "[db] DueErasure - query")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var erasure model.Erasure
+		if err := rows.Scan(&erasure.UserId, &erasure.Username); nil != err {
+			return nil, errors.Wrap(err, "[db] DueErasure - scan")
+		}
+		result = append(result, erasure)
+	}
+
+	return result, nil
+}
+
+// EraseUser hard deletes the user with their personal notes, media, webhooks and quota, audit records are kept without the user
+// and the notes they shared in an organization are kept by it.
+// The row lock makes concurrent workers and a cancelled erasure skip the user with app.NotFoundError.
+func (p *privacyRepository) EraseUser(ctx context.Context, userId int) error {
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if nil != err {
+		return errors.Wrap(err, "[db] EraseUser - begin transaction")
+	}
+	defer tx.Rollback()
+
+	var username string
+	if err := tx.QueryRowContext(ctx, `SELECT username FROM notes."user" WHERE id=$1 AND erase_at <= now() FOR UPDATE SKIP LOCKED`, userId).
+		Scan(&username); nil != err {
+		if sql.ErrNoRows == err {
+			return app.NotFoundError
+		}
+		return errors.Wrap(err, "[db] EraseUser - lock user")
+	}
+
+	// the roles of the user are removed before the username is free again, so a user registering it next does not inherit them
+	if _, err := tx.ExecContext(ctx, `DELETE FROM rules WHERE p_type='g' AND v0=$1`, username); nil != err {
+		return errors.Wrap(err, "[db] EraseUser - delete roles")
+	}
+
+	for _, query := range []string{
+		`UPDATE notes.policy_audits SET user_id=null WHERE user_id=$1`,
+		// shared notes stay with the organization, they pass to an owner or else the longest standing member
+		`UPDATE notes.notes n SET user_id=s.user_id FROM (
+			SELECT DISTINCT ON (organization_id) organization_id, user_id FROM notes.organization_members
+			WHERE user_id<>$1 ORDER BY organization_id, role<>'owner', created_at) s
+		WHERE n.organization_id=s.organization_id AND n.user_id=$1`,
+		// organizations nobody else is a member of go with their notes, there is no one left to sync them
+		`DELETE FROM notes.organizations o
+		WHERE NOT EXISTS(SELECT 1 FROM notes.organization_members m WHERE m.organization_id=o.id AND m.user_id<>$1)
+		AND (EXISTS(SELECT 1 FROM notes.organization_members m WHERE m.organization_id=o.id AND m.user_id=$1)
+			OR EXISTS(SELECT 1 FROM notes.notes n WHERE n.organization_id=o.id AND n.user_id=$1))`,
+		`DELETE FROM notes.notes WHERE user_id=$1 AND organization_id IS NULL`,
+		`DELETE FROM notes.webhooks WHERE user_id=$1`,
+		`DELETE FROM notes.quotas WHERE user_id=$1`,
+		`UPDATE notes."user" SET media_id=null WHERE id=$1`,
+		`DELETE FROM notes.media WHERE user_id=$1`,
+		`DELETE FROM notes."user" WHERE id=$1`,
+	} {
+		if _, err := tx.ExecContext(ctx, query, userId); nil != err {
+			return errors.Wrapf(err, "[db] EraseUser - %s", query)
+		}
+	}
+
+	if err := tx.Commit(); nil != err {
+		return errors.Wrap(err, "[db] EraseUser - commit")
+	}
+
+	// the rules are already gone from the table, this only drops them from the enforcer and notifies the other instances
+	if _, err := p.enforcer.RemoveFilteredGroupingPolicy(0, username); nil != err {
+		log.Error(errors.Wrap(err, "[casbin] EraseUser - delete roles"))
+		if err := p.enforcer.LoadPolicy(); nil != err {
+			log.Error(errors.Wrap(err, "[casbin] EraseUser - reload policy"))
+		}
+	}
+
+	return nil
+}
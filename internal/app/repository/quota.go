@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"refactory/notes/internal/app"
+	"refactory/notes/internal/app/model"
+	"refactory/notes/internal/config"
+)
+
+type QuotaRepository interface {
+	FindQuota(ctx context.Context, userId int) (model.Quota, error)
+	UpsertQuota(ctx context.Context, userId int, req model.QuotaRequest) error
+	DeleteQuota(ctx context.Context, userId int) error
+	CountNotes(ctx context.Context, userId int) (int, error)
+	MediaUsage(ctx context.Context, userId int) (int64, error)
+}
+
+type quotaRepository struct {
+	db *sqlx.DB
+}
+
+func NewQuotaRepository(db *sqlx.DB) QuotaRepository {
+	return &quotaRepository{db: db}
+}
+
+// FindQuota returns the limits of the user, falling back to the configured defaults for every limit that is not overridden.
+func (q *quotaRepository) FindQuota(ctx context.Context, userId int) (model.Quota, error) {
+	result := model.Quota{
+		UserId:        userId,
+		MaxNotes:      config.Cfg().QuotaMaxNotes,
+		MaxBodySize:   config.Cfg().QuotaMaxBodySize,
+		MaxMediaBytes: config.Cfg().QuotaMaxMediaBytes,
+	}
+
+	var maxNotes, maxBodySize, maxMediaBytes sql.NullInt64
+	err := q.db.QueryRowContext(ctx, `SELECT max_notes, max_body_size, max_media_bytes FROM notes.quotas WHERE user_id=$1`, userId).
+		Scan(&maxNotes, &maxBodySize, &maxMediaBytes)
+	if nil != err {
+		if sql.ErrNoRows == err {
+			return result, nil
+		}
+		return result, errors.Wrap(err, "[db] FindQuota - query")
+	}
+
+	result.IsOverride = true
+	if maxNotes.Valid {
+		result.MaxNotes = int(maxNotes.Int64)
+	}
+	if maxBodySize.Valid {
+		result.MaxBodySize = int(maxBodySize.Int64)
+	}
+	if maxMediaBytes.Valid {
+		result.MaxMediaBytes = maxMediaBytes.Int64
+	}
+
+	return result, nil
+}
+
+func (q *quotaRepository) UpsertQuota(ctx context.Context, userId int, req model.QuotaRequest) error {
+	_, err := q.db.ExecContext(ctx, `INSERT INTO notes.quotas (user_id, max_notes, max_body_size, max_media_bytes) VALUES ($1, $2, $3, $4)
+								ON CONFLICT (user_id) DO UPDATE SET max_notes=excluded.max_notes, max_body_size=excluded.max_body_size,
+								max_media_bytes=excluded.max_media_bytes, updated_at=now()`,
+		userId, req.MaxNotes, req.MaxBodySize, req.MaxMediaBytes)
+	if nil != err {
+		if vErr, ok := err.(*pq.Error); ok && vErr.Code == "23503" {
+			return app.NotFoundError
+		}
+		return errors.Wrap(err, "[db] UpsertQuota - exec query")
+	}
+
+	return nil
+}
+
+func (q *quotaRepository) DeleteQuota(ctx context.Context, userId int) error {
+	if _, err := q.db.ExecContext(ctx, `DELETE FROM notes.quotas WHERE user_id=$1`, userId); nil != err {
+		return errors.Wrap(err, "[db] DeleteQuota - exec query")
+	}
+
+	return nil
+}
+
+func (q *quotaRepository) CountNotes(ctx context.Context, userId int) (int, error) {
+	var result int
+	if err := q.db.QueryRowContext(ctx, `SELECT count(*) FROM notes.notes WHERE user_id=$1 AND is_active`, userId).Scan(&result); nil != err {
+		return 0, errors.Wrap(err, "[db] CountNotes - query")
+	}
+
+	return result, nil
+}
+
+func (q *quotaRepository) MediaUsage(ctx context.Context, userId int) (int64, error) {
+	var result int64
+	if err := q.db.QueryRowContext(ctx, `SELECT coalesce(sum(octet_length(file)), 0) FROM notes.media WHERE user_id=$1`, userId).Scan(&result); nil != err {
+		return 0, errors.Wrap(err, "[db] MediaUsage - query")
+	}
+
+	return result, nil
+}
+
+// lockQuota locks the user row for the rest of the transaction, so that the usage counted afterwards cannot change
+// until the insert it guards commits. Concurrent inserts of the same user wait for each other.
+func lockQuota(ctx context.Context, tx *sqlx.Tx, userId int) error {
+	var id int
+	if err := tx.QueryRowContext(ctx, `SELECT id FROM notes."user" WHERE id=$1 FOR UPDATE`, userId).Scan(&id); nil != err {
+		if sql.ErrNoRows == err {
+			return app.NotFoundError
+		}
+		return errors.Wrap(err, "[db] lockQuota - lock user")
+	}
+
+	return nil
+}
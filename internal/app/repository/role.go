@@ -0,0 +1,195 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"github.com/casbin/casbin/v2"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"refactory/notes/internal/app"
+	"refactory/notes/internal/app/model"
+)
+
+type RoleRepository interface {
+	ListRole(ctx context.Context) ([]model.Role, error)
+	FindRole(ctx context.Context, id int) (model.Role, error)
+	FindRoleByName(ctx context.Context, name string) (model.Role, error)
+	InsertRole(ctx context.Context, role *model.Role) error
+	UpdateRole(ctx context.Context, role *model.Role) error
+	DeleteRole(ctx context.Context, id int) error
+	AssignRole(ctx context.Context, userId int, roleId int) error
+}
+
+type roleRepository struct {
+	db       *sqlx.DB
+	enforcer *casbin.SyncedEnforcer
+}
+
+func NewRoleRepository(db *sqlx.DB, enforcer *casbin.SyncedEnforcer) RoleRepository {
+	return &roleRepository{db: db, enforcer: enforcer}
+}
+
+func (r *roleRepository) ListRole(ctx context.Context) ([]model.Role, error) {
+	var result []model.Role
+
+	rows, err := r.db.QueryContext(ctx, `SELECT r.id, r.name, r.is_active, count(u.id) FROM notes.roles r
+								LEFT JOIN notes."user" u ON u.role_id = r.id GROUP BY r.id ORDER BY r.id`)
+	if nil != err {
+		return nil, errors.Wrap(err, "[db] ListRole - query")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var role model.Role
+		if err := rows.Scan(&role.Id, &role.Name, &role.IsActive, &role.Users); nil != err {
+			return nil, errors.Wrap(err, "[db] ListRole - scan")
+		}
+		result = append(result, role)
+	}
+
+	return result, nil
+}
+
+func (r *roleRepository) FindRole(ctx context.Context, id int) (model.Role, error) {
+	var result model.Role
+
+	err := r.db.QueryRowContext(ctx, `SELECT r.id, r.name, r.is_active, count(u.id) FROM notes.roles r
+								LEFT JOIN notes."user" u ON u.role_id = r.id WHERE r.id=$1 GROUP BY r.id`, id).
+		Scan(&result.Id, &result.Name, &result.IsActive, &result.Users)
+	if nil != err {
+		if sql.ErrNoRows == err {
+			return result, app.NotFoundError
+		}
+		return result, errors.Wrap(err, "[db] FindRole - query")
+	}
+
+	return result, nil
+}
+
+func (r *roleRepository) FindRoleByName(ctx context.Context, name string) (model.Role, error) {
+	var result model.Role
+
+	err := r.db.QueryRowContext(ctx, `SELECT id, name, is_active FROM notes.roles WHERE name=$1 AND is_active`, name).
+		Scan(&result.Id, &result.Name, &result.IsActive)
+	if nil != err {
+		if sql.ErrNoRows == err {
+			return result, app.NotFoundError
+		}
+		return result, errors.Wrap(err, "[db] FindRoleByName - query")
+	}
+
+	return result, nil
+}
+
+func (r *roleRepository) InsertRole(ctx context.Context, role *model.Role) error {
+	err := r.db.QueryRowContext(ctx, `INSERT INTO notes.roles (name) VALUES ($1) RETURNING id, is_active`, role.Name).
+		Scan(&role.Id, &role.IsActive)
+	if nil != err {
+		if vErr, ok := err.(*pq.Error); ok && vErr.Code == "23505" {
+			return app.DuplicateError
+		}
+		return errors.Wrap(err, "[db] InsertRole - query")
+	}
+
+	return nil
+}
+
+// UpdateRole renames the role and moves its grouping and permission policies in Casbin to the new name.
+func (r *roleRepository) UpdateRole(ctx context.Context, role *model.Role) error {
+	var old string
+	err := r.db.QueryRowContext(ctx, `UPDATE notes.roles r SET name=$2 FROM (SELECT name FROM notes.roles WHERE id=$1) old
+								WHERE r.id=$1 RETURNING old.name, r.is_active`, role.Id, role.Name).Scan(&old, &role.IsActive)
+	if nil != err {
+		if sql.ErrNoRows == err {
+			return app.NotFoundError
+		}
+		if vErr, ok := err.(*pq.Error); ok && vErr.Code == "23505" {
+			return app.DuplicateError
+		}
+		return errors.Wrap(err, "[db] UpdateRole - query")
+	}
+
+	if old == role.Name {
+		return nil
+	}
+
+	users, err := r.enforcer.GetUsersForRole(old, model.PersonalDomain)
+	if nil != err {
+		return errors.Wrap(err, "[casbin] UpdateRole - get users")
+	}
+	for _, username := range users {
+		if err := syncRole(r.enforcer, username, role.Name); nil != err {
+			return err
+		}
+	}
+
+	policies := r.enforcer.GetFilteredPolicy(0, old)
+	if len(policies) == 0 {
+		return nil
+	}
+	if _, err := r.enforcer.RemoveFilteredPolicy(0, old); nil != err {
+		return errors.Wrap(err, "[casbin] UpdateRole - remove policies")
+	}
+	for _, policy := range policies {
+		policy[0] = role.Name
+	}
+	if _, err := r.enforcer.AddPolicies(policies); nil != err {
+		return errors.Wrap(err, "[casbin] UpdateRole - add policies")
+	}
+
+	return nil
+}
+
+// DeleteRole removes the role together with its permission policies, a role that is still assigned to users can not be deleted.
+func (r *roleRepository) DeleteRole(ctx context.Context, id int) error {
+	var name string
+	if err := r.db.QueryRowContext(ctx, `DELETE FROM notes.roles WHERE id=$1 RETURNING name`, id).Scan(&name); nil != err {
+		if sql.ErrNoRows == err {
+			return app.NotFoundError
+		}
+		if vErr, ok := err.(*pq.Error); ok && vErr.Code == "23503" {
+			return app.InUseError
+		}
+		return errors.Wrap(err, "[db] DeleteRole - query")
+	}
+
+	if _, err := r.enforcer.RemoveFilteredPolicy(0, name); nil != err {
+		return errors.Wrap(err, "[casbin] DeleteRole - remove policies")
+	}
+
+	return nil
+}
+
+// AssignRole sets the role of the user, the grouping policy is only synced for verified users since they get it on verification.
+func (r *roleRepository) AssignRole(ctx context.Context, userId int, roleId int) error {
+	var username, name string
+	var verified bool
+	err := r.db.QueryRowContext(ctx, `UPDATE notes."user" u SET role_id=r.id FROM notes.roles r
+								WHERE u.id=$1 AND r.id=$2 AND r.is_active RETURNING u.username, u.is_verified, r.name`, userId, roleId).
+		Scan(&username, &verified, &name)
+	if nil != err {
+		if sql.ErrNoRows == err {
+			return app.NotFoundError
+		}
+		return errors.Wrap(err, "[db] AssignRole - query")
+	}
+
+	if !verified {
+		return nil
+	}
+
+	return syncRole(r.enforcer, username, name)
+}
+
+// syncRole makes the role the only grouping policy of the user in the personal domain, organization roles are left untouched.
+func syncRole(enforcer *casbin.SyncedEnforcer, username string, role string) error {
+	if _, err := enforcer.DeleteRolesForUser(username, model.PersonalDomain); nil != err {
+		return errors.Wrap(err, "[casbin] syncRole - delete roles")
+	}
+	if _, err := enforcer.AddRoleForUser(username, role, model.PersonalDomain); nil != err {
+		return errors.Wrap(err, "[casbin] syncRole - add role")
+	}
+
+	return nil
+}
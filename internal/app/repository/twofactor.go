@@ -0,0 +1,174 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	redisv8 "github.com/go-redis/redis/v8"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"refactory/notes/internal/app"
+	"refactory/notes/internal/db/redis"
+	"time"
+)
+
+type TwoFactorRepository interface {
+	SaveSecret(ctx context.Context, userId int, secret string, recoveryCodes []string) error
+	EnableTwoFactor(ctx context.Context, userId int) error
+	ResetTwoFactor(ctx context.Context, userId int) error
+	UseRecoveryCode(ctx context.Context, userId int, hash string) (bool, error)
+	UseStep(ctx context.Context, userId int, step int64) (bool, error)
+	SaveChallenge(ctx context.Context, hash string, username string, ttl time.Duration) error
+	FindChallenge(ctx context.Context, hash string) (string, error)
+	FailChallenge(ctx context.Context, hash string, limit int64) error
+	DeleteChallenge(ctx context.Context, hash string) error
+}
+
+type twoFactorRepository struct {
+	db    *sqlx.DB
+	cache redis.Client
+}
+
+func NewTwoFactorRepository(db *sqlx.DB, cache redis.Client) TwoFactorRepository {
+	return &twoFactorRepository{db: db, cache: cache}
+}
+
+// SaveSecret stores a pending secret with its hashed recovery codes, 2FA stays disabled until the secret is verified.
+func (t *twoFactorRepository) SaveSecret(ctx context.Context, userId int, secret string, recoveryCodes []string) error {
+	tx, err := t.db.BeginTx(ctx, nil)
+	if nil != err {
+		return errors.Wrap(err, "[db] SaveSecret - begin transaction")
+	}
+
+	rs, err := tx.ExecContext(ctx, `UPDATE notes."user" SET totp_secret=$2, totp_enabled=false WHERE id=$1 AND is_active`, userId, secret)
+	if nil != err {
+		tx.Rollback()
+		return errors.Wrap(err, "[db] SaveSecret - update secret")
+	}
+	if updated, _ := rs.RowsAffected(); updated == 0 {
+		tx.Rollback()
+		return app.NotFoundError
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM notes.recovery_codes WHERE user_id=$1`, userId); nil != err {
+		tx.Rollback()
+		return errors.Wrap(err, "[db] SaveSecret - delete recovery codes")
+	}
+
+	for _, code := range recoveryCodes {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO notes.recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userId, code); nil != err {
+			tx.Rollback()
+			return errors.Wrap(err, "[db] SaveSecret - insert recovery code")
+		}
+	}
+
+	if err := tx.Commit(); nil != err {
+		return errors.Wrap(err, "[db] SaveSecret - commit transaction")
+	}
+
+	return nil
+}
+
+func (t *twoFactorRepository) EnableTwoFactor(ctx context.Context, userId int) error {
+	rs, err := t.db.ExecContext(ctx, `UPDATE notes."user" SET totp_enabled=true WHERE id=$1 AND totp_secret IS NOT NULL`, userId)
+	if nil != err {
+		return errors.Wrap(err, "[db] EnableTwoFactor - update user")
+	}
+	if updated, _ := rs.RowsAffected(); updated == 0 {
+		return app.NotFoundError
+	}
+
+	return nil
+}
+
+func (t *twoFactorRepository) ResetTwoFactor(ctx context.Context, userId int) error {
+	tx, err := t.db.BeginTx(ctx, nil)
+	if nil != err {
+		return errors.Wrap(err, "[db] ResetTwoFactor - begin transaction")
+	}
+
+	rs, err := tx.ExecContext(ctx, `UPDATE notes."user" SET totp_secret=null, totp_enabled=false WHERE id=$1`, userId)
+	if nil != err {
+		tx.Rollback()
+		return errors.Wrap(err, "[db] ResetTwoFactor - update user")
+	}
+	if updated, _ := rs.RowsAffected(); updated == 0 {
+		tx.Rollback()
+		return app.NotFoundError
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM notes.recovery_codes WHERE user_id=$1`, userId); nil != err {
+		tx.Rollback()
+		return errors.Wrap(err, "[db] ResetTwoFactor - delete recovery codes")
+	}
+
+	if err := tx.Commit(); nil != err {
+		return errors.Wrap(err, "[db] ResetTwoFactor - commit transaction")
+	}
+
+	return nil
+}
+
+// UseRecoveryCode burns an unused recovery code, it reports false when the code does not exist or was used.
+func (t *twoFactorRepository) UseRecoveryCode(ctx context.Context, userId int, hash string) (bool, error) {
+	rs, err := t.db.ExecContext(ctx, `UPDATE notes.recovery_codes SET used_at=now() WHERE user_id=$1 AND code_hash=$2 AND used_at IS NULL`, userId, hash)
+	if nil != err {
+		return false, errors.Wrap(err, "[db] UseRecoveryCode - update code")
+	}
+
+	used, _ := rs.RowsAffected()
+	return used > 0, nil
+}
+
+// UseStep records the time step of an accepted code so that the same code cannot be replayed.
+func (t *twoFactorRepository) UseStep(ctx context.Context, userId int, step int64) (bool, error) {
+	first, err := t.cache.Conn().SetNX(ctx, fmt.Sprintf("2fa:step:%d:%d", userId, step), 1, time.Minute*5).Result()
+	if nil != err {
+		return false, errors.Wrap(err, "[rdr] UseStep - save to cache")
+	}
+
+	return first, nil
+}
+
+func (t *twoFactorRepository) SaveChallenge(ctx context.Context, hash string, username string, ttl time.Duration) error {
+	if err := t.cache.Conn().Set(ctx, fmt.Sprintf("2fa:challenge:%s", hash), username, ttl).Err(); nil != err {
+		return errors.Wrap(err, "[rdr] SaveChallenge - save to cache")
+	}
+
+	return nil
+}
+
+func (t *twoFactorRepository) FindChallenge(ctx context.Context, hash string) (string, error) {
+	username, err := t.cache.Conn().Get(ctx, fmt.Sprintf("2fa:challenge:%s", hash)).Result()
+	if nil != err {
+		if redisv8.Nil == err {
+			return "", app.NotFoundError
+		}
+		return "", errors.Wrap(err, "[rdr] FindChallenge - get cache")
+	}
+
+	return username, nil
+}
+
+// FailChallenge counts a wrong code for the challenge and drops the challenge once the limit is reached.
+func (t *twoFactorRepository) FailChallenge(ctx context.Context, hash string, limit int64) error {
+	key := fmt.Sprintf("2fa:challenge:%s:failed", hash)
+	failed, err := t.cache.Conn().Incr(ctx, key).Result()
+	if nil != err {
+		return errors.Wrap(err, "[rdr] FailChallenge - increment counter")
+	}
+	t.cache.Conn().Expire(ctx, key, time.Minute*10)
+
+	if failed >= limit {
+		return t.DeleteChallenge(ctx, hash)
+	}
+
+	return nil
+}
+
+func (t *twoFactorRepository) DeleteChallenge(ctx context.Context, hash string) error {
+	if err := t.cache.Conn().Del(ctx, fmt.Sprintf("2fa:challenge:%s", hash), fmt.Sprintf("2fa:challenge:%s:failed", hash)).Err(); nil != err {
+		return errors.Wrap(err, "[rdr] DeleteChallenge - delete cache")
+	}
+
+	return nil
+}
@@ -6,42 +6,89 @@ import (
 	"fmt"
 	"github.com/casbin/casbin/v2"
 	"github.com/go-redis/cache/v8"
+	redisv8 "github.com/go-redis/redis/v8"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
 	"github.com/pkg/errors"
 	"github.com/prometheus/common/log"
 	"refactory/notes/internal/app"
 	"refactory/notes/internal/app/model"
+	"refactory/notes/internal/config"
 	"refactory/notes/internal/db/redis"
 	"refactory/notes/internal/security/token"
+	"strings"
 	"time"
 )
 
+// sessionTTL is the least time the registration session is kept, longer verification codes extend it.
+const sessionTTL = time.Minute * 30
+
+// userSortColumns maps the sort options of the user listing to their column, the empty option sorts by id.
+var userSortColumns = map[string]string{
+	"":           "u.id",
+	"id":         "u.id",
+	"username":   "u.username",
+	"email":      "u.email",
+	"first_name": "u.first_name",
+	"last_name":  "u.last_name",
+}
+
+// likeEscaper escapes the wildcards of a LIKE pattern so a search matches them literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
 type UserRepository interface {
 	Create(ctx context.Context, user *model.User, verifSession model.Session) (string, error)
 	FindUser(ctx context.Context, username string) (*model.User, error)
 	VerifyUser(ctx context.Context, username string) error
 	UpdateSession(ctx context.Context, session model.Session) error
 	FindSession(ctx context.Context, username string) (model.Session, error)
-	ListUser(ctx context.Context) ([]*model.User, error)
+	ListUser(ctx context.Context, filter model.UserFilter) ([]*model.User, int, error)
+	EachUser(ctx context.Context, filter model.UserFilter, fn func(*model.User) error) error
 	DetailUser(ctx context.Context, Id int) (*model.User, error)
 	UpdateUser(ctx context.Context, user *model.User) error
 	DeleteUser(ctx context.Context, id int) error
 	ActiveUser(ctx context.Context, id int) error
+	FindUserByEmail(ctx context.Context, email string) (*model.User, error)
+	UpdatePassword(ctx context.Context, id int, password string) error
+	SaveResetToken(ctx context.Context, hash string, username string, ttl time.Duration) error
+	ConsumeResetToken(ctx context.Context, hash string) (string, error)
+	DeleteSession(ctx context.Context, username string) error
+	RevokeTokens(ctx context.Context, userId int) error
+	RevokedAt(ctx context.Context, userId int) (int64, error)
+	DenyToken(ctx context.Context, jti string, ttl time.Duration) error
+	SaveRefreshToken(ctx context.Context, hash string, refresh model.RefreshToken) error
+	FindRefreshToken(ctx context.Context, hash string) (model.RefreshToken, error)
+	UseRefreshToken(ctx context.Context, hash string) (bool, error)
+	RevokeFamily(ctx context.Context, family string) error
+	IsFamilyRevoked(ctx context.Context, family string) (bool, error)
+	SaveVerificationLink(ctx context.Context, hash string, username string, ttl time.Duration) error
+	ConsumeVerificationLink(ctx context.Context, hash string) (string, error)
+	VerificationFailures(ctx context.Context, username string) (int64, error)
+	FailVerification(ctx context.Context, username string, lockout time.Duration) (int64, error)
+	ClearVerificationFailures(ctx context.Context, username string) error
+	AcquireResend(ctx context.Context, username string, cooldown time.Duration) (bool, error)
+	LoginLockedFor(ctx context.Context, subjects ...string) (time.Duration, error)
+	FailLogin(ctx context.Context, subject string, window time.Duration) (int64, error)
+	LockLogin(ctx context.Context, subject string, base time.Duration, max time.Duration) (time.Duration, error)
+	UnlockLogin(ctx context.Context, subject string) error
+	SaveDevice(ctx context.Context, userId int, device model.Device) error
+	TouchDevice(ctx context.Context, userId int, id string, client model.Client) error
+	ListDevice(ctx context.Context, userId int) ([]model.Device, error)
+	RevokeDevice(ctx context.Context, userId int, id string) error
+	SaveEmailChange(ctx context.Context, userId int, change model.EmailChange, ttl time.Duration) error
+	FindEmailChange(ctx context.Context, userId int) (model.EmailChange, error)
+	FailEmailChange(ctx context.Context, userId int) (int64, error)
+	DeleteEmailChange(ctx context.Context, userId int) error
+	UpdateEmail(ctx context.Context, userId int, email string) error
 }
 
-const (
-	roleUser int = iota + 1
-	roleAdmin
-)
-
 type userRepository struct {
 	db       *sqlx.DB
 	cache    redis.Client
-	enforcer *casbin.Enforcer
+	enforcer *casbin.SyncedEnforcer
 }
 
-func NewUserRepository(db *sqlx.DB, cache redis.Client, enforcer *casbin.Enforcer) *userRepository {
+func NewUserRepository(db *sqlx.DB, cache redis.Client, enforcer *casbin.SyncedEnforcer) *userRepository {
 	return &userRepository{db: db, cache: cache, enforcer: enforcer}
 }
 
@@ -61,6 +108,7 @@ func (u *userRepository) Create(ctx context.Context, user *model.User, session m
 		tx.Rollback()
 		return "", err
 	}
+	session.UserId = user.Id
 
 	if err := u.UpdateSession(ctx, session); nil != err {
 		tx.Rollback()
@@ -76,14 +124,20 @@ func (u *userRepository) Create(ctx context.Context, user *model.User, session m
 	return t, nil
 }
 
+// UpdateSession saves the registration session holding the verification code, it lives at least as long as the code.
 func (u *userRepository) UpdateSession(ctx context.Context, session model.Session) error {
 	key := fmt.Sprintf("session:%s", session.Username)
 
+	ttl := sessionTTL
+	if config.Cfg().VerificationTTL > ttl {
+		ttl = config.Cfg().VerificationTTL
+	}
+
 	if err := u.cache.Cache().Set(&cache.Item{
 		Ctx:   ctx,
 		Key:   key,
 		Value: session,
-		TTL:   time.Minute * 30,
+		TTL:   ttl,
 	}); nil != err {
 		return errors.Wrap(err, "[db] UpdateSession - save to cache")
 	}
@@ -92,29 +146,32 @@ func (u *userRepository) UpdateSession(ctx context.Context, session model.Sessio
 }
 
 func (u *userRepository) VerifyUser(ctx context.Context, username string) error {
-	stmt, err := u.db.PrepareContext(ctx, `UPDATE notes."user" SET is_verified=true where username=$1`)
-	if nil != err {
-		return errors.Wrap(err, "[db] VerifyUser - prepared statement")
-	}
-	defer stmt.Close()
-
-	if _, err := stmt.ExecContext(ctx, username); nil != err {
+	var role string
+	if err := u.db.QueryRowContext(ctx, `UPDATE notes."user" u SET is_verified=true FROM notes.roles r
+								WHERE u.username=$1 AND r.id=u.role_id RETURNING r.name`, username).Scan(&role); nil != err {
+		if sql.ErrNoRows == err {
+			return app.NotFoundError
+		}
 		return errors.Wrap(err, "[db] VerifyUser - update db")
 	}
 
+	// the session is gone when the user verifies through the magic link after it expired
 	var session model.Session
 	key := fmt.Sprintf("session:%s", username)
-	if err := u.cache.Cache().Get(ctx, key, &session); nil != err {
+	if err := u.cache.Cache().Get(ctx, key, &session); nil != err && cache.ErrCacheMiss != err {
 		return errors.Wrap(err, "[db] VerifyUser - get cache")
+	} else if nil == err {
+		session.IsVerified = true
+		session.Code = 0
+		if err := u.UpdateSession(ctx, session); nil != err {
+			return errors.Wrap(err, "[db] VerifyUser - update cache")
+		}
 	}
 
-	session.IsVerified = true
-	if err := u.UpdateSession(ctx, session); nil != err {
-		return errors.Wrap(err, "[db] VerifyUser - update cache")
+	if err := syncRole(u.enforcer, username, role); nil != err {
+		return err
 	}
 
-	u.enforcer.AddRoleForUser(username, "user")
-
 	return nil
 }
 
@@ -129,14 +186,16 @@ func (u *userRepository) FindSession(ctx context.Context, username string) (mode
 
 func (u *userRepository) FindUser(ctx context.Context, username string) (*model.User, error) {
 	var result model.User
-	stmt, err := u.db.PrepareContext(ctx, `SELECT id, first_name, last_name, email, password, username, is_verified, role_id, is_active from notes."user" where username=$1 and is_active`)
+	stmt, err := u.db.PrepareContext(ctx, `SELECT id, first_name, last_name, email, password, username, is_verified, role_id, is_active,
+								coalesce(totp_secret, ''), totp_enabled from notes."user" where username=$1 and is_active`)
 	if nil != err {
 		return nil, errors.Wrap(err, "[db] FindUser - prepared statement")
 	}
 	defer stmt.Close()
 
 	if err := stmt.QueryRowContext(ctx, username).Scan(&result.Id, &result.FirstName, &result.LastName,
-		&result.Email, &result.Password, &result.Username, &result.IsVerified, &result.Role, &result.IsActive); nil != err {
+		&result.Email, &result.Password, &result.Username, &result.IsVerified, &result.Role, &result.IsActive,
+		&result.TotpSecret, &result.TotpEnabled); nil != err {
 		return nil, err
 	}
 
@@ -152,39 +211,132 @@ func (u *userRepository) FindUser(ctx context.Context, username string) (*model.
 	return &result, nil
 }
 
-func (u *userRepository) ListUser(ctx context.Context) ([]*model.User, error) {
+// ListUser returns a page of the users matching the filter with the number of matching users.
+// A zero PerPage returns every matching user.
+func (u *userRepository) ListUser(ctx context.Context, filter model.UserFilter) ([]*model.User, int, error) {
 	var result []*model.User
-	stmt, err := u.db.PrepareContext(ctx, `SELECT id, first_name, last_name, email, password, username, media_id, role_id FROM notes."user"`)
+	var total int
+
+	query, args, err := userListQuery(filter)
 	if nil != err {
-		return nil, errors.Wrap(err, "[db] ListUser - prepare statement")
+		return nil, 0, err
 	}
 
-	rows, err := stmt.Query()
+	// the total is counted on its own, a page past the end has no rows to carry it
+	from, countArgs := userListFrom(filter)
+	if err := u.db.QueryRowContext(ctx, fmt.Sprintf("SELECT count(*) %s", from), countArgs...).Scan(&total); nil != err {
+		return nil, 0, errors.Wrap(err, "[db] ListUser - count")
+	}
+
+	if filter.PerPage > 0 {
+		args = append(args, filter.PerPage, (filter.Page-1)*filter.PerPage)
+		query = fmt.Sprintf("%s LIMIT $%d OFFSET $%d", query, len(args)-1, len(args))
+	}
+
+	rows, err := u.db.QueryContext(ctx, query, args...)
 	if nil != err {
-		if sql.ErrNoRows == err {
-			return nil, app.NotFoundError
+		return nil, 0, errors.Wrap(err, "[db] ListUser - query")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		user := new(model.User)
+		if err := rows.Scan(&user.Id, &user.FirstName, &user.LastName, &user.Email, &user.Username, &user.MediaId, &user.Role, &user.RoleName,
+			&user.IsVerified, &user.IsActive); nil != err {
+			return nil, 0, errors.Wrap(err, "[db] ListUser - scan")
 		}
-		return nil, errors.Wrap(err, "[db] ListUser - query")
+		result = append(result, user)
+	}
+	if err := rows.Err(); nil != err {
+		return nil, 0, errors.Wrap(err, "[db] ListUser - rows")
 	}
 
-	if nil != rows.Err() || !rows.Next() {
-		return nil, app.NotFoundError
+	return result, total, nil
+}
+
+// EachUser streams every user matching the filter to fn from a single query, so users created or deleted while
+// reading neither shift nor repeat rows. Paging of the filter is ignored.
+func (u *userRepository) EachUser(ctx context.Context, filter model.UserFilter, fn func(*model.User) error) error {
+	query, args, err := userListQuery(filter)
+	if nil != err {
+		return err
 	}
 
+	rows, err := u.db.QueryContext(ctx, query, args...)
+	if nil != err {
+		return errors.Wrap(err, "[db] EachUser - query")
+	}
+	defer rows.Close()
+
 	for rows.Next() {
 		user := new(model.User)
-		if err := rows.Scan(&user.Id, &user.FirstName, &user.LastName, &user.Email, &user.Password, &user.Username, &user.MediaId, &user.Role); nil != err {
-			return nil, errors.Wrap(err, "[db] ListUser - scan")
+		if err := rows.Scan(&user.Id, &user.FirstName, &user.LastName, &user.Email, &user.Username, &user.MediaId, &user.Role, &user.RoleName,
+			&user.IsVerified, &user.IsActive); nil != err {
+			return errors.Wrap(err, "[db] EachUser - scan")
 		}
-		result = append(result, user)
+		if err := fn(user); nil != err {
+			return err
+		}
+	}
+	if err := rows.Err(); nil != err {
+		return errors.Wrap(err, "[db] EachUser - rows")
 	}
 
-	return result, nil
+	return nil
+}
+
+// userListFrom builds the FROM and WHERE clause of the user listing from the filter.
+func userListFrom(filter model.UserFilter) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	if filter.Query != "" {
+		args = append(args, "%"+likeEscaper.Replace(filter.Query)+"%")
+		conditions = append(conditions, fmt.Sprintf(`(u.first_name ILIKE $%[1]d OR u.last_name ILIKE $%[1]d OR
+								concat_ws(' ', u.first_name, u.last_name) ILIKE $%[1]d OR u.email ILIKE $%[1]d OR u.username ILIKE $%[1]d)`, len(args)))
+	}
+	if filter.RoleId != 0 {
+		args = append(args, filter.RoleId)
+		conditions = append(conditions, fmt.Sprintf("u.role_id=$%d", len(args)))
+	}
+	if nil != filter.Verified {
+		args = append(args, *filter.Verified)
+		conditions = append(conditions, fmt.Sprintf("coalesce(u.is_verified, false)=$%d", len(args)))
+	}
+	if nil != filter.Active {
+		args = append(args, *filter.Active)
+		conditions = append(conditions, fmt.Sprintf("u.is_active=$%d", len(args)))
+	}
+
+	from := `FROM notes."user" u JOIN notes.roles r ON r.id = u.role_id`
+	if len(conditions) > 0 {
+		from = fmt.Sprintf("%s WHERE %s", from, strings.Join(conditions, " AND "))
+	}
+
+	return from, args
+}
+
+// userListQuery builds the ordered query of the user listing without paging.
+func userListQuery(filter model.UserFilter) (string, []interface{}, error) {
+	from, args := userListFrom(filter)
+
+	column, ok := userSortColumns[filter.Sort]
+	if !ok {
+		return "", nil, app.BadRequestError
+	}
+	order := "ASC"
+	if filter.Desc {
+		order = "DESC"
+	}
+
+	return fmt.Sprintf(`SELECT u.id, coalesce(u.first_name, ''), coalesce(u.last_name, ''), coalesce(u.email, ''), u.username, coalesce(u.media_id, 0),
+								u.role_id, r.name, coalesce(u.is_verified, false), u.is_active
+								%s ORDER BY %s %s, u.id %s`, from, column, order, order), args, nil
 }
 
 func (u *userRepository) DetailUser(ctx context.Context, Id int) (*model.User, error) {
 	user := new(model.User)
-	stmt, err := u.db.PrepareContext(ctx, `SELECT id, first_name, last_name, email, password, username, media_id, role_id FROM notes."user" WHERE id=$1`)
+	stmt, err := u.db.PrepareContext(ctx, `SELECT u.id, u.first_name, u.last_name, u.email, u.password, u.username, u.media_id, u.role_id, r.name
+								FROM notes."user" u JOIN notes.roles r ON r.id = u.role_id WHERE u.id=$1`)
 	if nil != err {
 		return nil, errors.Wrap(err, "[db] DetailUser - prepare statement")
 	}
@@ -197,19 +349,20 @@ func (u *userRepository) DetailUser(ctx context.Context, Id int) (*model.User, e
 		return nil, errors.Wrap(err, "[db] DetailUser - query")
 	}
 
-	if err := row.Scan(&user.Id, &user.FirstName, &user.LastName, &user.Email, &user.Password, &user.Username, &user.MediaId, &user.Role); nil != err {
+	if err := row.Scan(&user.Id, &user.FirstName, &user.LastName, &user.Email, &user.Password, &user.Username, &user.MediaId, &user.Role, &user.RoleName); nil != err {
 		return nil, errors.Wrap(err, "[db] DetailUser - scan")
 	}
 
 	return user, nil
 }
 
+// UpdateUser saves the profile of the user, the email address only changes through a confirmed email change.
 func (u *userRepository) UpdateUser(ctx context.Context, user *model.User) error {
-	stmt, err := u.db.PrepareContext(ctx, `UPDATE notes."user" SET first_name=$2, last_name=$3, email=$4, username=$5 WHERE id=$1 AND is_active`)
+	stmt, err := u.db.PrepareContext(ctx, `UPDATE notes."user" SET first_name=$2, last_name=$3, username=$4 WHERE id=$1 AND is_active`)
 	if nil != err {
 		return errors.Wrap(err, "[db] UpdateUser - prepare statement")
 	}
-	rs, err := stmt.Exec(user.Id, user.FirstName, user.LastName, user.Email, user.Username)
+	rs, err := stmt.Exec(user.Id, user.FirstName, user.LastName, user.Username)
 	if nil != err {
 		return errors.Wrap(err, "[db] UpdateUser- query")
 	}
@@ -240,8 +393,9 @@ func (u *userRepository) DeleteUser(ctx context.Context, id int) error {
 	return nil
 }
 
+// ActiveUser reactivates the user, cancelling an erasure still in its grace period.
 func (u *userRepository) ActiveUser(ctx context.Context, id int) error {
-	stmt, err := u.db.PrepareContext(ctx, `UPDATE notes."user" SET is_active=true where id=$1`)
+	stmt, err := u.db.PrepareContext(ctx, `UPDATE notes."user" SET is_active=true, erase_at=null where id=$1`)
 	if nil != err {
 		return errors.Wrap(err, "[db] DeleteUser - prepare statement")
 	}
@@ -258,3 +412,316 @@ func (u *userRepository) ActiveUser(ctx context.Context, id int) error {
 
 	return nil
 }
+
+func (u *userRepository) FindUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	var result model.User
+	stmt, err := u.db.PrepareContext(ctx, `SELECT id, first_name, last_name, email, username, is_verified, role_id, is_active from notes."user"
+								where lower(email)=lower($1) and is_active order by id limit 1`)
+	if nil != err {
+		return nil, errors.Wrap(err, "[db] FindUserByEmail - prepared statement")
+	}
+	defer stmt.Close()
+
+	if err := stmt.QueryRowContext(ctx, email).Scan(&result.Id, &result.FirstName, &result.LastName,
+		&result.Email, &result.Username, &result.IsVerified, &result.Role, &result.IsActive); nil != err {
+		if sql.ErrNoRows == err {
+			return nil, app.NotFoundError
+		}
+		return nil, errors.Wrap(err, "[db] FindUserByEmail - scan")
+	}
+
+	return &result, nil
+}
+
+func (u *userRepository) UpdatePassword(ctx context.Context, id int, password string) error {
+	var username string
+	if err := u.db.QueryRowContext(ctx, `UPDATE notes."user" SET password=$2 WHERE id=$1 AND is_active RETURNING username`, id, password).
+		Scan(&username); nil != err {
+		if sql.ErrNoRows == err {
+			return app.NotFoundError
+		}
+		return errors.Wrap(err, "[db] UpdatePassword - query")
+	}
+
+	if err := u.cache.Cache().Delete(ctx, fmt.Sprintf("find:user:%s", username)); nil != err && cache.ErrCacheMiss != err {
+		log.Error(errors.Wrap(err, "[rdr] UpdatePassword - delete cache"))
+	}
+
+	return nil
+}
+
+// SaveResetToken stores the hash of a password reset token, the plain token is only known by the mail recipient.
+func (u *userRepository) SaveResetToken(ctx context.Context, hash string, username string, ttl time.Duration) error {
+	if err := u.cache.Conn().Set(ctx, fmt.Sprintf("password:reset:%s", hash), username, ttl).Err(); nil != err {
+		return errors.Wrap(err, "[rdr] SaveResetToken - save to cache")
+	}
+
+	return nil
+}
+
+// ConsumeResetToken returns the owner of a password reset token and removes it, so every token can only be used once.
+func (u *userRepository) ConsumeResetToken(ctx context.Context, hash string) (string, error) {
+	username, err := consume(ctx, u.cache, fmt.Sprintf("password:reset:%s", hash))
+	if nil != err {
+		return "", errors.Wrap(err, "[rdr] ConsumeResetToken - get cache")
+	}
+
+	return username, nil
+}
+
+// consume atomically reads and removes a key, a missing key is reported as app.NotFoundError.
+func consume(ctx context.Context, cache redis.Client, key string) (string, error) {
+	var get *redisv8.StringCmd
+	if _, err := cache.Conn().TxPipelined(ctx, func(pipe redisv8.Pipeliner) error {
+		get = pipe.Get(ctx, key)
+		pipe.Del(ctx, key)
+		return nil
+	}); nil != err {
+		if redisv8.Nil == err {
+			return "", app.NotFoundError
+		}
+		return "", err
+	}
+
+	return get.Val(), nil
+}
+
+func (u *userRepository) DeleteSession(ctx context.Context, username string) error {
+	if err := u.cache.Cache().Delete(ctx, fmt.Sprintf("session:%s", username)); nil != err && cache.ErrCacheMiss != err {
+		return errors.Wrap(err, "[rdr] DeleteSession - delete cache")
+	}
+
+	return nil
+}
+
+// RevokeTokens rejects every access and refresh token of the user issued before now and forgets their device sessions,
+// the marker lives as long as the longest lived token it revokes.
+func (u *userRepository) RevokeTokens(ctx context.Context, userId int) error {
+	if _, err := u.cache.Conn().TxPipelined(ctx, func(pipe redisv8.Pipeliner) error {
+		pipe.Set(ctx, token.RevokedKey(userId), time.Now().Unix(), config.Cfg().RefreshTokenTTL)
+		pipe.Del(ctx, devicesKey(userId))
+		return nil
+	}); nil != err {
+		return errors.Wrap(err, "[rdr] RevokeTokens - save to cache")
+	}
+
+	return nil
+}
+
+func (u *userRepository) RevokedAt(ctx context.Context, userId int) (int64, error) {
+	revoked, err := u.cache.Conn().Get(ctx, token.RevokedKey(userId)).Int64()
+	if nil != err && redisv8.Nil != err {
+		return 0, errors.Wrap(err, "[rdr] RevokedAt - get cache")
+	}
+
+	return revoked, nil
+}
+
+func (u *userRepository) DenyToken(ctx context.Context, jti string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return nil
+	}
+
+	if err := u.cache.Conn().Set(ctx, token.DeniedKey(jti), 1, ttl).Err(); nil != err {
+		return errors.Wrap(err, "[rdr] DenyToken - save to cache")
+	}
+
+	return nil
+}
+
+func (u *userRepository) SaveRefreshToken(ctx context.Context, hash string, refresh model.RefreshToken) error {
+	if err := u.cache.Cache().Set(&cache.Item{
+		Ctx:            ctx,
+		Key:            fmt.Sprintf("refresh:%s", hash),
+		Value:          refresh,
+		TTL:            config.Cfg().RefreshTokenTTL,
+		SkipLocalCache: true,
+	}); nil != err {
+		return errors.Wrap(err, "[rdr] SaveRefreshToken - save to cache")
+	}
+
+	return nil
+}
+
+func (u *userRepository) FindRefreshToken(ctx context.Context, hash string) (model.RefreshToken, error) {
+	var refresh model.RefreshToken
+	if err := u.cache.Cache().GetSkippingLocalCache(ctx, fmt.Sprintf("refresh:%s", hash), &refresh); nil != err {
+		if cache.ErrCacheMiss == err {
+			return refresh, app.NotFoundError
+		}
+		return refresh, errors.Wrap(err, "[rdr] FindRefreshToken - get cache")
+	}
+
+	return refresh, nil
+}
+
+// UseRefreshToken marks the refresh token as used, it reports false when the token has been used before.
+func (u *userRepository) UseRefreshToken(ctx context.Context, hash string) (bool, error) {
+	first, err := u.cache.Conn().SetNX(ctx, fmt.Sprintf("refresh:used:%s", hash), 1, config.Cfg().RefreshTokenTTL).Result()
+	if nil != err {
+		return false, errors.Wrap(err, "[rdr] UseRefreshToken - save to cache")
+	}
+
+	return first, nil
+}
+
+func (u *userRepository) RevokeFamily(ctx context.Context, family string) error {
+	if err := u.cache.Conn().Set(ctx, token.FamilyRevokedKey(family), 1, config.Cfg().RefreshTokenTTL).Err(); nil != err {
+		return errors.Wrap(err, "[rdr] RevokeFamily - save to cache")
+	}
+
+	return nil
+}
+
+func (u *userRepository) IsFamilyRevoked(ctx context.Context, family string) (bool, error) {
+	count, err := u.cache.Conn().Exists(ctx, token.FamilyRevokedKey(family)).Result()
+	if nil != err {
+		return false, errors.Wrap(err, "[rdr] IsFamilyRevoked - get cache")
+	}
+
+	return count > 0, nil
+}
+
+// SaveVerificationLink stores the hash of a magic link, the link issued to the username before it stops working.
+func (u *userRepository) SaveVerificationLink(ctx context.Context, hash string, username string, ttl time.Duration) error {
+	currentKey := fmt.Sprintf("verification:current:%s", username)
+	previous, err := u.cache.Conn().GetSet(ctx, currentKey, hash).Result()
+	if nil != err && redisv8.Nil != err {
+		return errors.Wrap(err, "[rdr] SaveVerificationLink - swap current link")
+	}
+
+	if _, err := u.cache.Conn().TxPipelined(ctx, func(pipe redisv8.Pipeliner) error {
+		pipe.Expire(ctx, currentKey, ttl)
+		pipe.Set(ctx, fmt.Sprintf("verification:link:%s", hash), username, ttl)
+		if previous != "" && previous != hash {
+			pipe.Del(ctx, fmt.Sprintf("verification:link:%s", previous))
+		}
+		return nil
+	}); nil != err {
+		return errors.Wrap(err, "[rdr] SaveVerificationLink - save to cache")
+	}
+
+	return nil
+}
+
+func (u *userRepository) ConsumeVerificationLink(ctx context.Context, hash string) (string, error) {
+	username, err := consume(ctx, u.cache, fmt.Sprintf("verification:link:%s", hash))
+	if nil != err {
+		return "", errors.Wrap(err, "[rdr] ConsumeVerificationLink - get cache")
+	}
+
+	return username, nil
+}
+
+func (u *userRepository) VerificationFailures(ctx context.Context, username string) (int64, error) {
+	failed, err := u.cache.Conn().Get(ctx, fmt.Sprintf("verification:failed:%s", username)).Int64()
+	if nil != err && redisv8.Nil != err {
+		return 0, errors.Wrap(err, "[rdr] VerificationFailures - get cache")
+	}
+
+	return failed, nil
+}
+
+// FailVerification counts a wrong verification code, the counter expires after the lockout duration of the last failure.
+func (u *userRepository) FailVerification(ctx context.Context, username string, lockout time.Duration) (int64, error) {
+	key := fmt.Sprintf("verification:failed:%s", username)
+	failed, err := u.cache.Conn().Incr(ctx, key).Result()
+	if nil != err {
+		return 0, errors.Wrap(err, "[rdr] FailVerification - increment counter")
+	}
+
+	if err := u.cache.Conn().Expire(ctx, key, lockout).Err(); nil != err {
+		return 0, errors.Wrap(err, "[rdr] FailVerification - expire counter")
+	}
+
+	return failed, nil
+}
+
+func (u *userRepository) ClearVerificationFailures(ctx context.Context, username string) error {
+	if err := u.cache.Conn().Del(ctx, fmt.Sprintf("verification:failed:%s", username)).Err(); nil != err {
+		return errors.Wrap(err, "[rdr] ClearVerificationFailures - delete cache")
+	}
+
+	return nil
+}
+
+// AcquireResend reports whether a verification mail may be sent, at most one per cooldown.
+func (u *userRepository) AcquireResend(ctx context.Context, username string, cooldown time.Duration) (bool, error) {
+	acquired, err := u.cache.Conn().SetNX(ctx, fmt.Sprintf("verification:resend:%s", username), 1, cooldown).Result()
+	if nil != err {
+		return false, errors.Wrap(err, "[rdr] AcquireResend - save to cache")
+	}
+
+	return acquired, nil
+}
+
+// LoginLockedFor returns the longest lock left on the subjects, a subject is either user:<username> or ip:<address>.
+func (u *userRepository) LoginLockedFor(ctx context.Context, subjects ...string) (time.Duration, error) {
+	var result time.Duration
+	for _, subject := range subjects {
+		ttl, err := u.cache.Conn().PTTL(ctx, fmt.Sprintf("login:lock:%s", subject)).Result()
+		if nil != err {
+			return 0, errors.Wrap(err, "[rdr] LoginLockedFor - get ttl")
+		}
+		if ttl > result {
+			result = ttl
+		}
+	}
+
+	return result, nil
+}
+
+func (u *userRepository) FailLogin(ctx context.Context, subject string, window time.Duration) (int64, error) {
+	key := fmt.Sprintf("login:failed:%s", subject)
+	failed, err := u.cache.Conn().Incr(ctx, key).Result()
+	if nil != err {
+		return 0, errors.Wrap(err, "[rdr] FailLogin - increment counter")
+	}
+
+	if failed == 1 {
+		if err := u.cache.Conn().Expire(ctx, key, window).Err(); nil != err {
+			return 0, errors.Wrap(err, "[rdr] FailLogin - expire counter")
+		}
+	}
+
+	return failed, nil
+}
+
+// LockLogin locks the subject out, the lock doubles on every lockout since the last successful login up to max.
+func (u *userRepository) LockLogin(ctx context.Context, subject string, base time.Duration, max time.Duration) (time.Duration, error) {
+	key := fmt.Sprintf("login:lockouts:%s", subject)
+	lockouts, err := u.cache.Conn().Incr(ctx, key).Result()
+	if nil != err {
+		return 0, errors.Wrap(err, "[rdr] LockLogin - increment lockouts")
+	}
+	if err := u.cache.Conn().Expire(ctx, key, max).Err(); nil != err {
+		return 0, errors.Wrap(err, "[rdr] LockLogin - expire lockouts")
+	}
+
+	lock := base
+	for i := int64(1); i < lockouts && lock < max; i++ {
+		lock *= 2
+	}
+	if lock > max {
+		lock = max
+	}
+
+	pipe := u.cache.Conn().TxPipeline()
+	pipe.Set(ctx, fmt.Sprintf("login:lock:%s", subject), lockouts, lock)
+	pipe.Del(ctx, fmt.Sprintf("login:failed:%s", subject))
+	if _, err := pipe.Exec(ctx); nil != err {
+		return 0, errors.Wrap(err, "[rdr] LockLogin - save lock")
+	}
+
+	return lock, nil
+}
+
+// UnlockLogin removes the lock of the subject and resets its counters.
+func (u *userRepository) UnlockLogin(ctx context.Context, subject string) error {
+	if err := u.cache.Conn().Del(ctx, fmt.Sprintf("login:lock:%s", subject), fmt.Sprintf("login:failed:%s", subject),
+		fmt.Sprintf("login:lockouts:%s", subject)).Err(); nil != err {
+		return errors.Wrap(err, "[rdr] UnlockLogin - delete cache")
+	}
+
+	return nil
+}
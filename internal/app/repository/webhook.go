@@ -0,0 +1,214 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"refactory/notes/internal/app"
+	"refactory/notes/internal/app/model"
+	"time"
+)
+
+type WebhookRepository interface {
+	InsertWebhook(ctx context.Context, webhook *model.Webhook) error
+	ListWebhook(ctx context.Context, userId int, roleId int) ([]model.Webhook, error)
+	DeleteWebhook(ctx context.Context, userId int, id int, roleId int) error
+	FindSubscriber(ctx context.Context, userId int, event string) ([]model.Webhook, error)
+	InsertDelivery(ctx context.Context, delivery *model.WebhookDelivery) error
+	ClaimDelivery(ctx context.Context, limit int, lease time.Duration) ([]model.WebhookDelivery, error)
+	UpdateDelivery(ctx context.Context, delivery *model.WebhookDelivery) error
+	ListDelivery(ctx context.Context, userId int, webhookId int, roleId int) ([]model.WebhookDelivery, error)
+	ReplayDelivery(ctx context.Context, userId int, id int, roleId int) (model.WebhookDelivery, error)
+}
+
+type webhookRepository struct {
+	db *sqlx.DB
+}
+
+func NewWebhookRepository(db *sqlx.DB) WebhookRepository {
+	return &webhookRepository{db: db}
+}
+
+func (w *webhookRepository) InsertWebhook(ctx context.Context, webhook *model.Webhook) error {
+	stmt, err := w.db.PrepareContext(ctx, `INSERT INTO notes.webhooks (user_id, url, secret, events)
+								VALUES ($1, $2, $3, $4) RETURNING id, created_at`)
+	if nil != err {
+		return errors.Wrap(err, "[db] InsertWebhook - prepare statement")
+	}
+	defer stmt.Close()
+
+	if err := stmt.QueryRowContext(ctx, webhook.UserId, webhook.Url, webhook.Secret, pq.Array(webhook.Events)).
+		Scan(&webhook.Id, &webhook.CreatedAt); nil != err {
+		return errors.Wrap(err, "[db] InsertWebhook - insert data")
+	}
+
+	return nil
+}
+
+func (w *webhookRepository) ListWebhook(ctx context.Context, userId int, roleId int) ([]model.Webhook, error) {
+	var result []model.Webhook
+
+	rows, err := w.db.QueryContext(ctx, `SELECT id, user_id, url, events, is_active, created_at FROM notes.webhooks
+								WHERE is_active AND (user_id=$1 OR $2) ORDER BY id`, userId, roleId == model.RoleAdminId)
+	if nil != err {
+		return nil, errors.Wrap(err, "[db] ListWebhook - query")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var webhook model.Webhook
+		if err := rows.Scan(&webhook.Id, &webhook.UserId, &webhook.Url, pq.Array(&webhook.Events), &webhook.IsActive, &webhook.CreatedAt); nil != err {
+			return nil, errors.Wrap(err, "[db] ListWebhook - scan rows")
+		}
+		result = append(result, webhook)
+	}
+
+	return result, nil
+}
+
+func (w *webhookRepository) DeleteWebhook(ctx context.Context, userId int, id int, roleId int) error {
+	rs, err := w.db.ExecContext(ctx, `UPDATE notes.webhooks SET is_active=false WHERE id=$1 AND (user_id=$2 OR $3)`,
+		id, userId, roleId == model.RoleAdminId)
+	if nil != err {
+		return errors.Wrap(err, "[db] DeleteWebhook - exec query delete")
+	}
+
+	deleted, _ := rs.RowsAffected()
+	if deleted == 0 {
+		return app.NotFoundError
+	}
+
+	return nil
+}
+
+// FindSubscriber returns the active webhooks subscribing to the event of the user, the webhooks of regular users only
+// receive their own events while those of active admins receive the events of every user.
+func (w *webhookRepository) FindSubscriber(ctx context.Context, userId int, event string) ([]model.Webhook, error) {
+	var result []model.Webhook
+
+	rows, err := w.db.QueryContext(ctx, `SELECT w.id, w.user_id, w.url, w.secret, w.events FROM notes.webhooks w
+								JOIN notes."user" u ON u.id = w.user_id
+								WHERE w.is_active AND $2 = ANY(w.events) AND (w.user_id=$1 OR (u.role_id=$3 AND u.is_active))`,
+		userId, event, model.RoleAdminId)
+	if nil != err {
+		return nil, errors.Wrap(err, "[db] FindSubscriber - query")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var webhook model.Webhook
+		if err := rows.Scan(&webhook.Id, &webhook.UserId, &webhook.Url, &webhook.Secret, pq.Array(&webhook.Events)); nil != err {
+			return nil, errors.Wrap(err, "[db] FindSubscriber - scan rows")
+		}
+		result = append(result, webhook)
+	}
+
+	return result, nil
+}
+
+func (w *webhookRepository) InsertDelivery(ctx context.Context, delivery *model.WebhookDelivery) error {
+	stmt, err := w.db.PrepareContext(ctx, `INSERT INTO notes.webhook_deliveries (webhook_id, event, payload)
+								VALUES ($1, $2, $3) RETURNING id, status, next_attempt_at, created_at`)
+	if nil != err {
+		return errors.Wrap(err, "[db] InsertDelivery - prepare statement")
+	}
+	defer stmt.Close()
+
+	if err := stmt.QueryRowContext(ctx, delivery.WebhookId, delivery.Event, delivery.Payload).
+		Scan(&delivery.Id, &delivery.Status, &delivery.NextAttemptAt, &delivery.CreatedAt); nil != err {
+		return errors.Wrap(err, "[db] InsertDelivery - insert data")
+	}
+
+	return nil
+}
+
+// ClaimDelivery leases due deliveries so that concurrent workers never send the same delivery twice.
+func (w *webhookRepository) ClaimDelivery(ctx context.Context, limit int, lease time.Duration) ([]model.WebhookDelivery, error) {
+	var result []model.WebhookDelivery
+
+	rows, err := w.db.QueryContext(ctx, `WITH claimed AS (
+									UPDATE notes.webhook_deliveries SET next_attempt_at = now() + $2 * interval '1 second'
+									WHERE id IN (SELECT id FROM notes.webhook_deliveries
+										WHERE status=$3 AND next_attempt_at <= now()
+										ORDER BY next_attempt_at LIMIT $1 FOR UPDATE SKIP LOCKED)
+									RETURNING id, webhook_id, event, payload, attempts)
+								SELECT c.id, c.webhook_id, w.url, w.secret, c.event, c.payload, c.attempts
+								FROM claimed c JOIN notes.webhooks w ON w.id = c.webhook_id`,
+		limit, int(lease.Seconds()), model.DeliveryStatusPending)
+	if nil != err {
+		return nil, errors.Wrap(err, "[db] ClaimDelivery - query")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var delivery model.WebhookDelivery
+		if err := rows.Scan(&delivery.Id, &delivery.WebhookId, &delivery.Url, &delivery.Secret,
+			&delivery.Event, &delivery.Payload, &delivery.Attempts); nil != err {
+			return nil, errors.Wrap(err, "[db] ClaimDelivery - scan rows")
+		}
+		result = append(result, delivery)
+	}
+
+	return result, nil
+}
+
+func (w *webhookRepository) UpdateDelivery(ctx context.Context, delivery *model.WebhookDelivery) error {
+	_, err := w.db.ExecContext(ctx, `UPDATE notes.webhook_deliveries SET status=$2, attempts=$3, response_code=$4,
+								last_error=$5, next_attempt_at=$6, delivered_at=$7 WHERE id=$1`,
+		delivery.Id, delivery.Status, delivery.Attempts, delivery.ResponseCode, delivery.LastError, delivery.NextAttemptAt, delivery.DeliveredAt)
+	if nil != err {
+		return errors.Wrap(err, "[db] UpdateDelivery - exec query update")
+	}
+
+	return nil
+}
+
+func (w *webhookRepository) ListDelivery(ctx context.Context, userId int, webhookId int, roleId int) ([]model.WebhookDelivery, error) {
+	var result []model.WebhookDelivery
+
+	rows, err := w.db.QueryContext(ctx, `SELECT d.id, d.webhook_id, d.event, d.payload, d.status, d.attempts, d.response_code,
+								d.last_error, d.next_attempt_at, d.delivered_at, d.created_at
+								FROM notes.webhook_deliveries d JOIN notes.webhooks w ON w.id = d.webhook_id
+								WHERE d.webhook_id=$1 AND (w.user_id=$2 OR $3) ORDER BY d.id DESC`,
+		webhookId, userId, roleId == model.RoleAdminId)
+	if nil != err {
+		return nil, errors.Wrap(err, "[db] ListDelivery - query")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var delivery model.WebhookDelivery
+		if err := rows.Scan(&delivery.Id, &delivery.WebhookId, &delivery.Event, &delivery.Payload, &delivery.Status,
+			&delivery.Attempts, &delivery.ResponseCode, &delivery.LastError, &delivery.NextAttemptAt,
+			&delivery.DeliveredAt, &delivery.CreatedAt); nil != err {
+			return nil, errors.Wrap(err, "[db] ListDelivery - scan rows")
+		}
+		result = append(result, delivery)
+	}
+
+	return result, nil
+}
+
+// ReplayDelivery queues a fresh copy of an existing delivery, leaving the original record untouched.
+func (w *webhookRepository) ReplayDelivery(ctx context.Context, userId int, id int, roleId int) (model.WebhookDelivery, error) {
+	var result model.WebhookDelivery
+
+	err := w.db.QueryRowContext(ctx, `INSERT INTO notes.webhook_deliveries (webhook_id, event, payload)
+								SELECT d.webhook_id, d.event, d.payload FROM notes.webhook_deliveries d
+								JOIN notes.webhooks w ON w.id = d.webhook_id
+								WHERE d.id=$1 AND w.is_active AND (w.user_id=$2 OR $3)
+								RETURNING id, webhook_id, event, payload, status, attempts, next_attempt_at, created_at`,
+		id, userId, roleId == model.RoleAdminId).
+		Scan(&result.Id, &result.WebhookId, &result.Event, &result.Payload, &result.Status, &result.Attempts,
+			&result.NextAttemptAt, &result.CreatedAt)
+	if nil != err {
+		if sql.ErrNoRows == err {
+			return result, app.NotFoundError
+		}
+		return result, errors.Wrap(err, "[db] ReplayDelivery - insert data")
+	}
+
+	return result, nil
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"refactory/notes/internal/app"
+	"refactory/notes/internal/app/model"
+	"refactory/notes/internal/app/repository"
+	"refactory/notes/internal/security/token"
+	"time"
+)
+
+type AccessTokenService interface {
+	CreateAccessToken(ctx context.Context, userId int, req model.AccessTokenRequest) (*model.AccessTokenResponse, error)
+	ListAccessToken(ctx context.Context, userId int) ([]*model.AccessTokenResponse, error)
+	RevokeAccessToken(ctx context.Context, userId int, id int) error
+}
+
+type accessTokenService struct {
+	repo repository.AccessTokenRepository
+}
+
+func NewAccessTokenService(repo repository.AccessTokenRepository) AccessTokenService {
+	return &accessTokenService{repo: repo}
+}
+
+// CreateAccessToken issues a personal access token, the raw token is only returned here and only its hash is stored.
+func (a *accessTokenService) CreateAccessToken(ctx context.Context, userId int, req model.AccessTokenRequest) (*model.AccessTokenResponse, error) {
+	if nil != req.ExpiresAt {
+		if !req.ExpiresAt.After(time.Now()) {
+			return nil, app.BadRequestError
+		}
+		// the column has no time zone, the offset of the client would otherwise be dropped
+		expiresAt := req.ExpiresAt.UTC()
+		req.ExpiresAt = &expiresAt
+	}
+
+	raw, hash, err := token.NewAccessToken()
+	if nil != err {
+		return nil, err
+	}
+
+	accessToken := model.AccessToken{UserId: userId, Name: req.Name, Hash: hash, Scopes: req.Scopes, ExpiresAt: req.ExpiresAt}
+	if err := a.repo.InsertAccessToken(ctx, &accessToken); nil != err {
+		return nil, err
+	}
+
+	return model.NewAccessTokenResponse(accessToken, raw), nil
+}
+
+func (a *accessTokenService) ListAccessToken(ctx context.Context, userId int) ([]*model.AccessTokenResponse, error) {
+	var response []*model.AccessTokenResponse
+	result, err := a.repo.ListAccessToken(ctx, userId)
+	if nil != err {
+		return nil, err
+	}
+
+	for _, accessToken := range result {
+		response = append(response, model.NewAccessTokenResponse(accessToken, ""))
+	}
+
+	return response, nil
+}
+
+func (a *accessTokenService) RevokeAccessToken(ctx context.Context, userId int, id int) error {
+	return a.repo.RevokeAccessToken(ctx, userId, id)
+}
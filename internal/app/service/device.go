@@ -0,0 +1,45 @@
+package service
+
+import (
+	"context"
+	"refactory/notes/internal/app/model"
+	"refactory/notes/internal/security/token"
+)
+
+// ListDevice returns the device sessions of the user, the one the request comes from is marked as current.
+func (a *userService) ListDevice(ctx context.Context, session token.Token) ([]model.DeviceResponse, error) {
+	devices, err := a.repo.ListDevice(ctx, session.UserId)
+	if nil != err {
+		return nil, err
+	}
+
+	result := make([]model.DeviceResponse, 0, len(devices))
+	for _, device := range devices {
+		result = append(result, model.NewDeviceResponse(device, device.Id == session.Sid))
+	}
+
+	return result, nil
+}
+
+func (a *userService) RevokeDevice(ctx context.Context, session token.Token, id string) error {
+	return a.repo.RevokeDevice(ctx, session.UserId, id)
+}
+
+// RevokeOtherDevices signs the user out everywhere except the device session of the request.
+func (a *userService) RevokeOtherDevices(ctx context.Context, session token.Token) error {
+	devices, err := a.repo.ListDevice(ctx, session.UserId)
+	if nil != err {
+		return err
+	}
+
+	for _, device := range devices {
+		if device.Id == session.Sid {
+			continue
+		}
+		if err := a.repo.RevokeDevice(ctx, session.UserId, device.Id); nil != err {
+			return err
+		}
+	}
+
+	return nil
+}
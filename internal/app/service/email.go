@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	crand "crypto/rand"
+	"crypto/subtle"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/log"
+	"math/big"
+	"refactory/notes/internal/app"
+	"refactory/notes/internal/app/model"
+	"refactory/notes/internal/config"
+	"refactory/notes/internal/mail"
+	"refactory/notes/internal/security/token"
+	"strconv"
+	"time"
+)
+
+// startEmailChange mails a confirmation code to the new address and a notice to the current one,
+// so that the owner learns about a change they did not ask for while it can still be cancelled.
+func (a *userService) startEmailChange(ctx context.Context, u *model.User, email string) error {
+	n, err := crand.Int(crand.Reader, big.NewInt(900000))
+	if nil != err {
+		return err
+	}
+	code := 100000 + int(n.Int64())
+
+	change := model.EmailChange{
+		Email:     email,
+		CodeHash:  hashToken(strconv.Itoa(code)),
+		ExpiresAt: time.Now().Add(config.Cfg().VerificationTTL).Unix(),
+	}
+	if err := a.repo.SaveEmailChange(ctx, u.Id, change, config.Cfg().VerificationTTL); nil != err {
+		return err
+	}
+
+	go func() {
+		body := fmt.Sprintf("hello %s, \n this is your code to confirm your new email address: \n %d \n the code expires at %s",
+			u.Username, code, time.Unix(change.ExpiresAt, 0).UTC().Format(time.RFC1123))
+		if err := mail.SentMail(email, "Confirm Email Change", body); nil != err {
+			log.Error(err)
+		}
+
+		if u.Email == "" {
+			return
+		}
+		body = fmt.Sprintf("hello %s, \n a change of your email address to %s was requested. \n it only takes effect once confirmed from the new address. \n if this was not you, cancel the change and change your password.",
+			u.Username, email)
+		if err := mail.SentMail(u.Email, "Email Change Requested", body); nil != err {
+			log.Error(err)
+		}
+	}()
+
+	return nil
+}
+
+// VerifyEmailChange switches to the pending email address when the code matches, too many wrong codes drop the change.
+func (a *userService) VerifyEmailChange(ctx context.Context, session token.Token, code int) (*model.UserResponse, error) {
+	change, err := a.repo.FindEmailChange(ctx, session.UserId)
+	if nil != err {
+		if app.NotFoundError == errors.Cause(err) {
+			return nil, app.InvalidCodeError
+		}
+		return nil, err
+	}
+
+	if change.Attempts >= config.Cfg().VerificationAttempt {
+		return nil, app.TooManyAttemptsError
+	}
+
+	if subtle.ConstantTimeCompare([]byte(change.CodeHash), []byte(hashToken(strconv.Itoa(code)))) != 1 {
+		attempts, err := a.repo.FailEmailChange(ctx, session.UserId)
+		if nil != err {
+			return nil, err
+		}
+		if attempts >= config.Cfg().VerificationAttempt {
+			if err := a.repo.DeleteEmailChange(ctx, session.UserId); nil != err && app.NotFoundError != errors.Cause(err) {
+				return nil, err
+			}
+			return nil, app.TooManyAttemptsError
+		}
+		return nil, app.InvalidCodeError
+	}
+
+	if err := a.repo.UpdateEmail(ctx, session.UserId, change.Email); nil != err {
+		return nil, err
+	}
+	if err := a.repo.DeleteEmailChange(ctx, session.UserId); nil != err && app.NotFoundError != errors.Cause(err) {
+		return nil, err
+	}
+
+	return a.DetailUser(ctx, session.UserId)
+}
+
+func (a *userService) CancelEmailChange(ctx context.Context, session token.Token) error {
+	return a.repo.DeleteEmailChange(ctx, session.UserId)
+}
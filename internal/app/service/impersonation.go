@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/log"
+	"refactory/notes/internal/app"
+	"refactory/notes/internal/app/model"
+	"refactory/notes/internal/app/repository"
+	"refactory/notes/internal/config"
+	"refactory/notes/internal/security/token"
+	"time"
+)
+
+const impersonationListLimit = 100
+
+type ImpersonationService interface {
+	Impersonate(ctx context.Context, session token.Token, userId int, req model.ImpersonateRequest) (*model.ImpersonateResponse, error)
+	EndImpersonation(ctx context.Context, id int) error
+	EndCurrentImpersonation(ctx context.Context, session token.Token) error
+	ListImpersonation(ctx context.Context, userId int) ([]*model.ImpersonationResponse, error)
+}
+
+type impersonationService struct {
+	repo repository.ImpersonationRepository
+	user repository.UserRepository
+}
+
+func NewImpersonationService(repo repository.ImpersonationRepository, user repository.UserRepository) ImpersonationService {
+	return &impersonationService{repo: repo, user: user}
+}
+
+// Impersonate issues a token acting as the user for impersonation_ttl, it carries the admin in its act claim and cannot be refreshed.
+// Admins cannot be impersonated, so the token never grants more than the admin already has.
+func (i *impersonationService) Impersonate(ctx context.Context, session token.Token, userId int, req model.ImpersonateRequest) (*model.ImpersonateResponse, error) {
+	if session.UserId == userId {
+		return nil, app.BadRequestError
+	}
+
+	detail, err := i.user.DetailUser(ctx, userId)
+	if nil != err {
+		return nil, err
+	}
+	u, err := i.user.FindUser(ctx, detail.Username)
+	if nil != err {
+		if sql.ErrNoRows == errors.Cause(err) {
+			return nil, app.NotFoundError
+		}
+		return nil, err
+	}
+	if !u.IsVerified || u.Role == model.RoleAdminId {
+		return nil, app.UnauthorizedError
+	}
+
+	jti, err := token.RandomString(16)
+	if nil != err {
+		return nil, err
+	}
+
+	impersonation := &model.Impersonation{AdminId: session.UserId, UserId: u.Id, Reason: req.Reason, Jti: jti,
+		ExpiresAt: time.Now().Add(config.Cfg().ImpersonationTTL)}
+	if err := i.repo.InsertImpersonation(ctx, impersonation); nil != err {
+		return nil, err
+	}
+
+	actor := token.Actor{Sub: session.Username, UserId: session.UserId, ImpersonationId: impersonation.Id}
+	access, err := token.GenerateImpersonation(model.Session{UserId: u.Id, Username: u.Username, RoleId: u.Role}, jti, actor, impersonation.ExpiresAt)
+	if nil != err {
+		return nil, err
+	}
+	log.Infof("admin %s impersonates %s: %s", session.Username, u.Username, req.Reason)
+
+	return &model.ImpersonateResponse{Id: impersonation.Id, Token: access, ExpiresAt: impersonation.ExpiresAt}, nil
+}
+
+// EndImpersonation ends the impersonation and denies its token for the rest of its lifetime.
+func (i *impersonationService) EndImpersonation(ctx context.Context, id int) error {
+	impersonation, err := i.repo.EndImpersonation(ctx, id)
+	if nil != err {
+		return err
+	}
+
+	return i.user.DenyToken(ctx, impersonation.Jti, time.Until(impersonation.ExpiresAt))
+}
+
+// EndCurrentImpersonation ends the impersonation the token of the request belongs to.
+func (i *impersonationService) EndCurrentImpersonation(ctx context.Context, session token.Token) error {
+	if nil == session.Act {
+		return app.NotFoundError
+	}
+
+	return i.EndImpersonation(ctx, session.Act.ImpersonationId)
+}
+
+// ListImpersonation returns the latest impersonations with the requests made during them, a zero user lists every user.
+func (i *impersonationService) ListImpersonation(ctx context.Context, userId int) ([]*model.ImpersonationResponse, error) {
+	responses := []*model.ImpersonationResponse{}
+	result, err := i.repo.ListImpersonation(ctx, userId, impersonationListLimit)
+	if nil != err {
+		return nil, err
+	}
+
+	for _, r := range result {
+		responses = append(responses, model.NewImpersonationResponse(r))
+	}
+
+	return responses, nil
+}
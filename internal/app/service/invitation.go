@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/prometheus/common/log"
+	"refactory/notes/internal/app"
+	"refactory/notes/internal/app/model"
+	"refactory/notes/internal/app/repository"
+	"refactory/notes/internal/config"
+	"refactory/notes/internal/mail"
+	"refactory/notes/internal/security/token"
+	"time"
+)
+
+type InvitationService interface {
+	CreateInvitation(ctx context.Context, session token.Token, req model.InvitationRequest) (*model.InvitationResponse, error)
+	ListInvitation(ctx context.Context) ([]*model.InvitationResponse, error)
+	ResendInvitation(ctx context.Context, id int) (*model.InvitationResponse, error)
+	RevokeInvitation(ctx context.Context, id int) error
+}
+
+type invitationService struct {
+	repo repository.InvitationRepository
+}
+
+func NewInvitationService(repo repository.InvitationRepository) InvitationService {
+	return &invitationService{repo: repo}
+}
+
+// CreateInvitation mails a signup link to the email, registering with it gives the user the role of the invitation.
+func (i *invitationService) CreateInvitation(ctx context.Context, session token.Token, req model.InvitationRequest) (*model.InvitationResponse, error) {
+	expiresAt := time.Now().Add(config.Cfg().InvitationTTL)
+	if nil != req.ExpiresAt {
+		if req.ExpiresAt.Before(time.Now()) {
+			return nil, app.BadRequestError
+		}
+		expiresAt = *req.ExpiresAt
+	}
+	// the column has no time zone, the offset of the client would otherwise be dropped
+	expiresAt = expiresAt.UTC()
+
+	raw, err := token.RandomString(32)
+	if nil != err {
+		return nil, err
+	}
+
+	invitation := &model.Invitation{Email: req.Email, RoleId: req.RoleId, Hash: hashToken(raw), InvitedBy: session.UserId, ExpiresAt: expiresAt}
+	if err := i.repo.InsertInvitation(ctx, invitation); nil != err {
+		return nil, err
+	}
+	sendInvitation(*invitation, raw)
+
+	return model.NewInvitationResponse(*invitation), nil
+}
+
+func (i *invitationService) ListInvitation(ctx context.Context) ([]*model.InvitationResponse, error) {
+	var responses []*model.InvitationResponse
+	result, err := i.repo.ListInvitation(ctx)
+	if nil != err {
+		return nil, err
+	}
+
+	for _, r := range result {
+		responses = append(responses, model.NewInvitationResponse(r))
+	}
+
+	return responses, nil
+}
+
+// ResendInvitation mails a new link valid for another invitation_ttl, the link sent before stops working.
+func (i *invitationService) ResendInvitation(ctx context.Context, id int) (*model.InvitationResponse, error) {
+	raw, err := token.RandomString(32)
+	if nil != err {
+		return nil, err
+	}
+
+	invitation, err := i.repo.RenewInvitation(ctx, id, hashToken(raw), time.Now().Add(config.Cfg().InvitationTTL))
+	if nil != err {
+		return nil, err
+	}
+	sendInvitation(*invitation, raw)
+
+	return model.NewInvitationResponse(*invitation), nil
+}
+
+func (i *invitationService) RevokeInvitation(ctx context.Context, id int) error {
+	return i.repo.RevokeInvitation(ctx, id)
+}
+
+func sendInvitation(invitation model.Invitation, raw string) {
+	go func() {
+		body := fmt.Sprintf("hello, \n you are invited to join RSP Notes as %s. \n sign up with this link: \n %s?token=%s \n the invitation expires at %s",
+			invitation.RoleName, config.Cfg().InvitationUrl, raw, invitation.ExpiresAt.UTC().Format(time.RFC1123))
+		if err := mail.SentMail(invitation.Email, "Invitation", body); nil != err {
+			log.Error(err)
+		}
+	}()
+}
@@ -11,15 +11,21 @@ type MediaService interface {
 }
 
 type mediaService struct {
-	repo repository.MediaRepository
+	repo  repository.MediaRepository
+	quota QuotaService
 }
 
-func NewMediaService(repo repository.MediaRepository) MediaService {
-	return &mediaService{repo: repo}
+func NewMediaService(repo repository.MediaRepository, quota QuotaService) MediaService {
+	return &mediaService{repo: repo, quota: quota}
 }
 
 func (m *mediaService) SaveMedia(ctx context.Context, userId int, mime string, file []byte) (int, error) {
-	return m.repo.InsertMedia(ctx, userId, mime, file)
+	quota, err := m.quota.CheckMedia(ctx, userId, int64(len(file)))
+	if nil != err {
+		return 0, err
+	}
+
+	return m.repo.InsertMedia(ctx, userId, mime, file, quota.MaxMediaBytes)
 }
 
 func (m *mediaService) GetMedia(ctx context.Context, id int) (string, []byte, error) {
@@ -2,45 +2,64 @@ package service
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
 	"github.com/lib/pq"
 	"refactory/notes/internal/app"
 	"refactory/notes/internal/app/model"
 	"refactory/notes/internal/app/repository"
+	"strconv"
 	"strings"
 )
 
 type NotesService interface {
 	CreateNotes(ctx context.Context, notes *model.Notes) (*model.NotesResponse, error)
-	GetNotes(ctx context.Context, userId int, roleId int) ([]*model.NotesResponse, error)
-	DetailNotes(ctx context.Context, userId int, id int, roleId int) (*model.NotesResponse, error)
+	GetNotes(ctx context.Context, userId int, orgId int, roleId int) ([]*model.NotesResponse, error)
+	DetailNotes(ctx context.Context, userId int, orgId int, id int, roleId int) (*model.NotesResponse, error)
 	EditNotes(ctx context.Context, notes *model.Notes) (*model.NotesResponse, error)
-	DeleteNotes(ctx context.Context, userId int, id int, secret string) error
+	DeleteNotes(ctx context.Context, userId int, orgId int, id int, secret string) error
 	ReActiveNotes(ctx context.Context, id int) error
+	NotesStats(ctx context.Context, userId int, orgId int, days int) (*model.NotesStats, error)
+	Sync(ctx context.Context, userId int, orgId int, since string) (*model.SyncResponse, error)
 }
 
+const (
+	syncPageSize     = 500
+	syncTokenVersion = "v2"
+)
+
 type notesService struct {
-	repo repository.NotesRepository
+	repo    repository.NotesRepository
+	webhook WebhookService
+	quota   QuotaService
 }
 
-func NewNotesService(repo repository.NotesRepository) NotesService {
-	return &notesService{repo: repo}
+func NewNotesService(repo repository.NotesRepository, webhook WebhookService, quota QuotaService) NotesService {
+	return &notesService{repo: repo, webhook: webhook, quota: quota}
 }
 
 func (n *notesService) CreateNotes(ctx context.Context, notes *model.Notes) (*model.NotesResponse, error) {
-	if err := n.repo.InsertNotes(ctx, notes); nil != err {
+	quota, err := n.quota.CheckNotes(ctx, notes.UserId, len(notes.Body), true)
+	if nil != err {
+		return nil, err
+	}
+
+	if err := n.repo.InsertNotes(ctx, notes, quota.MaxNotes); nil != err {
 		if vErr, ok := err.(*pq.Error); ok && vErr.Code == "23505" {
 			return nil, app.Error{Code: app.DuplicateCode.Int(), Message: fmt.Sprintf("duplicate value for field %s", vErr.Column)}
 		} else {
 			return nil, err
 		}
 	}
+
+	n.webhook.Emit(ctx, notes.UserId, model.EventNoteCreated, model.NotesPayload{Id: notes.Id, UserId: notes.UserId, Type: notes.Type, Title: notes.Title, Body: notes.Body})
+
 	return model.NewNotesResponse(notes.Id, notes.Type, notes.Title, notes.Body, notes.Secret), nil
 }
 
-func (n *notesService) GetNotes(ctx context.Context, userId int, roleId int) ([]*model.NotesResponse, error) {
+func (n *notesService) GetNotes(ctx context.Context, userId int, orgId int, roleId int) ([]*model.NotesResponse, error) {
 	var responses []*model.NotesResponse
-	result, err := n.repo.GetNotes(ctx, userId, roleId)
+	result, err := n.repo.GetNotes(ctx, userId, orgId, roleId)
 	if nil != err {
 		return nil, err
 	}
@@ -56,8 +75,8 @@ func (n *notesService) GetNotes(ctx context.Context, userId int, roleId int) ([]
 	return responses, nil
 }
 
-func (n *notesService) DetailNotes(ctx context.Context, userId int, id int, roleId int) (*model.NotesResponse, error) {
-	result, err := n.repo.DetailNotes(ctx, userId, id, roleId)
+func (n *notesService) DetailNotes(ctx context.Context, userId int, orgId int, id int, roleId int) (*model.NotesResponse, error) {
+	result, err := n.repo.DetailNotes(ctx, userId, orgId, id, roleId)
 	if nil != err {
 		return nil, err
 	}
@@ -66,7 +85,7 @@ func (n *notesService) DetailNotes(ctx context.Context, userId int, id int, role
 }
 
 func (n *notesService) EditNotes(ctx context.Context, notes *model.Notes) (*model.NotesResponse, error) {
-	s, err := n.repo.GetSecret(ctx, notes.Id)
+	s, err := n.repo.GetSecret(ctx, notes.OrganizationId, notes.Id)
 	if nil != err {
 		return nil, err
 	}
@@ -75,15 +94,21 @@ func (n *notesService) EditNotes(ctx context.Context, notes *model.Notes) (*mode
 		return nil, app.UnauthorizedError
 	}
 
+	if _, err := n.quota.CheckNotes(ctx, notes.UserId, len(notes.Body), false); nil != err {
+		return nil, err
+	}
+
 	if err := n.repo.UpdateNotes(ctx, notes); nil != err {
 		return nil, err
 	}
 
+	n.webhook.Emit(ctx, notes.UserId, model.EventNoteUpdated, model.NotesPayload{Id: notes.Id, UserId: notes.UserId, Type: notes.Type, Title: notes.Title, Body: notes.Body})
+
 	return model.NewNotesResponse(notes.Id, notes.Type, notes.Title, notes.Body, notes.Secret), nil
 }
 
-func (n *notesService) DeleteNotes(ctx context.Context, userId int, id int, secret string) error {
-	s, err := n.repo.GetSecret(ctx, id)
+func (n *notesService) DeleteNotes(ctx context.Context, userId int, orgId int, id int, secret string) error {
+	s, err := n.repo.GetSecret(ctx, orgId, id)
 	if nil != err {
 		return nil
 	}
@@ -92,9 +117,88 @@ func (n *notesService) DeleteNotes(ctx context.Context, userId int, id int, secr
 		return app.UnauthorizedError
 	}
 
-	return n.repo.DeleteNotes(ctx, userId, id)
+	if err := n.repo.DeleteNotes(ctx, userId, orgId, id); nil != err {
+		return err
+	}
+
+	n.webhook.Emit(ctx, userId, model.EventNoteDeleted, model.NotesPayload{Id: id, UserId: userId})
+
+	return nil
 }
 
 func (n *notesService) ReActiveNotes(ctx context.Context, id int) error {
 	return n.repo.ReActiveNotes(ctx, id)
 }
+
+func (n *notesService) NotesStats(ctx context.Context, userId int, orgId int, days int) (*model.NotesStats, error) {
+	result, err := n.repo.NotesStats(ctx, userId, orgId, days)
+	if nil != err {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// Sync returns the notes changed since the change token, deleted notes are returned as tombstones.
+// An empty token starts a full sync, clients keep requesting with the returned token while has_more is set.
+func (n *notesService) Sync(ctx context.Context, userId int, orgId int, since string) (*model.SyncResponse, error) {
+	cursor, err := decodeSyncToken(since)
+	if nil != err {
+		return nil, app.BadRequestError
+	}
+
+	result, err := n.repo.ChangedNotes(ctx, userId, orgId, cursor, syncPageSize+1)
+	if nil != err {
+		return nil, err
+	}
+
+	response := &model.SyncResponse{Notes: []*model.NotesResponse{}, Deleted: []int{}}
+	if len(result) > syncPageSize {
+		response.HasMore = true
+		result = result[:syncPageSize]
+	}
+
+	for _, r := range result {
+		if r.IsActive {
+			response.Notes = append(response.Notes, model.NewNotesResponse(r.Id, r.Type, r.Title, r.Body, r.Secret))
+		} else {
+			response.Deleted = append(response.Deleted, r.Id)
+		}
+		cursor = model.ChangeCursor{Txid: r.ChangeTxid, Seq: r.ChangeSeq}
+	}
+	response.Token = encodeSyncToken(cursor)
+
+	return response, nil
+}
+
+func encodeSyncToken(cursor model.ChangeCursor) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%d:%d", syncTokenVersion, cursor.Txid, cursor.Seq)))
+}
+
+// decodeSyncToken also accepts v1 tokens holding only the change sequence, they were issued before notes recorded
+// their transaction so the cursor starts before every transaction and notes changed since are sent again.
+func decodeSyncToken(token string) (model.ChangeCursor, error) {
+	var cursor model.ChangeCursor
+	if token == "" {
+		return cursor, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if nil != err {
+		return cursor, err
+	}
+
+	parts := strings.Split(string(raw), ":")
+	switch {
+	case len(parts) == 2 && parts[0] == "v1":
+		cursor.Seq, err = strconv.ParseInt(parts[1], 10, 64)
+	case len(parts) == 3 && parts[0] == syncTokenVersion:
+		if cursor.Txid, err = strconv.ParseInt(parts[1], 10, 64); nil == err {
+			cursor.Seq, err = strconv.ParseInt(parts[2], 10, 64)
+		}
+	default:
+		err = app.BadRequestError
+	}
+
+	return cursor, err
+}
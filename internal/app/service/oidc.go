@@ -0,0 +1,276 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/log"
+	"refactory/notes/internal/app"
+	"refactory/notes/internal/app/model"
+	"refactory/notes/internal/config"
+	"refactory/notes/internal/security/oidc"
+	"refactory/notes/internal/security/token"
+	"strings"
+)
+
+const (
+	maxUsernameLength  = 120
+	provisionAttempts  = 3
+	defaultSsoUsername = "user"
+)
+
+// OidcLogin starts the authorization code flow and returns the URL of the identity provider.
+func (a *userService) OidcLogin(ctx context.Context) (*model.OidcAuthorization, error) {
+	return a.oidcAuthorize(ctx, 0)
+}
+
+// OidcLink starts the authorization code flow for a signed in user, the callback links the provider account to theirs.
+func (a *userService) OidcLink(ctx context.Context, session token.Token) (*model.OidcAuthorization, error) {
+	return a.oidcAuthorize(ctx, session.UserId)
+}
+
+// OidcCallback redeems the authorization code, provisions the user on the first login and signs them in.
+// The binding has to come from the browser that started the flow, so a callback URL started by someone else
+// neither signs the browser into their account nor links the identity of the browser user to it.
+// The role of the user follows the provider groups on every login, before users with 2FA get the same challenge as on Login.
+func (a *userService) OidcCallback(ctx context.Context, state string, code string, binding string, client model.Client) (*model.LoginResponse, error) {
+	oidcState, err := a.identity.ConsumeOidcState(ctx, state)
+	if nil != err {
+		if app.NotFoundError == errors.Cause(err) {
+			return nil, app.UnauthenticateError
+		}
+		return nil, err
+	}
+	if binding == "" || subtle.ConstantTimeCompare([]byte(hashToken(binding)), []byte(oidcState.Binding)) != 1 {
+		return nil, app.UnauthenticateError
+	}
+
+	claims, err := a.provider.Exchange(ctx, code, oidcState.Verifier, oidcState.Nonce)
+	if nil != err {
+		log.Error(err)
+		return nil, app.UnauthenticateError
+	}
+	// the email is not unique, only an address the provider verified is taken over
+	if !claims.EmailVerified {
+		claims.Email = ""
+	}
+
+	if oidcState.LinkUserId != 0 {
+		if err := a.identity.LinkIdentity(ctx, oidcState.LinkUserId, claims.Issuer, claims.Subject, claims.Email); nil != err {
+			return nil, err
+		}
+	}
+
+	u, err := a.identity.FindIdentity(ctx, claims.Issuer, claims.Subject)
+	if nil != err {
+		if app.NotFoundError != errors.Cause(err) {
+			return nil, err
+		}
+		if u, err = a.provisionUser(ctx, claims); nil != err {
+			return nil, err
+		}
+	} else if err := a.syncRole(ctx, u, claims.Groups); nil != err {
+		return nil, err
+	}
+
+	if !u.IsVerified || !u.IsActive {
+		return nil, app.UnauthorizedError
+	}
+	if u.TotpEnabled {
+		return a.challengeTwoFactor(ctx, u)
+	}
+
+	session := model.Session{
+		UserId:     u.Id,
+		Email:      u.Email,
+		Username:   u.Username,
+		RoleId:     u.Role,
+		IsVerified: u.IsVerified,
+		IsActive:   u.IsActive,
+	}
+
+	return a.issueToken(ctx, session, "", client)
+}
+
+func (a *userService) oidcAuthorize(ctx context.Context, linkUserId int) (*model.OidcAuthorization, error) {
+	if !a.provider.Enabled() {
+		return nil, app.NotFoundError
+	}
+
+	state, err := token.RandomString(16)
+	if nil != err {
+		return nil, err
+	}
+	nonce, err := token.RandomString(16)
+	if nil != err {
+		return nil, err
+	}
+	verifier, err := token.RandomString(32)
+	if nil != err {
+		return nil, err
+	}
+	binding, err := token.RandomString(32)
+	if nil != err {
+		return nil, err
+	}
+
+	url, err := a.provider.AuthCodeURL(ctx, state, nonce, verifier)
+	if nil != err {
+		return nil, err
+	}
+
+	oidcState := model.OidcState{Nonce: nonce, Verifier: verifier, LinkUserId: linkUserId, Binding: hashToken(binding)}
+	if err := a.identity.SaveOidcState(ctx, state, oidcState, config.Cfg().OidcStateTTL); nil != err {
+		return nil, err
+	}
+
+	return &model.OidcAuthorization{Url: url, Binding: binding}, nil
+}
+
+// syncRole assigns the role the provider groups map to, a user whose groups no longer map to any role falls back to
+// the default role when their current role is one the mapping hands out. Their tokens are revoked on a change.
+func (a *userService) syncRole(ctx context.Context, u *model.User, groups []string) error {
+	role := model.Role{Id: model.RoleUserId, Name: model.RoleUserName}
+	if name := mapGroups(groups); name != "" {
+		if name == u.RoleName {
+			return nil
+		}
+		found, err := a.role.FindRoleByName(ctx, name)
+		if nil != err {
+			log.Error(errors.Wrapf(err, "mapping provider groups to role %s", name))
+			return nil
+		}
+		role = found
+	} else if u.Role == role.Id || !mappedRole(u.RoleName) {
+		return nil
+	}
+
+	if err := a.role.AssignRole(ctx, u.Id, role.Id); nil != err {
+		return err
+	}
+	if err := a.repo.RevokeTokens(ctx, u.Id); nil != err {
+		return err
+	}
+	u.Role, u.RoleName = role.Id, role.Name
+
+	return nil
+}
+
+// provisionUser creates the local account of a provider identity, in invite only mode it takes the role of the invitation it accepts.
+func (a *userService) provisionUser(ctx context.Context, claims *oidc.Claims) (*model.User, error) {
+	role := model.RoleUserId
+	if name := mapGroups(claims.Groups); name != "" {
+		if r, err := a.role.FindRoleByName(ctx, name); nil == err {
+			role = r.Id
+		}
+	}
+
+	// with invite only registration the verified email of the identity needs a pending invitation
+	if !config.Cfg().InviteOnly {
+		return a.provisionIdentity(ctx, claims, role)
+	}
+	if !claims.EmailVerified || claims.Email == "" {
+		return nil, app.UnauthorizedError
+	}
+	invitation, err := a.invitation.ClaimInvitationByEmail(ctx, claims.Email)
+	if nil != err {
+		if app.NotFoundError == errors.Cause(err) {
+			return nil, app.UnauthorizedError
+		}
+		return nil, err
+	}
+
+	u, err := a.provisionIdentity(ctx, claims, invitation.RoleId)
+	if nil != err {
+		a.releaseInvitation(ctx, invitation)
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// provisionIdentity adds a random suffix to the username while it is taken.
+func (a *userService) provisionIdentity(ctx context.Context, claims *oidc.Claims, role int) (*model.User, error) {
+	username := ssoUsername(claims)
+	for i := 0; i < provisionAttempts; i++ {
+		u := model.NewUser(0, claims.GivenName, claims.FamilyName, claims.Email, username, "", "", role)
+		err := a.identity.ProvisionUser(ctx, u, claims.Issuer, claims.Subject)
+		if nil == err {
+			a.webhook.Emit(ctx, u.Id, model.EventUserVerified, model.UserPayload{Id: u.Id, Username: u.Username})
+			return u, nil
+		}
+		if app.DuplicateError != errors.Cause(err) {
+			return nil, err
+		}
+
+		suffix, err := token.RandomString(3)
+		if nil != err {
+			return nil, err
+		}
+		username = fmt.Sprintf("%s%s", ssoUsername(claims), suffix)
+	}
+
+	return nil, app.DuplicateError
+}
+
+// mapGroups returns the role of the first mapping matching one of the groups, oidc_role_mapping is a comma separated
+// list of group:role pairs such as engineering:moderator,it-admins:admin.
+func mapGroups(groups []string) string {
+	for _, mapping := range roleMappings() {
+		for _, group := range groups {
+			if group == mapping[0] {
+				return mapping[1]
+			}
+		}
+	}
+
+	return ""
+}
+
+// mappedRole reports whether one of the groups of oidc_role_mapping maps to the role.
+func mappedRole(role string) bool {
+	for _, mapping := range roleMappings() {
+		if role == mapping[1] {
+			return true
+		}
+	}
+
+	return false
+}
+
+func roleMappings() [][]string {
+	var result [][]string
+	for _, pair := range strings.Split(config.Cfg().OidcRoleMapping, ",") {
+		if mapping := strings.SplitN(strings.TrimSpace(pair), ":", 2); len(mapping) == 2 {
+			result = append(result, mapping)
+		}
+	}
+
+	return result
+}
+
+// ssoUsername derives an alphanumeric username from the preferred username or the email of the identity.
+func ssoUsername(claims *oidc.Claims) string {
+	source := claims.PreferredUsername
+	if source == "" {
+		source = strings.Split(claims.Email, "@")[0]
+	}
+
+	var b strings.Builder
+	for _, r := range source {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		}
+	}
+
+	username := b.String()
+	if username == "" {
+		username = defaultSsoUsername
+	}
+	if len(username) > maxUsernameLength {
+		username = username[:maxUsernameLength]
+	}
+
+	return username
+}
@@ -0,0 +1,365 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/url"
+	"refactory/notes/internal/app"
+	"refactory/notes/internal/app/model"
+	"refactory/notes/internal/app/repository"
+	"refactory/notes/internal/config"
+	"refactory/notes/internal/security/oidc"
+	"refactory/notes/internal/security/oidc/oidctest"
+	"refactory/notes/internal/security/token"
+	"testing"
+	"time"
+)
+
+// fakeIdentityRepository keeps states, identities and users in memory, the embedded interface makes unexpected calls panic.
+type fakeIdentityRepository struct {
+	repository.IdentityRepository
+	states     map[string]model.OidcState
+	users      map[int]*model.User
+	identities map[string]int
+	links      []string
+}
+
+func newFakeIdentityRepository(users ...*model.User) *fakeIdentityRepository {
+	f := &fakeIdentityRepository{states: map[string]model.OidcState{}, users: map[int]*model.User{}, identities: map[string]int{}}
+	for _, u := range users {
+		f.users[u.Id] = u
+	}
+	return f
+}
+
+func (f *fakeIdentityRepository) SaveOidcState(ctx context.Context, state string, oidcState model.OidcState, ttl time.Duration) error {
+	f.states[state] = oidcState
+	return nil
+}
+
+func (f *fakeIdentityRepository) ConsumeOidcState(ctx context.Context, state string) (model.OidcState, error) {
+	oidcState, ok := f.states[state]
+	if !ok {
+		return oidcState, app.NotFoundError
+	}
+	delete(f.states, state)
+	return oidcState, nil
+}
+
+func (f *fakeIdentityRepository) FindIdentity(ctx context.Context, issuer string, subject string) (*model.User, error) {
+	id, ok := f.identities[issuer+"|"+subject]
+	if !ok {
+		return nil, app.NotFoundError
+	}
+	u := *f.users[id]
+	return &u, nil
+}
+
+func (f *fakeIdentityRepository) LinkIdentity(ctx context.Context, userId int, issuer string, subject string, email string) error {
+	if _, ok := f.identities[issuer+"|"+subject]; ok {
+		return app.DuplicateError
+	}
+	f.identities[issuer+"|"+subject] = userId
+	f.links = append(f.links, fmt.Sprintf("%d:%s:%s", userId, subject, email))
+	return nil
+}
+
+func (f *fakeIdentityRepository) ProvisionUser(ctx context.Context, user *model.User, issuer string, subject string) error {
+	user.Id = len(f.users) + 100
+	user.RoleName = model.RoleUserName
+	user.IsVerified, user.IsActive = true, true
+	f.users[user.Id] = user
+	f.identities[issuer+"|"+subject] = user.Id
+	return nil
+}
+
+type fakeUserRepository struct {
+	repository.UserRepository
+	refreshTokens int
+	revoked       []int
+}
+
+func (f *fakeUserRepository) SaveRefreshToken(ctx context.Context, hash string, refresh model.RefreshToken) error {
+	f.refreshTokens++
+	return nil
+}
+
+func (f *fakeUserRepository) SaveDevice(ctx context.Context, userId int, device model.Device) error {
+	return nil
+}
+
+func (f *fakeUserRepository) RevokeTokens(ctx context.Context, userId int) error {
+	f.revoked = append(f.revoked, userId)
+	return nil
+}
+
+type fakeRoleRepository struct {
+	repository.RoleRepository
+	users map[int]*model.User
+}
+
+func (f *fakeRoleRepository) FindRoleByName(ctx context.Context, name string) (model.Role, error) {
+	roles := map[string]int{model.RoleUserName: model.RoleUserId, model.RoleAdminName: model.RoleAdminId, "moderator": 3}
+	id, ok := roles[name]
+	if !ok {
+		return model.Role{}, app.NotFoundError
+	}
+	return model.Role{Id: id, Name: name, IsActive: true}, nil
+}
+
+func (f *fakeRoleRepository) AssignRole(ctx context.Context, userId int, roleId int) error {
+	names := map[int]string{model.RoleUserId: model.RoleUserName, model.RoleAdminId: model.RoleAdminName, 3: "moderator"}
+	f.users[userId].Role, f.users[userId].RoleName = roleId, names[roleId]
+	return nil
+}
+
+type fakeTwoFactorRepository struct {
+	repository.TwoFactorRepository
+	challenges []string
+	steps      map[string]bool
+}
+
+func (f *fakeTwoFactorRepository) SaveChallenge(ctx context.Context, hash string, username string, ttl time.Duration) error {
+	f.challenges = append(f.challenges, username)
+	return nil
+}
+
+type fakeWebhookService struct {
+	WebhookService
+}
+
+func (f fakeWebhookService) Emit(ctx context.Context, userId int, event string, data interface{}) {}
+
+type oidcTest struct {
+	service    *userService
+	idp        *oidctest.Server
+	identity   *fakeIdentityRepository
+	users      *fakeUserRepository
+	twoFactors *fakeTwoFactorRepository
+}
+
+func newOidcTest(t *testing.T, users ...*model.User) *oidcTest {
+	t.Helper()
+
+	cfg := *config.Cfg()
+	t.Cleanup(func() { *config.Cfg() = cfg })
+	config.Cfg().IsDev = true
+	config.Cfg().InviteOnly = false
+	config.Cfg().OidcRoleMapping = ""
+	config.Cfg().OidcStateTTL = time.Minute
+	config.Cfg().AccessTokenTTL = time.Minute
+	require.NoError(t, token.LoadKeys())
+
+	idp, err := oidctest.NewServer("notes")
+	require.NoError(t, err)
+	t.Cleanup(idp.Close)
+
+	o := &oidcTest{idp: idp, identity: newFakeIdentityRepository(users...), users: &fakeUserRepository{},
+		twoFactors: &fakeTwoFactorRepository{}}
+	o.service = &userService{repo: o.users, identity: o.identity, twoFactor: o.twoFactors, webhook: fakeWebhookService{},
+		role: &fakeRoleRepository{users: o.identity.users}, provider: oidc.NewProvider(idp.URL, "notes", "", "http://localhost:8080/api/oidc/callback", "openid email", "groups")}
+
+	return o
+}
+
+// authorize follows the redirect to the provider, which signs the subject in and returns the state and a code.
+func (o *oidcTest) authorize(t *testing.T, authorization *model.OidcAuthorization, claims func(map[string]interface{})) (string, string) {
+	t.Helper()
+
+	u, err := url.Parse(authorization.Url)
+	require.NoError(t, err)
+	query := u.Query()
+
+	idClaims := o.idp.Claims("subject-1", query.Get("nonce"))
+	if nil != claims {
+		claims(idClaims)
+	}
+	idToken, err := o.idp.Sign(idClaims)
+	require.NoError(t, err)
+
+	return query.Get("state"), o.idp.Code(idToken)
+}
+
+func TestOidcCallbackProvisionsUser(t *testing.T) {
+	o := newOidcTest(t)
+
+	authorization, err := o.service.OidcLogin(context.Background())
+	require.NoError(t, err)
+	state, code := o.authorize(t, authorization, func(c map[string]interface{}) {
+		c["email"] = "alice@example.com"
+		c["email_verified"] = true
+		c["preferred_username"] = "alice"
+	})
+
+	response, err := o.service.OidcCallback(context.Background(), state, code, authorization.Binding, model.Client{})
+	require.NoError(t, err)
+	assert.Equal(t, "alice", response.Username)
+	assert.NotEmpty(t, response.Token)
+	assert.NotEmpty(t, response.RefreshToken)
+	assert.Equal(t, 1, o.users.refreshTokens)
+
+	u, err := o.identity.FindIdentity(context.Background(), o.idp.URL, "subject-1")
+	require.NoError(t, err)
+	assert.Equal(t, "alice@example.com", u.Email)
+
+	// the verifier sent on the code exchange is the one the code challenge of the authorization URL was made from
+	parsed, err := url.Parse(authorization.Url)
+	require.NoError(t, err)
+	requests := o.idp.TokenRequests()
+	require.Len(t, requests, 1)
+	sum := sha256.Sum256([]byte(requests[0].Get("code_verifier")))
+	assert.Equal(t, parsed.Query().Get("code_challenge"), base64.RawURLEncoding.EncodeToString(sum[:]))
+}
+
+func TestOidcCallbackIgnoresUnverifiedEmail(t *testing.T) {
+	o := newOidcTest(t)
+
+	authorization, err := o.service.OidcLogin(context.Background())
+	require.NoError(t, err)
+	state, code := o.authorize(t, authorization, func(c map[string]interface{}) {
+		c["email"] = "victim@example.com"
+		c["email_verified"] = false
+	})
+
+	response, err := o.service.OidcCallback(context.Background(), state, code, authorization.Binding, model.Client{})
+	require.NoError(t, err)
+	assert.Equal(t, defaultSsoUsername, response.Username)
+
+	u, err := o.identity.FindIdentity(context.Background(), o.idp.URL, "subject-1")
+	require.NoError(t, err)
+	assert.Empty(t, u.Email)
+}
+
+func TestOidcCallbackLinksExistingUser(t *testing.T) {
+	existing := &model.User{Id: 7, Username: "bob", Email: "bob@example.com", Role: model.RoleUserId, IsVerified: true, IsActive: true}
+	o := newOidcTest(t, existing)
+
+	authorization, err := o.service.OidcLink(context.Background(), token.Token{UserId: existing.Id, Username: existing.Username})
+	require.NoError(t, err)
+	state, code := o.authorize(t, authorization, func(c map[string]interface{}) {
+		c["email"] = "bob@corp.example.com"
+		c["email_verified"] = true
+		c["preferred_username"] = "robert"
+	})
+
+	response, err := o.service.OidcCallback(context.Background(), state, code, authorization.Binding, model.Client{})
+	require.NoError(t, err)
+	assert.Equal(t, "bob", response.Username)
+	assert.Equal(t, []string{"7:subject-1:bob@corp.example.com"}, o.identity.links)
+	assert.Len(t, o.identity.users, 1, "linking must not provision another user")
+}
+
+func TestOidcCallbackRequiresBinding(t *testing.T) {
+	existing := &model.User{Id: 7, Username: "attacker", Role: model.RoleUserId, IsVerified: true, IsActive: true}
+
+	tests := []struct {
+		name    string
+		binding func(authorization *model.OidcAuthorization) string
+	}{
+		{name: "missing cookie", binding: func(*model.OidcAuthorization) string { return "" }},
+		{name: "cookie of another flow", binding: func(*model.OidcAuthorization) string { return "another-binding" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newOidcTest(t, existing)
+
+			// the attacker starts linking and hands the provider URL to the victim, whose browser lacks the cookie
+			authorization, err := o.service.OidcLink(context.Background(), token.Token{UserId: existing.Id, Username: existing.Username})
+			require.NoError(t, err)
+			state, code := o.authorize(t, authorization, nil)
+
+			_, err = o.service.OidcCallback(context.Background(), state, code, tt.binding(authorization), model.Client{})
+			assert.Equal(t, app.UnauthenticateError, err)
+			assert.Empty(t, o.identity.links)
+			assert.Empty(t, o.idp.TokenRequests(), "the code must not be redeemed")
+
+			// the state is consumed by the failed attempt
+			_, err = o.service.OidcCallback(context.Background(), state, code, authorization.Binding, model.Client{})
+			assert.Equal(t, app.UnauthenticateError, err)
+		})
+	}
+}
+
+func TestOidcCallbackChallengesTwoFactor(t *testing.T) {
+	existing := &model.User{Id: 7, Username: "carol", Role: model.RoleUserId, IsVerified: true, IsActive: true, TotpEnabled: true}
+	o := newOidcTest(t, existing)
+	o.identity.identities[o.idp.URL+"|subject-1"] = existing.Id
+
+	authorization, err := o.service.OidcLogin(context.Background())
+	require.NoError(t, err)
+	state, code := o.authorize(t, authorization, nil)
+
+	response, err := o.service.OidcCallback(context.Background(), state, code, authorization.Binding, model.Client{})
+	require.NoError(t, err)
+	assert.True(t, response.TwoFactor)
+	assert.NotEmpty(t, response.ChallengeToken)
+	assert.Empty(t, response.Token)
+	assert.Empty(t, response.RefreshToken)
+	assert.Equal(t, []string{"carol"}, o.twoFactors.challenges)
+	assert.Zero(t, o.users.refreshTokens)
+}
+
+func TestOidcCallbackSyncsRole(t *testing.T) {
+	tests := []struct {
+		name     string
+		role     model.Role
+		groups   []string
+		totp     bool
+		expected int
+		revoked  bool
+	}{
+		{name: "mapped group", role: model.Role{Id: model.RoleUserId, Name: model.RoleUserName}, groups: []string{"it-admins"},
+			expected: model.RoleAdminId, revoked: true},
+		{name: "mapped group with 2FA", role: model.Role{Id: model.RoleUserId, Name: model.RoleUserName}, groups: []string{"it-admins"},
+			totp: true, expected: model.RoleAdminId, revoked: true},
+		{name: "unchanged", role: model.Role{Id: model.RoleAdminId, Name: model.RoleAdminName}, groups: []string{"it-admins"},
+			expected: model.RoleAdminId},
+		{name: "removed from group", role: model.Role{Id: model.RoleAdminId, Name: model.RoleAdminName}, groups: []string{"staff"},
+			expected: model.RoleUserId, revoked: true},
+		{name: "removed from group with 2FA", role: model.Role{Id: 3, Name: "moderator"}, totp: true,
+			expected: model.RoleUserId, revoked: true},
+		{name: "role not handed out by the mapping", role: model.Role{Id: 4, Name: "support"}, groups: []string{"staff"},
+			expected: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			existing := &model.User{Id: 7, Username: "dave", Role: tt.role.Id, RoleName: tt.role.Name, IsVerified: true, IsActive: true,
+				TotpEnabled: tt.totp}
+			o := newOidcTest(t, existing)
+			config.Cfg().OidcRoleMapping = "engineering:moderator, it-admins:admin"
+			o.identity.identities[o.idp.URL+"|subject-1"] = existing.Id
+
+			authorization, err := o.service.OidcLogin(context.Background())
+			require.NoError(t, err)
+			state, code := o.authorize(t, authorization, func(c map[string]interface{}) { c["groups"] = tt.groups })
+
+			response, err := o.service.OidcCallback(context.Background(), state, code, authorization.Binding, model.Client{})
+			require.NoError(t, err)
+			assert.Equal(t, tt.totp, response.TwoFactor)
+			assert.Equal(t, tt.expected, existing.Role)
+			if tt.revoked {
+				assert.Equal(t, []int{existing.Id}, o.users.revoked)
+			} else {
+				assert.Empty(t, o.users.revoked)
+			}
+		})
+	}
+}
+
+func TestOidcCallbackRejectsInvalidIdToken(t *testing.T) {
+	o := newOidcTest(t)
+
+	authorization, err := o.service.OidcLogin(context.Background())
+	require.NoError(t, err)
+	state, code := o.authorize(t, authorization, func(c map[string]interface{}) { c["nonce"] = "other" })
+
+	_, err = o.service.OidcCallback(context.Background(), state, code, authorization.Binding, model.Client{})
+	assert.Equal(t, app.UnauthenticateError, err)
+	assert.Empty(t, o.identity.users)
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"refactory/notes/internal/app"
+	"refactory/notes/internal/app/model"
+	"refactory/notes/internal/app/repository"
+	"refactory/notes/internal/security/token"
+)
+
+type OrganizationService interface {
+	CreateOrganization(ctx context.Context, session token.Token, req model.OrganizationRequest) (*model.OrganizationResponse, error)
+	ListOrganization(ctx context.Context, session token.Token) ([]*model.OrganizationResponse, error)
+	DeleteOrganization(ctx context.Context, session token.Token, id int) error
+	OrganizationToken(ctx context.Context, session token.Token, id int) (*model.OrganizationTokenResponse, error)
+	ListMember(ctx context.Context, session token.Token, id int) ([]*model.MemberResponse, error)
+	AddMember(ctx context.Context, session token.Token, id int, req model.MemberRequest) (*model.MemberResponse, error)
+	UpdateMember(ctx context.Context, session token.Token, id int, userId int, role string) (*model.MemberResponse, error)
+	RemoveMember(ctx context.Context, session token.Token, id int, userId int) error
+}
+
+type organizationService struct {
+	repo repository.OrganizationRepository
+}
+
+func NewOrganizationService(repo repository.OrganizationRepository) OrganizationService {
+	return &organizationService{repo: repo}
+}
+
+func (o *organizationService) CreateOrganization(ctx context.Context, session token.Token, req model.OrganizationRequest) (*model.OrganizationResponse, error) {
+	organization := &model.Organization{Name: req.Name, CreatedBy: session.UserId}
+	if err := o.repo.InsertOrganization(ctx, organization, session.Username); nil != err {
+		return nil, err
+	}
+
+	return model.NewOrganizationResponse(*organization), nil
+}
+
+func (o *organizationService) ListOrganization(ctx context.Context, session token.Token) ([]*model.OrganizationResponse, error) {
+	responses := []*model.OrganizationResponse{}
+	result, err := o.repo.ListOrganization(ctx, session.UserId)
+	if nil != err {
+		return nil, err
+	}
+
+	for _, r := range result {
+		responses = append(responses, model.NewOrganizationResponse(r))
+	}
+
+	return responses, nil
+}
+
+// DeleteOrganization deletes the organization with every shared note, only owners can delete it.
+func (o *organizationService) DeleteOrganization(ctx context.Context, session token.Token, id int) error {
+	if _, err := o.member(ctx, session, id, model.OrgRoleOwner); nil != err {
+		return err
+	}
+
+	return o.repo.DeleteOrganization(ctx, id)
+}
+
+// OrganizationToken returns an access token carrying the organization as org claim, so requests made with it
+// do not need the X-Org header. It shares the device session and the lifetime of a regular access token.
+func (o *organizationService) OrganizationToken(ctx context.Context, session token.Token, id int) (*model.OrganizationTokenResponse, error) {
+	// personal access and impersonation tokens must not be traded for a regular access token
+	if len(session.Scopes) > 0 || nil != session.Act {
+		return nil, app.UnauthorizedError
+	}
+	if _, err := o.member(ctx, session, id, ""); nil != err {
+		return nil, err
+	}
+
+	access, err := token.GenerateToken(model.Session{UserId: session.UserId, SessionId: session.Sid, OrganizationId: id,
+		Username: session.Username, RoleId: session.RoleId})
+	if nil != err {
+		return nil, err
+	}
+
+	return &model.OrganizationTokenResponse{Token: access}, nil
+}
+
+func (o *organizationService) ListMember(ctx context.Context, session token.Token, id int) ([]*model.MemberResponse, error) {
+	if _, err := o.member(ctx, session, id, ""); nil != err {
+		return nil, err
+	}
+
+	responses := []*model.MemberResponse{}
+	result, err := o.repo.ListMember(ctx, id)
+	if nil != err {
+		return nil, err
+	}
+
+	for _, r := range result {
+		responses = append(responses, model.NewMemberResponse(r))
+	}
+
+	return responses, nil
+}
+
+func (o *organizationService) AddMember(ctx context.Context, session token.Token, id int, req model.MemberRequest) (*model.MemberResponse, error) {
+	if _, err := o.member(ctx, session, id, model.OrgRoleOwner); nil != err {
+		return nil, err
+	}
+
+	member, err := o.repo.AddMember(ctx, id, req.Username, req.Role)
+	if nil != err {
+		return nil, err
+	}
+
+	return model.NewMemberResponse(*member), nil
+}
+
+func (o *organizationService) UpdateMember(ctx context.Context, session token.Token, id int, userId int, role string) (*model.MemberResponse, error) {
+	if _, err := o.member(ctx, session, id, model.OrgRoleOwner); nil != err {
+		return nil, err
+	}
+	if role != model.OrgRoleOwner {
+		if err := o.keepOwner(ctx, id, userId); nil != err {
+			return nil, err
+		}
+	}
+
+	member, err := o.repo.UpdateMember(ctx, id, userId, role)
+	if nil != err {
+		return nil, err
+	}
+
+	return model.NewMemberResponse(*member), nil
+}
+
+// RemoveMember lets owners remove any member and every member leave the organization.
+func (o *organizationService) RemoveMember(ctx context.Context, session token.Token, id int, userId int) error {
+	role := model.OrgRoleOwner
+	if userId == session.UserId {
+		role = ""
+	}
+	if _, err := o.member(ctx, session, id, role); nil != err {
+		return err
+	}
+	if err := o.keepOwner(ctx, id, userId); nil != err {
+		return err
+	}
+
+	return o.repo.RemoveMember(ctx, id, userId)
+}
+
+// member returns the membership of the session user, with a role it has to be that role.
+// Users outside of the organization get app.NotFoundError so the organization is not disclosed.
+func (o *organizationService) member(ctx context.Context, session token.Token, id int, role string) (model.Member, error) {
+	member, err := o.repo.FindMember(ctx, id, session.UserId)
+	if nil != err {
+		return member, err
+	}
+	if member.Deleted {
+		return member, app.NotFoundError
+	}
+	if role != "" && member.Role != role {
+		return member, app.UnauthorizedError
+	}
+
+	return member, nil
+}
+
+// keepOwner refuses to demote or remove the last owner, the organization could not be managed anymore.
+func (o *organizationService) keepOwner(ctx context.Context, id int, userId int) error {
+	members, err := o.repo.ListMember(ctx, id)
+	if nil != err {
+		return err
+	}
+
+	owners, target := 0, false
+	for _, m := range members {
+		if m.Role == model.OrgRoleOwner {
+			owners++
+			target = target || m.UserId == userId
+		}
+	}
+	if target && owners == 1 {
+		return app.InUseError
+	}
+
+	return nil
+}
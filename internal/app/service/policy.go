@@ -0,0 +1,49 @@
+package service
+
+import (
+	"context"
+	"refactory/notes/internal/app/model"
+	"refactory/notes/internal/app/repository"
+)
+
+const maxAuditLimit = 500
+
+type PolicyService interface {
+	ListPolicy(ctx context.Context, pType string) ([]model.PolicyResponse, error)
+	AddPolicy(ctx context.Context, userId int, req model.PolicyRequest) error
+	RemovePolicy(ctx context.Context, userId int, req model.PolicyRequest) error
+	TestPolicy(ctx context.Context, req model.PolicyTestRequest) (*model.PolicyTestResponse, error)
+	ListAudit(ctx context.Context, limit int) ([]model.PolicyAudit, error)
+}
+
+type policyService struct {
+	repo repository.PolicyRepository
+}
+
+func NewPolicyService(repo repository.PolicyRepository) PolicyService {
+	return &policyService{repo: repo}
+}
+
+func (p *policyService) ListPolicy(ctx context.Context, pType string) ([]model.PolicyResponse, error) {
+	return p.repo.ListPolicy(ctx, pType)
+}
+
+func (p *policyService) AddPolicy(ctx context.Context, userId int, req model.PolicyRequest) error {
+	return p.repo.AddPolicy(ctx, userId, req)
+}
+
+func (p *policyService) RemovePolicy(ctx context.Context, userId int, req model.PolicyRequest) error {
+	return p.repo.RemovePolicy(ctx, userId, req)
+}
+
+func (p *policyService) TestPolicy(ctx context.Context, req model.PolicyTestRequest) (*model.PolicyTestResponse, error) {
+	return p.repo.TestPolicy(ctx, req)
+}
+
+func (p *policyService) ListAudit(ctx context.Context, limit int) ([]model.PolicyAudit, error) {
+	if limit <= 0 || limit > maxAuditLimit {
+		limit = maxAuditLimit
+	}
+
+	return p.repo.ListAudit(ctx, limit)
+}
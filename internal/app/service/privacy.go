@@ -0,0 +1,179 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/log"
+	"io"
+	"mime"
+	"refactory/notes/internal/app"
+	"refactory/notes/internal/app/model"
+	"refactory/notes/internal/app/repository"
+	"refactory/notes/internal/config"
+	"refactory/notes/internal/security/token"
+	"time"
+)
+
+type PrivacyService interface {
+	Export(ctx context.Context, userId int) (*model.AccountExport, error)
+	WriteExport(ctx context.Context, export *model.AccountExport, w io.Writer) error
+	RequestErasure(ctx context.Context, session token.Token) (*model.ErasureResponse, error)
+}
+
+const (
+	erasureBatch        = 20
+	erasurePollInterval = time.Minute
+)
+
+type privacyService struct {
+	repo  repository.PrivacyRepository
+	media repository.MediaRepository
+	user  repository.UserRepository
+}
+
+func NewPrivacyService(repo repository.PrivacyRepository, media repository.MediaRepository, user repository.UserRepository) PrivacyService {
+	p := &privacyService{repo: repo, media: media, user: user}
+	go p.loop()
+	return p
+}
+
+// Export collects the personal data of the user, the media files are only read by WriteExport.
+func (p *privacyService) Export(ctx context.Context, userId int) (*model.AccountExport, error) {
+	var result model.AccountExport
+	var err error
+
+	if result.Profile, err = p.repo.ExportProfile(ctx, userId); nil != err {
+		return nil, err
+	}
+	if result.Notes, err = p.repo.ExportNotes(ctx, userId); nil != err {
+		return nil, err
+	}
+	if result.Media, err = p.repo.ExportMedia(ctx, userId); nil != err {
+		return nil, err
+	}
+	if result.Audit, err = p.repo.ExportAudit(ctx, userId); nil != err {
+		return nil, err
+	}
+
+	deliveries, err := p.repo.ExportDelivery(ctx, userId)
+	if nil != err {
+		return nil, err
+	}
+	result.Deliveries = []*model.WebhookDeliveryResponse{}
+	for _, d := range deliveries {
+		result.Deliveries = append(result.Deliveries, model.NewWebhookDeliveryResponse(d))
+	}
+
+	for i := range result.Media {
+		ext := ".bin"
+		if exts, _ := mime.ExtensionsByType(result.Media[i].MimeType); len(exts) > 0 {
+			ext = exts[0]
+		}
+		result.Media[i].File = fmt.Sprintf("media/%d%s", result.Media[i].Id, ext)
+	}
+
+	return &result, nil
+}
+
+// WriteExport writes the export as a ZIP archive, media files are read one at a time to keep memory flat.
+func (p *privacyService) WriteExport(ctx context.Context, export *model.AccountExport, w io.Writer) error {
+	archive := zip.NewWriter(w)
+
+	for _, entry := range []struct {
+		name  string
+		value interface{}
+	}{
+		{"profile.json", export.Profile},
+		{"notes.json", export.Notes},
+		{"media.json", export.Media},
+		{"audit/policies.json", export.Audit},
+		{"audit/webhook_deliveries.json", export.Deliveries},
+	} {
+		f, err := archive.Create(entry.name)
+		if nil != err {
+			return err
+		}
+		encoder := json.NewEncoder(f)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(entry.value); nil != err {
+			return errors.Wrapf(err, "[export] WriteExport - encode %s", entry.name)
+		}
+	}
+
+	for _, media := range export.Media {
+		_, file, err := p.media.SelectMedia(ctx, media.Id)
+		if nil != err {
+			return err
+		}
+		f, err := archive.Create(media.File)
+		if nil != err {
+			return err
+		}
+		if _, err := f.Write(file); nil != err {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+// RequestErasure signs the user out everywhere and erases the account once the grace period is over,
+// reactivating the user before then cancels the erasure.
+func (p *privacyService) RequestErasure(ctx context.Context, session token.Token) (*model.ErasureResponse, error) {
+	eraseAt, err := p.repo.ScheduleErasure(ctx, session.UserId, time.Now().Add(config.Cfg().ErasureGracePeriod))
+	if nil != err {
+		return nil, err
+	}
+
+	if err := p.user.RevokeTokens(ctx, session.UserId); nil != err {
+		return nil, err
+	}
+	if err := p.user.DeleteSession(ctx, session.Username); nil != err {
+		return nil, err
+	}
+
+	return &model.ErasureResponse{EraseAt: eraseAt}, nil
+}
+
+func (p *privacyService) loop() {
+	ticker := time.NewTicker(erasurePollInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx := context.Background()
+		erasures, err := p.repo.DueErasure(ctx, erasureBatch)
+		if nil != err {
+			log.Error(err)
+			continue
+		}
+
+		for _, e := range erasures {
+			p.erase(ctx, e)
+		}
+	}
+}
+
+func (p *privacyService) erase(ctx context.Context, e model.Erasure) {
+	if err := p.repo.EraseUser(ctx, e.UserId); nil != err {
+		if app.NotFoundError != errors.Cause(err) {
+			log.Error(errors.Wrapf(err, "erasing user %d", e.UserId))
+		}
+		return
+	}
+
+	// tokens issued during the grace period and the login state must not outlive the account
+	if err := p.user.RevokeTokens(ctx, e.UserId); nil != err {
+		log.Error(err)
+	}
+	if err := p.user.DeleteSession(ctx, e.Username); nil != err {
+		log.Error(err)
+	}
+	if err := p.user.UnlockLogin(ctx, loginUser(e.Username)); nil != err {
+		log.Error(err)
+	}
+
+	log.Infof("erased user %d", e.UserId)
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"refactory/notes/internal/app"
+	"refactory/notes/internal/app/model"
+	"refactory/notes/internal/app/repository"
+)
+
+type QuotaService interface {
+	CheckNotes(ctx context.Context, userId int, bodySize int, isNew bool) (model.Quota, error)
+	CheckMedia(ctx context.Context, userId int, size int64) (model.Quota, error)
+	GetQuota(ctx context.Context, userId int) (*model.QuotaResponse, error)
+	UpdateQuota(ctx context.Context, userId int, req model.QuotaRequest) (*model.QuotaResponse, error)
+}
+
+type quotaService struct {
+	repo repository.QuotaRepository
+}
+
+func NewQuotaService(repo repository.QuotaRepository) QuotaService {
+	return &quotaService{repo: repo}
+}
+
+// CheckNotes validates the body size of a note and, for new notes, the number of notes the user already has.
+// Concurrent creates may all pass the count, the returned quota is enforced again by the insert under a lock.
+func (q *quotaService) CheckNotes(ctx context.Context, userId int, bodySize int, isNew bool) (model.Quota, error) {
+	quota, err := q.repo.FindQuota(ctx, userId)
+	if nil != err {
+		return quota, err
+	}
+
+	if quota.MaxBodySize > 0 && bodySize > quota.MaxBodySize {
+		return quota, app.QuotaExceededError
+	}
+
+	if !isNew || quota.MaxNotes == 0 {
+		return quota, nil
+	}
+
+	count, err := q.repo.CountNotes(ctx, userId)
+	if nil != err {
+		return quota, err
+	}
+	if count >= quota.MaxNotes {
+		return quota, app.QuotaExceededError
+	}
+
+	return quota, nil
+}
+
+// CheckMedia validates the media usage of the user with the new file, the returned quota is enforced again by the
+// insert under a lock since concurrent uploads may all pass this check.
+func (q *quotaService) CheckMedia(ctx context.Context, userId int, size int64) (model.Quota, error) {
+	quota, err := q.repo.FindQuota(ctx, userId)
+	if nil != err {
+		return quota, err
+	}
+
+	if quota.MaxMediaBytes == 0 {
+		return quota, nil
+	}
+
+	used, err := q.repo.MediaUsage(ctx, userId)
+	if nil != err {
+		return quota, err
+	}
+	if used+size > quota.MaxMediaBytes {
+		return quota, app.QuotaExceededError
+	}
+
+	return quota, nil
+}
+
+func (q *quotaService) GetQuota(ctx context.Context, userId int) (*model.QuotaResponse, error) {
+	quota, err := q.repo.FindQuota(ctx, userId)
+	if nil != err {
+		return nil, err
+	}
+
+	notes, err := q.repo.CountNotes(ctx, userId)
+	if nil != err {
+		return nil, err
+	}
+
+	media, err := q.repo.MediaUsage(ctx, userId)
+	if nil != err {
+		return nil, err
+	}
+
+	return model.NewQuotaResponse(quota, notes, media), nil
+}
+
+// UpdateQuota overrides the limits of a user, clearing every limit restores the configured defaults.
+func (q *quotaService) UpdateQuota(ctx context.Context, userId int, req model.QuotaRequest) (*model.QuotaResponse, error) {
+	if nil == req.MaxNotes && nil == req.MaxBodySize && nil == req.MaxMediaBytes {
+		if err := q.repo.DeleteQuota(ctx, userId); nil != err {
+			return nil, err
+		}
+	} else if err := q.repo.UpsertQuota(ctx, userId, req); nil != err {
+		return nil, err
+	}
+
+	return q.GetQuota(ctx, userId)
+}
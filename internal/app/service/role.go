@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"refactory/notes/internal/app"
+	"refactory/notes/internal/app/model"
+	"refactory/notes/internal/app/repository"
+)
+
+type RoleService interface {
+	ListRole(ctx context.Context) ([]*model.RoleResponse, error)
+	DetailRole(ctx context.Context, id int) (*model.RoleResponse, error)
+	CreateRole(ctx context.Context, req model.RoleRequest) (*model.RoleResponse, error)
+	UpdateRole(ctx context.Context, id int, req model.RoleRequest) (*model.RoleResponse, error)
+	DeleteRole(ctx context.Context, id int) error
+	AssignRole(ctx context.Context, userId int, roleId int) error
+	UnassignRole(ctx context.Context, userId int) error
+}
+
+type roleService struct {
+	repo     repository.RoleRepository
+	userRepo repository.UserRepository
+}
+
+func NewRoleService(repo repository.RoleRepository, userRepo repository.UserRepository) RoleService {
+	return &roleService{repo: repo, userRepo: userRepo}
+}
+
+func (r *roleService) ListRole(ctx context.Context) ([]*model.RoleResponse, error) {
+	var response []*model.RoleResponse
+	result, err := r.repo.ListRole(ctx)
+	if nil != err {
+		return nil, err
+	}
+
+	for _, role := range result {
+		response = append(response, model.NewRoleResponse(role))
+	}
+
+	return response, nil
+}
+
+func (r *roleService) DetailRole(ctx context.Context, id int) (*model.RoleResponse, error) {
+	role, err := r.repo.FindRole(ctx, id)
+	if nil != err {
+		return nil, err
+	}
+
+	return model.NewRoleResponse(role), nil
+}
+
+func (r *roleService) CreateRole(ctx context.Context, req model.RoleRequest) (*model.RoleResponse, error) {
+	role := model.Role{Name: req.Name}
+	if err := r.repo.InsertRole(ctx, &role); nil != err {
+		return nil, err
+	}
+
+	return model.NewRoleResponse(role), nil
+}
+
+func (r *roleService) UpdateRole(ctx context.Context, id int, req model.RoleRequest) (*model.RoleResponse, error) {
+	if isBuiltinRole(id) {
+		return nil, app.BadRequestError
+	}
+
+	role := model.Role{Id: id, Name: req.Name}
+	if err := r.repo.UpdateRole(ctx, &role); nil != err {
+		return nil, err
+	}
+
+	return r.DetailRole(ctx, id)
+}
+
+func (r *roleService) DeleteRole(ctx context.Context, id int) error {
+	if isBuiltinRole(id) {
+		return app.BadRequestError
+	}
+
+	return r.repo.DeleteRole(ctx, id)
+}
+
+// AssignRole changes the role of the user, issued tokens are revoked since they still carry the previous role.
+func (r *roleService) AssignRole(ctx context.Context, userId int, roleId int) error {
+	if err := r.repo.AssignRole(ctx, userId, roleId); nil != err {
+		return err
+	}
+
+	return r.userRepo.RevokeTokens(ctx, userId)
+}
+
+// UnassignRole puts the user back on the default user role.
+func (r *roleService) UnassignRole(ctx context.Context, userId int) error {
+	return r.AssignRole(ctx, userId, model.RoleUserId)
+}
+
+func isBuiltinRole(id int) bool {
+	return id == model.RoleUserId || id == model.RoleAdminId
+}
@@ -0,0 +1,173 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/log"
+	"refactory/notes/internal/app"
+	"refactory/notes/internal/app/model"
+	"refactory/notes/internal/config"
+	"refactory/notes/internal/security/token"
+	"refactory/notes/internal/security/totp"
+	"strings"
+	"time"
+)
+
+const (
+	recoveryCodeCount     = 10
+	challengeTTL          = time.Minute * 5
+	challengeFailureLimit = 5
+)
+
+// EnrollTwoFactor generates a pending TOTP secret with fresh recovery codes, 2FA is only enforced after VerifyTwoFactor.
+func (a *userService) EnrollTwoFactor(ctx context.Context, session token.Token) (*model.TwoFactorEnrollResponse, error) {
+	u, err := a.repo.FindUser(ctx, session.Username)
+	if nil != err {
+		return nil, err
+	}
+	if u.TotpEnabled {
+		return nil, app.DuplicateError
+	}
+
+	secret, err := totp.GenerateSecret()
+	if nil != err {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := token.RandomString(5)
+		if nil != err {
+			return nil, err
+		}
+		codes = append(codes, fmt.Sprintf("%s-%s", code[:5], code[5:]))
+		hashes = append(hashes, hashToken(code))
+	}
+
+	if err := a.twoFactor.SaveSecret(ctx, u.Id, secret, hashes); nil != err {
+		return nil, err
+	}
+
+	return &model.TwoFactorEnrollResponse{
+		Secret:        secret,
+		Uri:           totp.URI(config.Cfg().TotpIssuer, u.Username, secret),
+		RecoveryCodes: codes,
+	}, nil
+}
+
+// VerifyTwoFactor activates 2FA once the user proves the authenticator app holds the pending secret.
+func (a *userService) VerifyTwoFactor(ctx context.Context, session token.Token, code string) error {
+	u, err := a.repo.FindUser(ctx, session.Username)
+	if nil != err {
+		return err
+	}
+	if u.TotpSecret == "" {
+		return app.NotFoundError
+	}
+
+	if ok, err := a.checkTotp(ctx, u, code); nil != err {
+		return err
+	} else if !ok {
+		return app.InvalidCodeError
+	}
+
+	return a.twoFactor.EnableTwoFactor(ctx, u.Id)
+}
+
+// LoginTwoFactor exchanges the challenge token returned by Login and a TOTP or recovery code for a token pair.
+func (a *userService) LoginTwoFactor(ctx context.Context, challenge string, code string, client model.Client) (*model.LoginResponse, error) {
+	hash := hashToken(challenge)
+	username, err := a.twoFactor.FindChallenge(ctx, hash)
+	if nil != err {
+		if app.NotFoundError == errors.Cause(err) {
+			return nil, app.UnauthenticateError
+		}
+		return nil, err
+	}
+
+	u, err := a.repo.FindUser(ctx, username)
+	if nil != err {
+		return nil, app.UnauthenticateError
+	}
+
+	// the challenge does not bypass the login lockout, wrong codes count towards it like wrong passwords
+	locked, err := a.repo.LoginLockedFor(ctx, loginUser(u.Username), loginIp(client.Ip))
+	if nil != err {
+		return nil, err
+	}
+	if locked > 0 {
+		return nil, app.Locked(locked)
+	}
+
+	ok, err := a.checkTotp(ctx, u, code)
+	if nil != err {
+		return nil, err
+	}
+	if !ok {
+		if ok, err = a.twoFactor.UseRecoveryCode(ctx, u.Id, hashToken(normalizeRecoveryCode(code))); nil != err {
+			return nil, err
+		}
+	}
+	if !ok {
+		if err := a.twoFactor.FailChallenge(ctx, hash, challengeFailureLimit); nil != err {
+			return nil, err
+		}
+		if err := a.failLogin(ctx, *u, client.Ip); app.LockedError == errors.Cause(err) {
+			return nil, err
+		} else if _, ok := errors.Cause(err).(app.Error); !ok {
+			return nil, err
+		}
+		return nil, app.InvalidCodeError
+	}
+
+	if err := a.twoFactor.DeleteChallenge(ctx, hash); nil != err {
+		return nil, err
+	}
+	if err := a.repo.UnlockLogin(ctx, loginUser(u.Username)); nil != err {
+		log.Error(err)
+	}
+
+	session := model.Session{
+		UserId:     u.Id,
+		Email:      u.Email,
+		Username:   u.Username,
+		RoleId:     u.Role,
+		IsVerified: u.IsVerified,
+		IsActive:   u.IsActive,
+	}
+
+	return a.issueToken(ctx, session, "", client)
+}
+
+func (a *userService) ResetTwoFactor(ctx context.Context, userId int) error {
+	return a.twoFactor.ResetTwoFactor(ctx, userId)
+}
+
+// challengeTwoFactor starts the second login step for users with 2FA enabled.
+func (a *userService) challengeTwoFactor(ctx context.Context, u *model.User) (*model.LoginResponse, error) {
+	challenge, err := token.RandomString(32)
+	if nil != err {
+		return nil, err
+	}
+
+	if err := a.twoFactor.SaveChallenge(ctx, hashToken(challenge), u.Username, challengeTTL); nil != err {
+		return nil, err
+	}
+
+	return &model.LoginResponse{Username: u.Username, TwoFactor: true, ChallengeToken: challenge}, nil
+}
+
+func (a *userService) checkTotp(ctx context.Context, u *model.User, code string) (bool, error) {
+	step, ok := totp.Validate(u.TotpSecret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	return a.twoFactor.UseStep(ctx, u.Id, step)
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"refactory/notes/internal/app/model"
+	"refactory/notes/internal/security/totp"
+	"testing"
+	"time"
+)
+
+func (f *fakeTwoFactorRepository) UseStep(ctx context.Context, userId int, step int64) (bool, error) {
+	key := fmt.Sprintf("%d:%d", userId, step)
+	if f.steps[key] {
+		return false, nil
+	}
+	f.steps[key] = true
+	return true, nil
+}
+
+func TestCheckTotpRejectsReplay(t *testing.T) {
+	secret, err := totp.GenerateSecret()
+	require.NoError(t, err)
+	u := &model.User{Id: 7, Username: "erin", TotpSecret: secret}
+	other := &model.User{Id: 8, Username: "frank", TotpSecret: secret}
+
+	a := &userService{twoFactor: &fakeTwoFactorRepository{steps: map[string]bool{}}}
+	now := time.Now()
+	code, err := totp.Code(secret, now)
+	require.NoError(t, err)
+
+	ok, err := a.checkTotp(context.Background(), u, code)
+	require.NoError(t, err)
+	assert.True(t, ok, "first use")
+
+	ok, err = a.checkTotp(context.Background(), u, code)
+	require.NoError(t, err)
+	assert.False(t, ok, "the step of the code was already used")
+
+	ok, err = a.checkTotp(context.Background(), other, code)
+	require.NoError(t, err)
+	assert.True(t, ok, "steps are tracked per user")
+
+	next, err := totp.Code(secret, now.Add(totp.Period*time.Second))
+	require.NoError(t, err)
+	ok, err = a.checkTotp(context.Background(), u, next)
+	require.NoError(t, err)
+	assert.True(t, ok, "the code of the next step is still accepted")
+}
@@ -2,76 +2,150 @@ package service
 
 import (
 	"context"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
 	"fmt"
 	"github.com/lib/pq"
-	"golang.org/x/crypto/bcrypt"
-	"math/rand"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/log"
+	"io"
+	"math/big"
 	"refactory/notes/internal/app"
 	"refactory/notes/internal/app/model"
 	"refactory/notes/internal/app/repository"
 	"refactory/notes/internal/config"
 	"refactory/notes/internal/mail"
+	"refactory/notes/internal/security/oidc"
+	"refactory/notes/internal/security/password"
 	"refactory/notes/internal/security/token"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type UserService interface {
 	CreateUser(ctx context.Context, req model.UserRequest) (*model.UserResponse, error)
-	Login(ctx context.Context, username, password string) (*model.LoginResponse, error)
+	Login(ctx context.Context, username, password string, client model.Client) (*model.LoginResponse, error)
 	VerifyCode(ctx context.Context, session token.Token, code int) error
-	ListUser(ctx context.Context) ([]*model.UserResponse, error)
+	ListUser(ctx context.Context, filter model.UserFilter) (*model.UserListResponse, error)
+	ExportUser(ctx context.Context, filter model.UserFilter, w io.Writer) error
 	DetailUser(ctx context.Context, Id int) (*model.UserResponse, error)
 	UpdateUser(ctx context.Context, user *model.User) (*model.UserResponse, error)
 	DeleteUser(ctx context.Context, id int) error
 	ActiveUser(ctx context.Context, id int) error
+	ForgotPassword(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token string, password string) error
+	UpdateProfile(ctx context.Context, session token.Token, req model.ProfileRequest) (*model.UserResponse, error)
+	ChangePassword(ctx context.Context, session token.Token, current string, password string, client model.Client) (*model.LoginResponse, error)
+	Refresh(ctx context.Context, refreshToken string, client model.Client) (*model.LoginResponse, error)
+	Logout(ctx context.Context, session token.Token, refreshToken string) error
+	EnrollTwoFactor(ctx context.Context, session token.Token) (*model.TwoFactorEnrollResponse, error)
+	VerifyTwoFactor(ctx context.Context, session token.Token, code string) error
+	LoginTwoFactor(ctx context.Context, challenge string, code string, client model.Client) (*model.LoginResponse, error)
+	ResetTwoFactor(ctx context.Context, userId int) error
+	ResendVerification(ctx context.Context, email string) error
+	VerifyLink(ctx context.Context, link string) error
+	UnlockUser(ctx context.Context, id int) error
+	OidcLogin(ctx context.Context) (*model.OidcAuthorization, error)
+	OidcLink(ctx context.Context, session token.Token) (*model.OidcAuthorization, error)
+	OidcCallback(ctx context.Context, state string, code string, binding string, client model.Client) (*model.LoginResponse, error)
+	VerifyEmailChange(ctx context.Context, session token.Token, code int) (*model.UserResponse, error)
+	CancelEmailChange(ctx context.Context, session token.Token) error
+	ListDevice(ctx context.Context, session token.Token) ([]model.DeviceResponse, error)
+	RevokeDevice(ctx context.Context, session token.Token, id string) error
+	RevokeOtherDevices(ctx context.Context, session token.Token) error
 }
 
-type role int
-
-const (
-	UserRole role = iota + 1
-	AdminRole
-)
-
-func (r role) Int() int {
-	return int(r)
+type userService struct {
+	repo       repository.UserRepository
+	twoFactor  repository.TwoFactorRepository
+	identity   repository.IdentityRepository
+	role       repository.RoleRepository
+	invitation repository.InvitationRepository
+	mailer     mail.Mailer
+	webhook    WebhookService
+	provider   *oidc.Provider
+	passwords  *password.Manager
+	policy     password.Policy
 }
 
-func (r role) String() string {
-	return [...]string{"user", "admin"}[r-1]
+func NewUserService(repo repository.UserRepository, twoFactor repository.TwoFactorRepository, identity repository.IdentityRepository,
+	role repository.RoleRepository, invitation repository.InvitationRepository, webhook WebhookService) *userService {
+	provider := oidc.NewProvider(config.Cfg().OidcIssuer, config.Cfg().OidcClientId, config.Cfg().OidcClientSecret,
+		config.Cfg().OidcRedirectUrl, config.Cfg().OidcScopes, config.Cfg().OidcGroupsClaim)
+	return &userService{repo: repo, twoFactor: twoFactor, identity: identity, role: role, invitation: invitation,
+		mailer: mail.NewMailer(repo), webhook: webhook, provider: provider, passwords: newPasswordManager(),
+		policy: password.Policy{MinLength: config.Cfg().PasswordMinLength, MinEntropy: config.Cfg().PasswordMinEntropy}}
 }
 
-type userService struct {
-	repo   repository.UserRepository
-	mailer mail.Mailer
+// newPasswordManager hashes with the configured algorithm, hashes of the other one are still verified and
+// upgraded on the next login.
+func newPasswordManager() *password.Manager {
+	argon := password.Argon2id{Time: config.Cfg().Argon2Time, Memory: config.Cfg().Argon2Memory,
+		Threads: config.Cfg().Argon2Threads, SaltLength: 16, KeyLength: 32}
+	bcrypt := password.Bcrypt{Cost: config.Cfg().BcryptCost}
+	if config.Cfg().PasswordHasher == "bcrypt" {
+		return password.NewManager(bcrypt, argon)
+	}
+	return password.NewManager(argon, bcrypt)
 }
 
-func NewUserService(repo repository.UserRepository) *userService {
-	return &userService{repo: repo, mailer: mail.NewMailer(repo)}
+// hashPassword checks the password against the password policy before hashing it, personal holds the username
+// and email of the user.
+func (a *userService) hashPassword(pass string, personal ...string) (string, error) {
+	if err := a.policy.Check(pass, personal...); nil != err {
+		return "", app.Error{Code: app.WeakPasswordCode.Int(), Message: err.Error()}
+	}
+	return a.passwords.Hash(pass)
 }
 
+// CreateUser registers a user, an invitation token gives them the role of the invitation and is required when registration is invite only.
 func (a *userService) CreateUser(ctx context.Context, req model.UserRequest) (*model.UserResponse, error) {
 	// encrypt password
-	pass, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	pass, err := a.hashPassword(req.Password, req.Username, req.Email)
 	if nil != err {
 		return nil, err
 	}
 
-	u := model.NewUser(0, req.FirstName, req.LastName, req.Email, req.Username, string(pass), "", UserRole.Int())
+	u := model.NewUser(0, req.FirstName, req.LastName, req.Email, req.Username, pass, "", model.RoleUserId)
+	u.RoleName = model.RoleUserName
+
+	var invitation *model.Invitation
+	if req.InvitationToken != "" {
+		if invitation, err = a.invitation.ClaimInvitation(ctx, hashToken(req.InvitationToken), req.Email); nil != err {
+			if app.NotFoundError == errors.Cause(err) {
+				return nil, app.InvalidCodeError
+			}
+			return nil, err
+		}
+		u.Role, u.RoleName = invitation.RoleId, invitation.RoleName
+	} else if config.Cfg().InviteOnly {
+		return nil, app.UnauthorizedError
+	}
 
 	session := model.Session{
 		UserId:     u.Id,
 		Email:      u.Email,
 		Username:   u.Username,
 		RoleId:     u.Role,
-		Code:       rand.Intn(999999),
 		IsVerified: false,
 		IsSent:     false,
 		IsActive:   true,
 	}
+	if err := a.newVerification(ctx, &session); nil != err {
+		a.releaseInvitation(ctx, invitation)
+		return nil, err
+	}
 
 	// record data to database
 	token, err := a.repo.Create(ctx, u, session)
 	if nil != err {
+		a.releaseInvitation(ctx, invitation)
 		// check if user already exist
 		if vErr, ok := err.(*pq.Error); ok && vErr.Code == "23505" {
 			return nil, app.Error{Code: app.DuplicateCode.Int(), Message: fmt.Sprintf("duplicate value for field %s", vErr.Column)}
@@ -79,23 +153,59 @@ func (a *userService) CreateUser(ctx context.Context, req model.UserRequest) (*m
 
 		return nil, err
 	}
+	session.UserId = u.Id
 
 	// adding user to mail verification queue
 	a.mailer.Add(session)
 
-	return model.NewUserResponse(u.Id, u.FirstName, u.LastName, u.Email, u.Username, u.Password, u.Photo, UserRole.String(), token), nil
+	return model.NewUserResponse(u.Id, u.FirstName, u.LastName, u.Email, u.Username, u.Photo, u.RoleName, token), nil
 }
 
-func (a *userService) Login(ctx context.Context, username, password string) (*model.LoginResponse, error) {
-	// finding user
-	u, err := a.repo.FindUser(ctx, username)
+// releaseInvitation makes a claimed invitation usable again when the registration claiming it failed.
+func (a *userService) releaseInvitation(ctx context.Context, invitation *model.Invitation) {
+	if nil == invitation {
+		return
+	}
+	if err := a.invitation.ReleaseInvitation(ctx, invitation.Id); nil != err {
+		log.Error(err)
+	}
+}
+
+func (a *userService) Login(ctx context.Context, username, plain string, client model.Client) (*model.LoginResponse, error) {
+	// reject locked accounts and clients before touching the password
+	locked, err := a.repo.LoginLockedFor(ctx, loginUser(username), loginIp(client.Ip))
 	if nil != err {
 		return nil, err
 	}
+	if locked > 0 {
+		return nil, app.Locked(locked)
+	}
+
+	// finding user, unknown usernames count as failed attempts too
+	u, err := a.repo.FindUser(ctx, username)
+	if nil != err {
+		if sql.ErrNoRows != err {
+			return nil, err
+		}
+		return nil, a.failLogin(ctx, model.User{Username: username}, client.Ip)
+	}
 
 	// compare password
-	if err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password)); nil != err {
-		return nil, app.Error{Code: app.UnauthenticatedCode.Int(), Message: "Unauthenticated"}
+	ok, rehash, err := a.passwords.Verify(plain, u.Password)
+	if nil != err && password.ErrUnknownHash != err {
+		log.Error(err)
+	}
+	if !ok {
+		return nil, a.failLogin(ctx, *u, client.Ip)
+	}
+
+	// hashes of an old algorithm or with weaker parameters are upgraded while the password is at hand
+	if rehash {
+		if pass, err := a.passwords.Hash(plain); nil != err {
+			log.Error(err)
+		} else if err := a.repo.UpdatePassword(ctx, u.Id, pass); nil != err {
+			log.Error(err)
+		}
 	}
 
 	// check if user is verified or active
@@ -103,6 +213,16 @@ func (a *userService) Login(ctx context.Context, username, password string) (*mo
 		return nil, app.Error{Code: app.UnauthorizedCode.Int(), Message: "Unauthorized"}
 	}
 
+	// users with 2FA get a challenge token instead, exchanged at /login/2fa, the failed attempts are only reset
+	// once the second factor passed as well
+	if u.TotpEnabled {
+		return a.challengeTwoFactor(ctx, u)
+	}
+
+	if err := a.repo.UnlockLogin(ctx, loginUser(username)); nil != err {
+		log.Error(err)
+	}
+
 	session := model.Session{
 		UserId:     u.Id,
 		Email:      u.Email,
@@ -114,93 +234,536 @@ func (a *userService) Login(ctx context.Context, username, password string) (*mo
 		IsActive:   u.IsActive,
 	}
 
-	// generate new token and update session
-	t, err := token.GenerateToken(session)
-	if err := a.repo.UpdateSession(ctx, session); nil != err {
+	// generate new token pair on a new device session
+	response, err := a.issueToken(ctx, session, "", client)
+	if nil != err {
+		log.Error(err)
 		return nil, app.Error{Code: app.InternalCode.Int(), Message: "Internal Server Error"}
 	}
 
-	return model.NewLoginResponse(u.Username, t), nil
+	return response, nil
 }
 
 func (a *userService) VerifyCode(ctx context.Context, session token.Token, code int) error {
+	failed, err := a.repo.VerificationFailures(ctx, session.Username)
+	if nil != err {
+		return err
+	}
+	if failed >= config.Cfg().VerificationAttempt {
+		return app.TooManyAttemptsError
+	}
+
 	sess, err := a.repo.FindSession(ctx, session.Username)
 	if nil != err {
 		return app.Error{Code: app.InternalCode.Int(), Message: fmt.Sprintf("finding session for user: %s", session.Username)}
 	}
 
-	if sess.Code != code {
+	if sess.Code == 0 || time.Now().Unix() > sess.CodeExpiresAt {
+		return app.InvalidCodeError
+	}
+
+	if subtle.ConstantTimeEq(int32(sess.Code), int32(code)) != 1 {
+		if _, err := a.repo.FailVerification(ctx, session.Username, config.Cfg().VerificationLockout); nil != err {
+			return err
+		}
 		return app.InvalidCodeError
 	}
 
 	if err := a.repo.VerifyUser(ctx, session.Username); nil != err {
 		return err
 	}
+	if err := a.repo.ClearVerificationFailures(ctx, session.Username); nil != err {
+		log.Error(err)
+	}
+
+	a.webhook.Emit(ctx, session.UserId, model.EventUserVerified, model.UserPayload{Id: session.UserId, Username: session.Username})
 
 	return nil
 }
 
-func (a *userService) ListUser(ctx context.Context) ([]*model.UserResponse, error) {
-	var response []*model.UserResponse
-	result, err := a.repo.ListUser(ctx)
+// ListUser returns a page of the users matching the filter.
+func (a *userService) ListUser(ctx context.Context, filter model.UserFilter) (*model.UserListResponse, error) {
+	result, total, err := a.repo.ListUser(ctx, filter)
 	if nil != err {
 		return nil, err
 	}
 
+	response := &model.UserListResponse{Users: []*model.UserResponse{}, Total: total, Page: filter.Page, PerPage: filter.PerPage}
 	for _, r := range result {
-		u := model.NewUserResponse(r.Id, r.FirstName, r.LastName, r.Email, r.Username, r.Password, fmt.Sprintf("%s/api/media/%d", config.Cfg().WebAddress, r.MediaId), "", "")
-		switch r.Role {
-		case UserRole.Int():
-			u.Role = UserRole.String()
-		case AdminRole.Int():
-			u.Role = AdminRole.String()
-		}
-		response = append(response, u)
+		u := model.NewUserResponse(r.Id, r.FirstName, r.LastName, r.Email, r.Username, fmt.Sprintf("%s/api/media/%d", config.Cfg().WebAddress, r.MediaId), r.RoleName, "")
+		response.Users = append(response.Users, u)
 	}
 
 	return response, nil
 }
 
+// ExportUser writes every user matching the filter as CSV, the pagination of the filter is ignored.
+func (a *userService) ExportUser(ctx context.Context, filter model.UserFilter, w io.Writer) error {
+	out := csv.NewWriter(w)
+	if err := out.Write([]string{"id", "first_name", "last_name", "email", "username", "role", "is_verified", "is_active"}); nil != err {
+		return err
+	}
+
+	err := a.repo.EachUser(ctx, filter, func(r *model.User) error {
+		return out.Write([]string{strconv.Itoa(r.Id), csvCell(r.FirstName), csvCell(r.LastName), csvCell(r.Email), csvCell(r.Username),
+			csvCell(r.RoleName), strconv.FormatBool(r.IsVerified), strconv.FormatBool(r.IsActive)})
+	})
+	if nil != err {
+		return err
+	}
+
+	out.Flush()
+	return out.Error()
+}
+
 func (a *userService) DetailUser(ctx context.Context, Id int) (*model.UserResponse, error) {
 	result, err := a.repo.DetailUser(ctx, Id)
 	if nil != err {
 		return nil, err
 	}
 
-	u := model.NewUserResponse(result.Id, result.FirstName, result.LastName, result.Email, result.Username, result.Password, fmt.Sprintf("%s/api/media/%d", config.Cfg().WebAddress, result.MediaId), "", "")
-	switch result.Role {
-	case UserRole.Int():
-		u.Role = UserRole.String()
-	case AdminRole.Int():
-		u.Role = AdminRole.String()
+	u := model.NewUserResponse(result.Id, result.FirstName, result.LastName, result.Email, result.Username, fmt.Sprintf("%s/api/media/%d", config.Cfg().WebAddress, result.MediaId), result.RoleName, "")
+
+	change, err := a.repo.FindEmailChange(ctx, Id)
+	if nil != err && app.NotFoundError != errors.Cause(err) {
+		return nil, err
 	}
+	u.PendingEmail = change.Email
 
 	return u, nil
 }
 
+// UpdateUser saves the profile, a different email address is kept pending until the code mailed to it is confirmed.
 func (a *userService) UpdateUser(ctx context.Context, user *model.User) (*model.UserResponse, error) {
+	current, err := a.repo.DetailUser(ctx, user.Id)
+	if nil != err {
+		return nil, err
+	}
+
 	if err := a.repo.UpdateUser(ctx, user); nil != err {
 		return nil, err
 	}
 
-	u := model.NewUserResponse(user.Id, user.FirstName, user.LastName, user.Email, user.Username, user.Password, fmt.Sprintf("%s/api/media/%d", config.Cfg().WebAddress, user.MediaId), "", "")
-	switch user.Role {
-	case UserRole.Int():
-		u.Role = UserRole.String()
-	case AdminRole.Int():
-		u.Role = AdminRole.String()
+	if !strings.EqualFold(current.Email, user.Email) {
+		if err := a.startEmailChange(ctx, current, user.Email); nil != err {
+			return nil, err
+		}
 	}
 
-	return u, nil
+	return a.DetailUser(ctx, user.Id)
 }
 
+// DeleteUser deactivates the user, their issued tokens and the impersonations they started are revoked with it.
 func (a *userService) DeleteUser(ctx context.Context, id int) error {
 	if err := a.repo.DeleteUser(ctx, id); nil != err {
 		return err
 	}
+	if err := a.repo.RevokeTokens(ctx, id); nil != err {
+		return err
+	}
+
+	a.webhook.Emit(ctx, id, model.EventUserDeactivated, model.UserPayload{Id: id})
+
 	return nil
 }
 
 func (a *userService) ActiveUser(ctx context.Context, id int) error {
 	return a.repo.ActiveUser(ctx, id)
 }
+
+// ForgotPassword mails a single use reset token to the account owning the email.
+// It never reports whether the account exists, the mail is sent in the background to keep the timing identical.
+func (a *userService) ForgotPassword(ctx context.Context, email string) error {
+	u, err := a.repo.FindUserByEmail(ctx, email)
+	if nil != err {
+		if app.NotFoundError != errors.Cause(err) {
+			log.Error(err)
+		}
+		return nil
+	}
+
+	raw := make([]byte, 32)
+	if _, err := crand.Read(raw); nil != err {
+		return err
+	}
+	resetToken := base64.RawURLEncoding.EncodeToString(raw)
+
+	if err := a.repo.SaveResetToken(ctx, hashToken(resetToken), u.Username, config.Cfg().PasswordResetTTL); nil != err {
+		return err
+	}
+
+	go func() {
+		body := fmt.Sprintf("hello %s, \n use this token to reset your password: \n %s \n the token expires in %s",
+			u.Username, resetToken, config.Cfg().PasswordResetTTL)
+		if err := mail.SentMail(u.Email, "Password Reset", body); nil != err {
+			log.Error(err)
+		}
+	}()
+
+	return nil
+}
+
+func (a *userService) ResetPassword(ctx context.Context, token string, password string) error {
+	username, err := a.repo.ConsumeResetToken(ctx, hashToken(token))
+	if nil != err {
+		if app.NotFoundError == errors.Cause(err) {
+			return app.InvalidCodeError
+		}
+		return err
+	}
+
+	u, err := a.repo.FindUser(ctx, username)
+	if nil != err {
+		return app.InvalidCodeError
+	}
+
+	pass, err := a.hashPassword(password, u.Username, u.Email)
+	if nil != err {
+		return err
+	}
+
+	if err := a.repo.UpdatePassword(ctx, u.Id, pass); nil != err {
+		return err
+	}
+
+	// every session issued before the reset is revoked
+	if err := a.repo.RevokeTokens(ctx, u.Id); nil != err {
+		return err
+	}
+	return a.repo.DeleteSession(ctx, username)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (a *userService) UpdateProfile(ctx context.Context, session token.Token, req model.ProfileRequest) (*model.UserResponse, error) {
+	u := model.NewUser(session.UserId, req.FirstName, req.LastName, req.Email, session.Username, "", "", session.RoleId)
+	return a.UpdateUser(ctx, u)
+}
+
+// ChangePassword replaces the password after checking the current one, every other session of the user is revoked
+// and the caller continues with the returned token.
+func (a *userService) ChangePassword(ctx context.Context, session token.Token, current string, password string, client model.Client) (*model.LoginResponse, error) {
+	u, err := a.repo.FindUser(ctx, session.Username)
+	if nil != err {
+		return nil, err
+	}
+
+	if ok, _, _ := a.passwords.Verify(current, u.Password); !ok {
+		return nil, app.UnauthenticateError
+	}
+
+	pass, err := a.hashPassword(password, u.Username, u.Email)
+	if nil != err {
+		return nil, err
+	}
+
+	if err := a.repo.UpdatePassword(ctx, u.Id, pass); nil != err {
+		return nil, err
+	}
+
+	if err := a.repo.RevokeTokens(ctx, u.Id); nil != err {
+		return nil, err
+	}
+
+	sess := model.Session{
+		UserId:     u.Id,
+		Email:      u.Email,
+		Username:   u.Username,
+		RoleId:     u.Role,
+		IsVerified: u.IsVerified,
+		IsActive:   u.IsActive,
+	}
+
+	return a.issueToken(ctx, sess, "", client)
+}
+
+// Refresh rotates a refresh token into a new token pair. Presenting a refresh token twice means it leaked,
+// so the whole family of tokens descending from the same login is revoked.
+func (a *userService) Refresh(ctx context.Context, refreshToken string, client model.Client) (*model.LoginResponse, error) {
+	hash := hashToken(refreshToken)
+	rt, err := a.repo.FindRefreshToken(ctx, hash)
+	if nil != err {
+		if app.NotFoundError == errors.Cause(err) {
+			return nil, app.UnauthenticateError
+		}
+		return nil, err
+	}
+
+	revoked, err := a.repo.IsFamilyRevoked(ctx, rt.Family)
+	if nil != err {
+		return nil, err
+	}
+	if revoked {
+		return nil, app.UnauthenticateError
+	}
+
+	first, err := a.repo.UseRefreshToken(ctx, hash)
+	if nil != err {
+		return nil, err
+	}
+	if !first {
+		log.Warnf("refresh token reuse detected for %s, revoking token family", rt.Username)
+		if err := a.repo.RevokeFamily(ctx, rt.Family); nil != err {
+			return nil, err
+		}
+		return nil, app.UnauthenticateError
+	}
+
+	revokedAt, err := a.repo.RevokedAt(ctx, rt.UserId)
+	if nil != err {
+		return nil, err
+	}
+	if rt.IssuedAt < revokedAt {
+		return nil, app.UnauthenticateError
+	}
+
+	u, err := a.repo.FindUser(ctx, rt.Username)
+	if nil != err {
+		return nil, app.UnauthenticateError
+	}
+	if !u.IsVerified || !u.IsActive {
+		return nil, app.UnauthorizedError
+	}
+
+	session := model.Session{
+		UserId:     u.Id,
+		Email:      u.Email,
+		Username:   u.Username,
+		RoleId:     u.Role,
+		IsVerified: u.IsVerified,
+		IsActive:   u.IsActive,
+	}
+
+	return a.issueToken(ctx, session, rt.Family, client)
+}
+
+// Logout denies the access token until it expires and ends its device session, revoking the family of the given refresh token.
+func (a *userService) Logout(ctx context.Context, session token.Token, refreshToken string) error {
+	if err := a.repo.DenyToken(ctx, session.Id, time.Until(time.Unix(session.ExpiresAt, 0))); nil != err {
+		return err
+	}
+
+	if refreshToken != "" {
+		rt, err := a.repo.FindRefreshToken(ctx, hashToken(refreshToken))
+		if nil != err && app.NotFoundError != errors.Cause(err) {
+			return err
+		}
+		if nil == err && rt.UserId == session.UserId {
+			if err := a.repo.RevokeFamily(ctx, rt.Family); nil != err {
+				return err
+			}
+		}
+	}
+
+	if session.Sid != "" {
+		if err := a.repo.RevokeDevice(ctx, session.UserId, session.Sid); nil != err && app.NotFoundError != errors.Cause(err) {
+			return err
+		}
+	}
+
+	return a.repo.DeleteSession(ctx, session.Username)
+}
+
+// issueToken generates an access token with a rotating refresh token, an empty family starts a new device session.
+func (a *userService) issueToken(ctx context.Context, session model.Session, family string, client model.Client) (*model.LoginResponse, error) {
+	device := family == ""
+	if device {
+		var err error
+		if family, err = token.RandomString(16); nil != err {
+			return nil, err
+		}
+	}
+	session.SessionId = family
+
+	t, err := token.GenerateToken(session)
+	if nil != err {
+		return nil, err
+	}
+
+	refresh, err := token.RandomString(32)
+	if nil != err {
+		return nil, err
+	}
+
+	rt := model.RefreshToken{UserId: session.UserId, Username: session.Username, Family: family, IssuedAt: time.Now().Unix()}
+	if err := a.repo.SaveRefreshToken(ctx, hashToken(refresh), rt); nil != err {
+		return nil, err
+	}
+
+	if device {
+		now := time.Now()
+		err = a.repo.SaveDevice(ctx, session.UserId, model.Device{Id: family, UserAgent: client.UserAgent, Ip: client.Ip, CreatedAt: now, LastSeenAt: now})
+	} else {
+		err = a.repo.TouchDevice(ctx, session.UserId, family, client)
+	}
+	if nil != err {
+		return nil, err
+	}
+
+	response := model.NewLoginResponse(session.Username, t)
+	response.RefreshToken = refresh
+	return response, nil
+}
+
+// ResendVerification mails a fresh verification code and link to an unverified account, at most once per cooldown.
+// Like ForgotPassword it never reports whether the account exists, requests within the cooldown are dropped silently.
+func (a *userService) ResendVerification(ctx context.Context, email string) error {
+	u, err := a.repo.FindUserByEmail(ctx, email)
+	if nil != err {
+		if app.NotFoundError != errors.Cause(err) {
+			log.Error(err)
+		}
+		return nil
+	}
+	if u.IsVerified {
+		return nil
+	}
+
+	acquired, err := a.repo.AcquireResend(ctx, u.Username, config.Cfg().VerificationCooldown)
+	if nil != err {
+		return err
+	}
+	if !acquired {
+		return nil
+	}
+
+	session := model.Session{
+		UserId:   u.Id,
+		Email:    u.Email,
+		Username: u.Username,
+		RoleId:   u.Role,
+		IsActive: u.IsActive,
+	}
+	if err := a.newVerification(ctx, &session); nil != err {
+		return err
+	}
+	if err := a.repo.UpdateSession(ctx, session); nil != err {
+		return err
+	}
+
+	a.mailer.Add(session)
+
+	return nil
+}
+
+// VerifyLink verifies the account owning the magic link token, it does not require a JWT.
+func (a *userService) VerifyLink(ctx context.Context, link string) error {
+	username, err := a.repo.ConsumeVerificationLink(ctx, hashToken(link))
+	if nil != err {
+		if app.NotFoundError == errors.Cause(err) {
+			return app.InvalidCodeError
+		}
+		return err
+	}
+
+	u, err := a.repo.FindUser(ctx, username)
+	if nil != err {
+		return app.InvalidCodeError
+	}
+
+	if err := a.repo.VerifyUser(ctx, username); nil != err {
+		return err
+	}
+	if err := a.repo.ClearVerificationFailures(ctx, username); nil != err {
+		log.Error(err)
+	}
+
+	a.webhook.Emit(ctx, u.Id, model.EventUserVerified, model.UserPayload{Id: u.Id, Username: u.Username})
+
+	return nil
+}
+
+// newVerification sets a crypto random six digit code and a magic link token on the session, both expire together.
+func (a *userService) newVerification(ctx context.Context, session *model.Session) error {
+	n, err := crand.Int(crand.Reader, big.NewInt(900000))
+	if nil != err {
+		return err
+	}
+
+	link, err := token.RandomString(32)
+	if nil != err {
+		return err
+	}
+
+	if err := a.repo.SaveVerificationLink(ctx, hashToken(link), session.Username, config.Cfg().VerificationTTL); nil != err {
+		return err
+	}
+
+	session.Code = 100000 + int(n.Int64())
+	session.CodeExpiresAt = time.Now().Add(config.Cfg().VerificationTTL).Unix()
+	session.LinkToken = link
+	session.IsSent = false
+
+	return nil
+}
+
+// UnlockUser lifts the login lockout of the user and resets the failed attempts.
+func (a *userService) UnlockUser(ctx context.Context, id int) error {
+	u, err := a.repo.DetailUser(ctx, id)
+	if nil != err {
+		return err
+	}
+
+	return a.repo.UnlockLogin(ctx, loginUser(u.Username))
+}
+
+// failLogin counts a failed login for the username and the client address and locks them out once they reach
+// the threshold, the user is notified by email when the account gets locked.
+func (a *userService) failLogin(ctx context.Context, u model.User, ip string) error {
+	ipFailed, err := a.repo.FailLogin(ctx, loginIp(ip), config.Cfg().LoginAttemptWindow)
+	if nil != err {
+		return err
+	}
+	if ipFailed >= config.Cfg().LoginIpMaxAttempt {
+		lock, err := a.repo.LockLogin(ctx, loginIp(ip), config.Cfg().LoginLockout, config.Cfg().LoginMaxLockout)
+		if nil != err {
+			return err
+		}
+		return app.Locked(lock)
+	}
+
+	failed, err := a.repo.FailLogin(ctx, loginUser(u.Username), config.Cfg().LoginAttemptWindow)
+	if nil != err {
+		return err
+	}
+	if failed < config.Cfg().LoginMaxAttempt {
+		return app.Error{Code: app.UnauthenticatedCode.Int(), Message: "Unauthenticated"}
+	}
+
+	lock, err := a.repo.LockLogin(ctx, loginUser(u.Username), config.Cfg().LoginLockout, config.Cfg().LoginMaxLockout)
+	if nil != err {
+		return err
+	}
+
+	if u.Email != "" {
+		go func() {
+			body := fmt.Sprintf("hello %s, \n your account was locked for %s after %d failed login attempts. \n if this was not you, consider changing your password.",
+				u.Username, lock, failed)
+			if err := mail.SentMail(u.Email, "Account Locked", body); nil != err {
+				log.Error(err)
+			}
+		}()
+	}
+
+	return app.Locked(lock)
+}
+
+func loginUser(username string) string {
+	return fmt.Sprintf("user:%s", username)
+}
+
+func loginIp(ip string) string {
+	return fmt.Sprintf("ip:%s", ip)
+}
+
+// csvCell keeps spreadsheet applications from evaluating user supplied values as formulas.
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+
+	return value
+}
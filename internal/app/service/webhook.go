@@ -0,0 +1,202 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/log"
+	"net/http"
+	"refactory/notes/internal/app/model"
+	"refactory/notes/internal/app/repository"
+	"refactory/notes/internal/config"
+	"strconv"
+	"time"
+)
+
+type WebhookService interface {
+	CreateWebhook(ctx context.Context, userId int, req model.WebhookRequest) (*model.WebhookResponse, error)
+	ListWebhook(ctx context.Context, userId int, roleId int) ([]*model.WebhookResponse, error)
+	DeleteWebhook(ctx context.Context, userId int, id int, roleId int) error
+	ListDelivery(ctx context.Context, userId int, webhookId int, roleId int) ([]*model.WebhookDeliveryResponse, error)
+	ReplayDelivery(ctx context.Context, userId int, id int, roleId int) (*model.WebhookDeliveryResponse, error)
+	Emit(ctx context.Context, userId int, event string, data interface{})
+}
+
+const (
+	webhookBatch        = 20
+	webhookPollInterval = time.Second * 5
+)
+
+type webhookService struct {
+	repo   repository.WebhookRepository
+	client *http.Client
+}
+
+func NewWebhookService(repo repository.WebhookRepository) WebhookService {
+	w := &webhookService{repo: repo, client: &http.Client{Timeout: config.Cfg().WebhookTimeout}}
+	go w.loop()
+	return w
+}
+
+func (w *webhookService) CreateWebhook(ctx context.Context, userId int, req model.WebhookRequest) (*model.WebhookResponse, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); nil != err {
+		return nil, errors.Wrap(err, "[webhook] CreateWebhook - generate secret")
+	}
+
+	webhook := model.NewWebhook(0, userId, req.Url, hex.EncodeToString(secret), req.Events)
+	if err := w.repo.InsertWebhook(ctx, webhook); nil != err {
+		return nil, err
+	}
+
+	// the secret is only revealed once, at creation time
+	return model.NewWebhookResponse(webhook.Id, webhook.Url, webhook.Events, webhook.Secret, webhook.IsActive, webhook.CreatedAt), nil
+}
+
+func (w *webhookService) ListWebhook(ctx context.Context, userId int, roleId int) ([]*model.WebhookResponse, error) {
+	var responses []*model.WebhookResponse
+	result, err := w.repo.ListWebhook(ctx, userId, roleId)
+	if nil != err {
+		return nil, err
+	}
+
+	for _, r := range result {
+		responses = append(responses, model.NewWebhookResponse(r.Id, r.Url, r.Events, "", r.IsActive, r.CreatedAt))
+	}
+
+	return responses, nil
+}
+
+func (w *webhookService) DeleteWebhook(ctx context.Context, userId int, id int, roleId int) error {
+	return w.repo.DeleteWebhook(ctx, userId, id, roleId)
+}
+
+func (w *webhookService) ListDelivery(ctx context.Context, userId int, webhookId int, roleId int) ([]*model.WebhookDeliveryResponse, error) {
+	var responses []*model.WebhookDeliveryResponse
+	result, err := w.repo.ListDelivery(ctx, userId, webhookId, roleId)
+	if nil != err {
+		return nil, err
+	}
+
+	for _, r := range result {
+		responses = append(responses, model.NewWebhookDeliveryResponse(r))
+	}
+
+	return responses, nil
+}
+
+func (w *webhookService) ReplayDelivery(ctx context.Context, userId int, id int, roleId int) (*model.WebhookDeliveryResponse, error) {
+	result, err := w.repo.ReplayDelivery(ctx, userId, id, roleId)
+	if nil != err {
+		return nil, err
+	}
+
+	return model.NewWebhookDeliveryResponse(result), nil
+}
+
+// Emit records a pending delivery for every webhook subscribed to the event.
+// Failures are logged so that the originating request is never rejected because of a webhook.
+func (w *webhookService) Emit(ctx context.Context, userId int, event string, data interface{}) {
+	subscribers, err := w.repo.FindSubscriber(ctx, userId, event)
+	if nil != err {
+		log.Error(errors.Wrap(err, fmt.Sprintf("[webhook] Emit - finding subscriber for %s", event)))
+		return
+	}
+	if len(subscribers) == 0 {
+		return
+	}
+
+	payload, err := json.Marshal(model.WebhookEvent{Event: event, UserId: userId, CreatedAt: time.Now().UTC(), Data: data})
+	if nil != err {
+		log.Error(errors.Wrap(err, fmt.Sprintf("[webhook] Emit - marshal %s", event)))
+		return
+	}
+
+	for _, s := range subscribers {
+		delivery := model.WebhookDelivery{WebhookId: s.Id, Event: event, Payload: string(payload)}
+		if err := w.repo.InsertDelivery(ctx, &delivery); nil != err {
+			log.Error(errors.Wrap(err, fmt.Sprintf("[webhook] Emit - queue %s for webhook %d", event, s.Id)))
+		}
+	}
+}
+
+func (w *webhookService) loop() {
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx := context.Background()
+		deliveries, err := w.repo.ClaimDelivery(ctx, webhookBatch, config.Cfg().WebhookTimeout*2)
+		if nil != err {
+			log.Error(err)
+			continue
+		}
+
+		for _, d := range deliveries {
+			w.deliver(ctx, d)
+		}
+	}
+}
+
+func (w *webhookService) deliver(ctx context.Context, d model.WebhookDelivery) {
+	d.Attempts++
+	d.ResponseCode, d.LastError = w.send(ctx, d)
+
+	if d.LastError == "" {
+		now := time.Now().UTC()
+		d.Status = model.DeliveryStatusSuccess
+		d.DeliveredAt = &now
+	} else if d.Attempts >= config.Cfg().WebhookMaxAttempt {
+		d.Status = model.DeliveryStatusFailed
+		log.Errorf("giving up webhook delivery %d to %s after %d attempts: %s", d.Id, d.Url, d.Attempts, d.LastError)
+	} else {
+		d.Status = model.DeliveryStatusPending
+		d.NextAttemptAt = time.Now().UTC().Add(backoff(d.Attempts))
+	}
+
+	if err := w.repo.UpdateDelivery(ctx, &d); nil != err {
+		log.Error(err)
+	}
+}
+
+func (w *webhookService) send(ctx context.Context, d model.WebhookDelivery) (int, string) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.Url, bytes.NewBufferString(d.Payload))
+	if nil != err {
+		return 0, err.Error()
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Event", d.Event)
+	req.Header.Set("X-Webhook-Delivery", strconv.Itoa(d.Id))
+	req.Header.Set("X-Webhook-Signature", fmt.Sprintf("sha256=%s", sign(d.Secret, []byte(d.Payload))))
+
+	resp, err := w.client.Do(req)
+	if nil != err {
+		return 0, err.Error()
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Sprintf("unexpected status %s", resp.Status)
+	}
+
+	return resp.StatusCode, ""
+}
+
+// sign returns the hex encoded HMAC-SHA256 of the payload, receivers recompute it with their secret.
+func sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// backoff doubles the configured base delay for every failed attempt.
+func backoff(attempts int) time.Duration {
+	return config.Cfg().WebhookBackoff * time.Duration(1<<uint(attempts-1))
+}
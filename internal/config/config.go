@@ -2,29 +2,83 @@ package config
 
 import (
 	"fmt"
+	"github.com/pkg/errors"
 	"github.com/spf13/viper"
+	"golang.org/x/crypto/bcrypt"
+	"net"
+	"strings"
 	"time"
 )
 
 type Config struct {
-	WebAddress         string        `mapstructure:"web_address"`
-	WebReadTimeout     time.Duration `mapstructure:"web_read_timeout"`
-	WebWriteTimeout    time.Duration `mapstructure:"web_write_timeout"`
-	WebShutdownTimeout time.Duration `mapstructure:"web_shutdown_timeout"`
-	PgHost             string        `mapstructure:"pg_host"`
-	PgPort             string        `mapstructure:"pg_port"`
-	PgUser             string        `mapstructure:"pg_user"`
-	PgPassword         string        `mapstructure:"pg_password"`
-	PgName             string        `mapstructure:"pg_name"`
-	RdrHost            string        `mapstructure:"rdr_host"`
-	RdrPort            string        `mapstructure:"rdr_port"`
-	RdrDb              int           `mapstructure:"rdr_db"`
-	RdrPool            int           `mapstructure:"rdr_pool"`
-	MailHost           string        `mapstructure:"mail_host"`
-	MailPort           int           `mapstructure:"mail_port"`
-	MailUser           string        `mapstructure:"mail_user"`
-	MailPassword       string        `mapstructure:"mail_password"`
-	IsDev              bool          `mapstructure:"is_dev"`
+	WebAddress           string        `mapstructure:"web_address"`
+	WebReadTimeout       time.Duration `mapstructure:"web_read_timeout"`
+	WebWriteTimeout      time.Duration `mapstructure:"web_write_timeout"`
+	WebShutdownTimeout   time.Duration `mapstructure:"web_shutdown_timeout"`
+	WebTrustedProxies    string        `mapstructure:"web_trusted_proxies"`
+	PgHost               string        `mapstructure:"pg_host"`
+	PgPort               string        `mapstructure:"pg_port"`
+	PgUser               string        `mapstructure:"pg_user"`
+	PgPassword           string        `mapstructure:"pg_password"`
+	PgName               string        `mapstructure:"pg_name"`
+	RdrHost              string        `mapstructure:"rdr_host"`
+	RdrPort              string        `mapstructure:"rdr_port"`
+	RdrDb                int           `mapstructure:"rdr_db"`
+	RdrPool              int           `mapstructure:"rdr_pool"`
+	MailHost             string        `mapstructure:"mail_host"`
+	MailPort             int           `mapstructure:"mail_port"`
+	MailUser             string        `mapstructure:"mail_user"`
+	MailPassword         string        `mapstructure:"mail_password"`
+	IsDev                bool          `mapstructure:"is_dev"`
+	WebhookMaxAttempt    int           `mapstructure:"webhook_max_attempt"`
+	WebhookBackoff       time.Duration `mapstructure:"webhook_backoff"`
+	WebhookTimeout       time.Duration `mapstructure:"webhook_timeout"`
+	StatsTTL             time.Duration `mapstructure:"stats_ttl"`
+	StatsWindow          int           `mapstructure:"stats_window"`
+	QuotaMaxNotes        int           `mapstructure:"quota_max_notes"`
+	QuotaMaxBodySize     int           `mapstructure:"quota_max_body_size"`
+	QuotaMaxMediaBytes   int64         `mapstructure:"quota_max_media_bytes"`
+	PasswordResetTTL     time.Duration `mapstructure:"password_reset_ttl"`
+	AccessTokenTTL       time.Duration `mapstructure:"access_token_ttl"`
+	RefreshTokenTTL      time.Duration `mapstructure:"refresh_token_ttl"`
+	TotpIssuer           string        `mapstructure:"totp_issuer"`
+	VerificationTTL      time.Duration `mapstructure:"verification_ttl"`
+	VerificationAttempt  int64         `mapstructure:"verification_max_attempt"`
+	VerificationLockout  time.Duration `mapstructure:"verification_lockout"`
+	VerificationCooldown time.Duration `mapstructure:"verification_resend_cooldown"`
+	VerificationUrl      string        `mapstructure:"verification_url"`
+	PolicyChannel        string        `mapstructure:"policy_channel"`
+	PolicyReload         time.Duration `mapstructure:"policy_reload_interval"`
+	LoginMaxAttempt      int64         `mapstructure:"login_max_attempt"`
+	LoginIpMaxAttempt    int64         `mapstructure:"login_ip_max_attempt"`
+	LoginAttemptWindow   time.Duration `mapstructure:"login_attempt_window"`
+	LoginLockout         time.Duration `mapstructure:"login_lockout"`
+	LoginMaxLockout      time.Duration `mapstructure:"login_max_lockout"`
+	OidcIssuer           string        `mapstructure:"oidc_issuer"`
+	OidcClientId         string        `mapstructure:"oidc_client_id"`
+	OidcClientSecret     string        `mapstructure:"oidc_client_secret"`
+	OidcRedirectUrl      string        `mapstructure:"oidc_redirect_url"`
+	OidcScopes           string        `mapstructure:"oidc_scopes"`
+	OidcGroupsClaim      string        `mapstructure:"oidc_groups_claim"`
+	OidcRoleMapping      string        `mapstructure:"oidc_role_mapping"`
+	OidcStateTTL         time.Duration `mapstructure:"oidc_state_ttl"`
+	JwtPrivateKey        string        `mapstructure:"jwt_private_key"`
+	JwtKeyId             string        `mapstructure:"jwt_key_id"`
+	JwtPublicKeys        string        `mapstructure:"jwt_public_keys"`
+	JwtIssuer            string        `mapstructure:"jwt_issuer"`
+	JwtAudience          string        `mapstructure:"jwt_audience"`
+	ErasureGracePeriod   time.Duration `mapstructure:"erasure_grace_period"`
+	InviteOnly           bool          `mapstructure:"invite_only"`
+	InvitationTTL        time.Duration `mapstructure:"invitation_ttl"`
+	InvitationUrl        string        `mapstructure:"invitation_url"`
+	ImpersonationTTL     time.Duration `mapstructure:"impersonation_ttl"`
+	PasswordHasher       string        `mapstructure:"password_hasher"`
+	Argon2Time           uint32        `mapstructure:"argon2_time"`
+	Argon2Memory         uint32        `mapstructure:"argon2_memory"`
+	Argon2Threads        uint8         `mapstructure:"argon2_threads"`
+	BcryptCost           int           `mapstructure:"bcrypt_cost"`
+	PasswordMinLength    int           `mapstructure:"password_min_length"`
+	PasswordMinEntropy   float64       `mapstructure:"password_min_entropy"`
 }
 
 func load() Config {
@@ -34,6 +88,48 @@ func load() Config {
 	v.SetConfigFile(".env")
 	v.AddConfigPath(".")
 
+	v.SetDefault("webhook_max_attempt", 8)
+	v.SetDefault("webhook_backoff", time.Second*30)
+	v.SetDefault("webhook_timeout", time.Second*10)
+	v.SetDefault("stats_ttl", time.Minute)
+	v.SetDefault("stats_window", 30)
+	v.SetDefault("quota_max_notes", 1000)
+	v.SetDefault("quota_max_body_size", 1<<20)
+	v.SetDefault("quota_max_media_bytes", 100<<20)
+	v.SetDefault("password_reset_ttl", time.Minute*30)
+	v.SetDefault("access_token_ttl", time.Minute*15)
+	v.SetDefault("refresh_token_ttl", time.Hour*24*30)
+	v.SetDefault("totp_issuer", "RSP Notes")
+	v.SetDefault("verification_ttl", time.Minute*15)
+	v.SetDefault("verification_max_attempt", 5)
+	v.SetDefault("verification_lockout", time.Minute*15)
+	v.SetDefault("verification_resend_cooldown", time.Minute)
+	v.SetDefault("verification_url", "http://localhost:8080/api/verification/link")
+	v.SetDefault("policy_channel", "casbin:policy")
+	v.SetDefault("policy_reload_interval", time.Minute*5)
+	v.SetDefault("login_max_attempt", 5)
+	v.SetDefault("login_ip_max_attempt", 50)
+	v.SetDefault("login_attempt_window", time.Minute*15)
+	v.SetDefault("login_lockout", time.Minute)
+	v.SetDefault("login_max_lockout", time.Hour*24)
+	v.SetDefault("oidc_redirect_url", "http://localhost:8080/api/oidc/callback")
+	v.SetDefault("oidc_scopes", "openid profile email groups")
+	v.SetDefault("oidc_groups_claim", "groups")
+	v.SetDefault("oidc_state_ttl", time.Minute*10)
+	v.SetDefault("jwt_issuer", "http://localhost:8080")
+	v.SetDefault("jwt_audience", "rsp-notes")
+	v.SetDefault("erasure_grace_period", time.Hour*24*7)
+	v.SetDefault("invitation_ttl", time.Hour*24*7)
+	v.SetDefault("invitation_url", "http://localhost:8080/signup")
+	v.SetDefault("impersonation_ttl", time.Minute*30)
+	v.SetDefault("password_hasher", "argon2id")
+	v.SetDefault("argon2_time", 3)
+	v.SetDefault("argon2_memory", 64*1024)
+	v.SetDefault("argon2_threads", 2)
+	v.SetDefault("bcrypt_cost", 12)
+	v.SetDefault("password_min_length", 8)
+	v.SetDefault("password_min_entropy", 40)
+
 	v.AutomaticEnv()
 	v.ReadInConfig()
 	v.Unmarshal(&config)
@@ -47,6 +143,46 @@ func Cfg() *Config {
 	return &cfg
 }
 
+// Validate rejects settings that would only fail once they are used, such as hashing parameters argon2 panics on.
+func (c *Config) Validate() error {
+	if c.PasswordHasher != "argon2id" && c.PasswordHasher != "bcrypt" {
+		return errors.Errorf("password_hasher must be argon2id or bcrypt, got %q", c.PasswordHasher)
+	}
+	if c.Argon2Time < 1 {
+		return errors.New("argon2_time must be at least 1")
+	}
+	if c.Argon2Threads < 1 {
+		return errors.New("argon2_threads must be at least 1")
+	}
+	if c.Argon2Memory < 8*uint32(c.Argon2Threads) {
+		return errors.Errorf("argon2_memory must be at least %d KiB for %d threads", 8*uint32(c.Argon2Threads), c.Argon2Threads)
+	}
+	if c.BcryptCost < bcrypt.MinCost || c.BcryptCost > bcrypt.MaxCost {
+		return errors.Errorf("bcrypt_cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	if _, err := c.TrustedProxies(); nil != err {
+		return err
+	}
+	return nil
+}
+
+// TrustedProxies parses the comma separated CIDR ranges of web_trusted_proxies.
+func (c *Config) TrustedProxies() ([]*net.IPNet, error) {
+	var ranges []*net.IPNet
+	for _, cidr := range strings.Split(c.WebTrustedProxies, ",") {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if nil != err {
+			return nil, errors.Wrapf(err, "web_trusted_proxies has an invalid range %q", cidr)
+		}
+		ranges = append(ranges, ipNet)
+	}
+	return ranges, nil
+}
+
 func (c *Config) String() string {
 	return fmt.Sprintf("Host: %s User: %s Password: %s DbName: %s", c.PgHost, c.PgUser, c.PgPassword, c.PgName)
 }
@@ -24,3 +24,20 @@ func Sent(name, email string, code int) error {
 
 	return nil
 }
+
+func SentMail(email, subject, body string) error {
+	dialer := gomail.NewDialer(config.Cfg().MailHost, config.Cfg().MailPort, config.Cfg().MailUser, config.Cfg().MailPassword)
+	dialer.TLSConfig = &tls.Config{InsecureSkipVerify: true}
+
+	mailer := gomail.NewMessage()
+	mailer.SetHeader("From", config.Cfg().MailUser)
+	mailer.SetHeader("To", email)
+	mailer.SetHeader("Subject", subject)
+	mailer.SetBody("text/html", body)
+
+	if err := dialer.DialAndSend(mailer); nil != err {
+		return errors.Wrap(err, fmt.Sprintf("[mailer] SentMail - Sending email to %s", email))
+	}
+
+	return nil
+}
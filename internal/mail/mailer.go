@@ -10,6 +10,7 @@ import (
 	"refactory/notes/internal/app/model"
 	"refactory/notes/internal/app/repository"
 	"refactory/notes/internal/config"
+	"time"
 )
 
 type Mailer interface {
@@ -54,7 +55,7 @@ func (c *mailer) loop() {
 				message.SetHeader("From", config.Cfg().MailUser)
 				message.SetHeader("To", s.Email)
 				message.SetHeader("Subject", "Register Verification")
-				message.SetBody("text/html", fmt.Sprintf("hello %s, \n this is your verification code: \n %d", s.Username, s.Code))
+				message.SetBody("text/html", verificationBody(s))
 
 				if err := c.sent(message); nil == err {
 					// removing session from queue when success updating session
@@ -82,3 +83,11 @@ func (c *mailer) sent(message *gomail.Message) error {
 
 	return nil
 }
+
+func verificationBody(s model.Session) string {
+	body := fmt.Sprintf("hello %s, \n this is your verification code: \n %d", s.Username, s.Code)
+	if s.LinkToken != "" {
+		body = fmt.Sprintf("%s \n or verify your account with this link: \n %s?token=%s", body, config.Cfg().VerificationUrl, s.LinkToken)
+	}
+	return fmt.Sprintf("%s \n the code expires at %s", body, time.Unix(s.CodeExpiresAt, 0).UTC().Format(time.RFC1123))
+}
@@ -1,26 +1,165 @@
 package middleware
 
 import (
+	"context"
+	"fmt"
+	"github.com/casbin/casbin/v2"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/prometheus/common/log"
+	"net/http"
+	"refactory/notes/internal/app"
+	"refactory/notes/internal/app/model"
+	"refactory/notes/internal/db/redis"
 	"refactory/notes/internal/security/token"
+	"refactory/notes/internal/web"
+	"strconv"
+	"strings"
 )
 
-func Auth(next echo.HandlerFunc) echo.HandlerFunc {
+// AccessTokenFinder resolves the hash of a personal access token into the token and its owner.
+type AccessTokenFinder interface {
+	UseAccessToken(ctx context.Context, hash string) (model.AccessToken, error)
+}
+
+// ImpersonationRecorder keeps the trail of the requests made with an impersonation token.
+type ImpersonationRecorder interface {
+	RecordImpersonation(ctx context.Context, impersonationId int, method string, path string, status int) error
+}
+
+type Authentication struct {
+	cache          redis.Client
+	tokens         AccessTokenFinder
+	impersonations ImpersonationRecorder
+	enforcer       *casbin.SyncedEnforcer
+}
+
+func NewAuthentication(cache redis.Client, tokens AccessTokenFinder, impersonations ImpersonationRecorder, enforcer *casbin.SyncedEnforcer) *Authentication {
+	return &Authentication{cache: cache, tokens: tokens, impersonations: impersonations, enforcer: enforcer}
+}
+
+// Auth exposes the claims of the verified token as the request session,
+// rejecting tokens that were logged out, belong to a revoked device session or were issued before the user, or the admin
+// impersonating them, revoked their sessions.
+// Personal access tokens are accepted as well, limited to the routes allowed by their scopes.
+// Requests made with an impersonation token are recorded with their response status.
+func (a *Authentication) Auth(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
+		if raw, ok := accessToken(c); ok {
+			return a.authAccessToken(c, raw, next)
+		}
+
 		user := c.Get("user").(*jwt.Token)
 		session := user.Claims.(*token.Token)
+
+		// the revocation of the impersonating admin ends the impersonation as well, so does demoting or deactivating them
+		revokedKeys := []string{token.RevokedKey(session.UserId)}
+		if nil != session.Act {
+			revokedKeys = append(revokedKeys, token.RevokedKey(session.Act.UserId))
+		}
+		keys := append(revokedKeys, token.DeniedKey(session.Id))
+		if session.Sid != "" {
+			keys = append(keys, token.FamilyRevokedKey(session.Sid))
+		}
+		marks, err := a.cache.Conn().MGet(c.Request().Context(), keys...).Result()
+		if nil != err {
+			log.Error(err)
+			return web.ResponseError(c, app.InternalError)
+		}
+		for _, mark := range marks[:len(revokedKeys)] {
+			if revoked, ok := mark.(string); ok {
+				if before, _ := strconv.ParseInt(revoked, 10, 64); session.IssuedAt < before {
+					return web.ResponseError(c, app.UnauthenticateError)
+				}
+			}
+		}
+		for _, mark := range marks[len(revokedKeys):] {
+			if nil != mark {
+				return web.ResponseError(c, app.UnauthenticateError)
+			}
+		}
+
 		c.Set("session", session)
+		if nil == session.Act {
+			return next(c)
+		}
+
+		err = next(c)
+		status := c.Response().Status
+		if nil != err {
+			status = http.StatusInternalServerError
+			if he, ok := err.(*echo.HTTPError); ok {
+				status = he.Code
+			}
+		}
+		if rErr := a.impersonations.RecordImpersonation(c.Request().Context(), session.Act.ImpersonationId, c.Request().Method, c.Path(), status); nil != rErr {
+			log.Error(rErr)
+		}
+
+		return err
+	}
+}
+
+// Direct rejects impersonation tokens, it guards the operations only the user themself may perform such as changing
+// their password or exporting their data.
+func (a *Authentication) Direct(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if session, ok := c.Get("session").(*token.Token); ok && nil != session.Act {
+			return web.ResponseError(c, app.UnauthorizedError)
+		}
 
 		return next(c)
 	}
 }
 
+func (a *Authentication) authAccessToken(c echo.Context, raw string, next echo.HandlerFunc) error {
+	accessToken, err := a.tokens.UseAccessToken(c.Request().Context(), token.HashAccessToken(raw))
+	if nil != err {
+		return web.ResponseError(c, err)
+	}
+
+	allowed := false
+	for _, scope := range accessToken.Scopes {
+		ok, err := a.enforcer.Enforce(fmt.Sprintf("scope:%s", scope), model.PersonalDomain, c.Path(), c.Request().Method)
+		if nil != err {
+			log.Error(err)
+			return web.ResponseError(c, app.InternalError)
+		}
+		if ok {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return web.ResponseError(c, app.UnauthorizedError)
+	}
+
+	c.Set("session", &token.Token{
+		StandardClaims: jwt.StandardClaims{Id: fmt.Sprintf("pat:%d", accessToken.Id), IssuedAt: accessToken.CreatedAt.Unix()},
+		UserId:         accessToken.UserId,
+		Username:       accessToken.Username,
+		RoleId:         accessToken.RoleId,
+		Scopes:         accessToken.Scopes,
+	})
+
+	return next(c)
+}
+
+// Claim verifies the JWT of the request against the key named by its kid, personal access tokens are left to Auth.
 func Claim() echo.MiddlewareFunc {
 	conf := middleware.JWTConfig{
-		Claims:     new(token.Token),
-		SigningKey: []byte("secret"),
+		Claims:  new(token.Token),
+		KeyFunc: token.Keyfunc,
+		Skipper: func(c echo.Context) bool {
+			_, ok := accessToken(c)
+			return ok
+		},
 	}
 	return middleware.JWTWithConfig(conf)
 }
+
+func accessToken(c echo.Context) (string, bool) {
+	raw := strings.TrimPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+	return raw, strings.HasPrefix(raw, token.AccessTokenPrefix)
+}
@@ -9,10 +9,10 @@ import (
 )
 
 type Authorization struct {
-	enforcer *casbin.Enforcer
+	enforcer *casbin.SyncedEnforcer
 }
 
-func NewAuthorization(enforcer *casbin.Enforcer) *Authorization {
+func NewAuthorization(enforcer *casbin.SyncedEnforcer) *Authorization {
 	return &Authorization{enforcer: enforcer}
 }
 
@@ -24,7 +24,7 @@ func (a *Authorization) Enforce() echo.MiddlewareFunc {
 				return web.ResponseError(c, app.UnauthenticateError)
 			}
 
-			authorized, err := a.enforcer.Enforce(token.Username, c.Path(), c.Request().Method)
+			authorized, err := a.enforcer.Enforce(token.Username, Domain(c), c.Path(), c.Request().Method)
 			if nil != err || !authorized {
 				return web.ResponseError(c, app.UnauthorizedError)
 			}
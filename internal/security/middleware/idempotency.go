@@ -0,0 +1,158 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/log"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"refactory/notes/internal/app"
+	"refactory/notes/internal/config"
+	"refactory/notes/internal/db/redis"
+	"refactory/notes/internal/security/token"
+	"refactory/notes/internal/web"
+	"time"
+)
+
+const (
+	HeaderIdempotencyKey = "Idempotency-Key"
+	idempotencyTTL       = time.Hour * 24
+	// idempotencyLockTTL bounds the in progress marker when no write timeout is configured, a request that
+	// crashed or panicked only blocks its key until the marker expires.
+	idempotencyLockTTL = time.Minute
+	// idempotencyStoreTimeout bounds the final store of a response, it runs detached from the request so that
+	// a client dropping the connection does not lose the response of a request that was already executed.
+	idempotencyStoreTimeout = time.Second * 5
+)
+
+type Idempotency struct {
+	cache   redis.Client
+	lockTTL time.Duration
+}
+
+func NewIdempotency(cache redis.Client) *Idempotency {
+	lockTTL := idempotencyLockTTL
+	if config.Cfg().WebWriteTimeout > 0 {
+		lockTTL = config.Cfg().WebWriteTimeout
+	}
+	return &Idempotency{cache: cache, lockTTL: lockTTL}
+}
+
+type idempotencyRecord struct {
+	Hash        string `json:"hash"`
+	Done        bool   `json:"done"`
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type"`
+	Body        []byte `json:"body"`
+}
+
+// Handle stores the first response of a request carrying an Idempotency-Key header and replays it for retries with the same key.
+// Server errors are not stored so that the client can retry them.
+func (i *Idempotency) Handle() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key := c.Request().Header.Get(HeaderIdempotencyKey)
+			if key == "" {
+				return next(c)
+			}
+
+			body, err := ioutil.ReadAll(c.Request().Body)
+			if nil != err {
+				return web.ResponseError(c, app.BadRequestError)
+			}
+			c.Request().Body = ioutil.NopCloser(bytes.NewReader(body))
+
+			owner := "anonymous:" + c.RealIP()
+			if session, ok := c.Get("session").(*token.Token); ok {
+				owner = fmt.Sprintf("%d", session.UserId)
+			}
+			cacheKey := fmt.Sprintf("idempotency:%s:%s", owner, key)
+			hash := requestHash(c.Request().Method, c.Path(), body)
+
+			ctx := c.Request().Context()
+			pending, _ := json.Marshal(idempotencyRecord{Hash: hash})
+			created, err := i.cache.Conn().SetNX(ctx, cacheKey, pending, i.lockTTL).Result()
+			if nil != err {
+				log.Error(errors.Wrap(err, "[rdr] Idempotency - lock key"))
+				return web.ResponseError(c, app.InternalError)
+			}
+
+			if !created {
+				var record idempotencyRecord
+				stored, err := i.cache.Conn().Get(ctx, cacheKey).Bytes()
+				if nil != err || nil != json.Unmarshal(stored, &record) {
+					return web.ResponseError(c, app.InternalError)
+				}
+				if record.Hash != hash {
+					return web.ResponseError(c, app.IdempotencyMismatchError)
+				}
+				if !record.Done {
+					return web.ResponseError(c, app.IdempotencyConflictError)
+				}
+
+				c.Response().Header().Set("Idempotent-Replayed", "true")
+				return c.Blob(record.Status, record.ContentType, record.Body)
+			}
+
+			recorder := &responseRecorder{ResponseWriter: c.Response().Writer, body: new(bytes.Buffer)}
+			c.Response().Writer = recorder
+
+			if err := next(c); nil != err {
+				c.Error(err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), idempotencyStoreTimeout)
+			defer cancel()
+
+			if c.Response().Status >= http.StatusInternalServerError {
+				if err := i.cache.Conn().Del(ctx, cacheKey).Err(); nil != err {
+					log.Error(errors.Wrap(err, "[rdr] Idempotency - release key"))
+				}
+				return nil
+			}
+
+			done, _ := json.Marshal(idempotencyRecord{Hash: hash, Done: true, Status: c.Response().Status,
+				ContentType: c.Response().Header().Get(echo.HeaderContentType), Body: recorder.body.Bytes()})
+			if err := i.cache.Conn().Set(ctx, cacheKey, done, idempotencyTTL).Err(); nil != err {
+				log.Error(errors.Wrap(err, "[rdr] Idempotency - save response"))
+			}
+
+			return nil
+		}
+	}
+}
+
+func requestHash(method, path string, body []byte) string {
+	sum := sha256.New()
+	io.WriteString(sum, method)
+	io.WriteString(sum, path)
+	sum.Write(body)
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+type responseRecorder struct {
+	http.ResponseWriter
+	body *bytes.Buffer
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *responseRecorder) Flush() {
+	r.ResponseWriter.(http.Flusher).Flush()
+}
+
+func (r *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return r.ResponseWriter.(http.Hijacker).Hijack()
+}
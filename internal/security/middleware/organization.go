@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"context"
+	"github.com/labstack/echo/v4"
+	"refactory/notes/internal/app"
+	"refactory/notes/internal/app/model"
+	"refactory/notes/internal/security/token"
+	"refactory/notes/internal/web"
+	"strconv"
+)
+
+// HeaderOrg selects the organization a request is made in, it takes precedence over the org claim of the token.
+const HeaderOrg = "X-Org"
+
+// MemberFinder resolves the membership of a user in an organization.
+type MemberFinder interface {
+	FindMember(ctx context.Context, orgId int, userId int) (model.Member, error)
+}
+
+type Organization struct {
+	members MemberFinder
+}
+
+func NewOrganization(members MemberFinder) *Organization {
+	return &Organization{members: members}
+}
+
+// Select sets the organization of the request from the X-Org header or the org claim of the token,
+// the user needs to be a member of it. Requests without one are made in the personal domain.
+func (o *Organization) Select(next echo.HandlerFunc) echo.HandlerFunc {
+	return o.selectOrganization(next, false)
+}
+
+// SelectDeleted is Select also accepting deleted organizations, for sync to serve the tombstones of their notes.
+func (o *Organization) SelectDeleted(next echo.HandlerFunc) echo.HandlerFunc {
+	return o.selectOrganization(next, true)
+}
+
+func (o *Organization) selectOrganization(next echo.HandlerFunc, deleted bool) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		session, ok := c.Get("session").(*token.Token)
+		if !ok {
+			return web.ResponseError(c, app.UnauthenticateError)
+		}
+
+		orgId := session.Org
+		if header := c.Request().Header.Get(HeaderOrg); header != "" {
+			id, err := strconv.Atoi(header)
+			if nil != err || id < 1 {
+				return web.ResponseError(c, app.BadRequestError)
+			}
+			orgId = id
+		}
+
+		if orgId != 0 {
+			member, err := o.members.FindMember(c.Request().Context(), orgId, session.UserId)
+			if nil != err {
+				if app.NotFoundError == err {
+					return web.ResponseError(c, app.UnauthorizedError)
+				}
+				return web.ResponseError(c, err)
+			}
+			if member.Deleted && !deleted {
+				return web.ResponseError(c, app.NotFoundError)
+			}
+		}
+		c.Set("org", orgId)
+
+		return next(c)
+	}
+}
+
+// Domain is the Casbin domain of the request, the organization selected by Select or the personal domain.
+func Domain(c echo.Context) string {
+	if orgId, _ := c.Get("org").(int); orgId != 0 {
+		return model.OrganizationDomain(orgId)
+	}
+
+	return model.PersonalDomain
+}
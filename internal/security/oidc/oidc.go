@@ -0,0 +1,289 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotConfigured is returned when no issuer is configured.
+var ErrNotConfigured = errors.New("oidc provider is not configured")
+
+// Claims are the identity claims of a verified ID token.
+type Claims struct {
+	Issuer            string
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	PreferredUsername string
+	GivenName         string
+	FamilyName        string
+	Groups            []string
+}
+
+// Provider implements the authorization code flow with PKCE against an OpenID Connect issuer.
+// The discovery document and the signing keys are fetched on first use, keys are refetched when an unknown kid shows up.
+type Provider struct {
+	issuer       string
+	clientId     string
+	clientSecret string
+	redirectUrl  string
+	scopes       string
+	groupsClaim  string
+	client       *http.Client
+
+	mu        sync.Mutex
+	discovery *discovery
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksUri               string `json:"jwks_uri"`
+}
+
+func NewProvider(issuer, clientId, clientSecret, redirectUrl, scopes, groupsClaim string) *Provider {
+	return &Provider{issuer: strings.TrimSuffix(issuer, "/"), clientId: clientId, clientSecret: clientSecret,
+		redirectUrl: redirectUrl, scopes: scopes, groupsClaim: groupsClaim, client: &http.Client{Timeout: time.Second * 10}}
+}
+
+func (p *Provider) Enabled() bool {
+	return p.issuer != ""
+}
+
+// AuthCodeURL returns the authorization endpoint the user is redirected to.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	d, err := p.getDiscovery(ctx)
+	if nil != err {
+		return "", err
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.clientId},
+		"redirect_uri":          {p.redirectUrl},
+		"scope":                 {p.scopes},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(sum[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	return fmt.Sprintf("%s?%s", d.AuthorizationEndpoint, query.Encode()), nil
+}
+
+// Exchange redeems the authorization code and returns the verified claims of the ID token.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*Claims, error) {
+	d, err := p.getDiscovery(ctx)
+	if nil != err {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.redirectUrl},
+		"client_id":     {p.clientId},
+		"code_verifier": {verifier},
+	}
+	if p.clientSecret != "" {
+		form.Set("client_secret", p.clientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if nil != err {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if nil != err {
+		return nil, errors.Wrap(err, "[oidc] Exchange - request token")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("[oidc] Exchange - token endpoint responded %d", resp.StatusCode)
+	}
+
+	var body struct {
+		IdToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); nil != err {
+		return nil, errors.Wrap(err, "[oidc] Exchange - decode token")
+	}
+
+	return p.verify(ctx, body.IdToken, nonce)
+}
+
+// verify checks the signature, issuer, audience, expiry and nonce of the ID token.
+func (p *Provider) verify(ctx context.Context, raw string, nonce string) (*Claims, error) {
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(raw, claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, errors.Errorf("unexpected signing method %s", t.Header["alg"])
+		}
+		kid, _ := t.Header["kid"].(string)
+		return p.key(ctx, kid)
+	}); nil != err {
+		return nil, errors.Wrap(err, "[oidc] verify - parse id token")
+	}
+
+	if iss, _ := claims["iss"].(string); strings.TrimSuffix(iss, "/") != p.issuer {
+		return nil, errors.New("[oidc] verify - issuer mismatch")
+	}
+	if _, ok := claims["exp"]; !ok {
+		return nil, errors.New("[oidc] verify - missing expiry")
+	}
+	if !hasAudience(claims["aud"], p.clientId) {
+		return nil, errors.New("[oidc] verify - audience mismatch")
+	}
+	if value, _ := claims["nonce"].(string); value != nonce {
+		return nil, errors.New("[oidc] verify - nonce mismatch")
+	}
+
+	result := &Claims{Issuer: p.issuer}
+	result.Subject, _ = claims["sub"].(string)
+	result.Email, _ = claims["email"].(string)
+	result.EmailVerified, _ = claims["email_verified"].(bool)
+	result.PreferredUsername, _ = claims["preferred_username"].(string)
+	result.GivenName, _ = claims["given_name"].(string)
+	result.FamilyName, _ = claims["family_name"].(string)
+	if groups, ok := claims[p.groupsClaim].([]interface{}); ok {
+		for _, group := range groups {
+			if name, ok := group.(string); ok {
+				result.Groups = append(result.Groups, name)
+			}
+		}
+	}
+	if result.Subject == "" {
+		return nil, errors.New("[oidc] verify - missing subject")
+	}
+
+	return result, nil
+}
+
+func hasAudience(aud interface{}, clientId string) bool {
+	switch value := aud.(type) {
+	case string:
+		return value == clientId
+	case []interface{}:
+		for _, item := range value {
+			if item == clientId {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (p *Provider) getDiscovery(ctx context.Context) (*discovery, error) {
+	if !p.Enabled() {
+		return nil, ErrNotConfigured
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if nil != p.discovery {
+		return p.discovery, nil
+	}
+
+	var d discovery
+	if err := p.getJSON(ctx, fmt.Sprintf("%s/.well-known/openid-configuration", p.issuer), &d); nil != err {
+		return nil, errors.Wrap(err, "[oidc] getDiscovery - fetch configuration")
+	}
+	if strings.TrimSuffix(d.Issuer, "/") != p.issuer {
+		return nil, errors.Errorf("[oidc] getDiscovery - issuer %s does not match", d.Issuer)
+	}
+	p.discovery = &d
+
+	return p.discovery, nil
+}
+
+func (p *Provider) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	d, err := p.getDiscovery(ctx)
+	if nil != err {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	// keys rotate at the provider, but an unknown kid must not make us hammer the jwks endpoint
+	if time.Since(p.fetchedAt) < time.Minute && nil != p.keys {
+		return nil, errors.Errorf("[oidc] key - unknown kid %s", kid)
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := p.getJSON(ctx, d.JwksUri, &jwks); nil != err {
+		return nil, errors.Wrap(err, "[oidc] key - fetch jwks")
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if nil != err {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if nil != err {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	p.keys = keys
+	p.fetchedAt = time.Now()
+
+	key, ok := keys[kid]
+	if !ok {
+		return nil, errors.Errorf("[oidc] key - unknown kid %s", kid)
+	}
+
+	return key, nil
+}
+
+func (p *Provider) getJSON(ctx context.Context, target string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if nil != err {
+		return err
+	}
+
+	resp, err := p.client.Do(req)
+	if nil != err {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("%s responded %d", target, resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
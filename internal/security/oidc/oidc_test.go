@@ -0,0 +1,178 @@
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/url"
+	"refactory/notes/internal/security/oidc/oidctest"
+	"testing"
+	"time"
+)
+
+const (
+	testClientId    = "notes"
+	testRedirectUrl = "http://localhost:8080/api/oidc/callback"
+)
+
+func newTestProvider(t *testing.T) (*Provider, *oidctest.Server) {
+	t.Helper()
+	idp, err := oidctest.NewServer(testClientId)
+	require.NoError(t, err)
+	t.Cleanup(idp.Close)
+
+	return NewProvider(idp.URL, testClientId, "secret", testRedirectUrl, "openid email", "groups"), idp
+}
+
+// exchange redeems a code for the ID token like the callback does.
+func exchange(t *testing.T, p *Provider, idp *oidctest.Server, idToken string, nonce string) (*Claims, error) {
+	t.Helper()
+	return p.Exchange(context.Background(), idp.Code(idToken), "verifier", nonce)
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	p, idp := newTestProvider(t)
+	idp.SetDiscoveryIssuer("https://attacker.example.com")
+
+	_, err := p.AuthCodeURL(context.Background(), "state", "nonce", "verifier")
+	assert.Error(t, err)
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	p, idp := newTestProvider(t)
+
+	raw, err := p.AuthCodeURL(context.Background(), "state", "nonce", "verifier")
+	require.NoError(t, err)
+
+	u, err := url.Parse(raw)
+	require.NoError(t, err)
+	assert.Equal(t, idp.URL+"/authorize", u.Scheme+"://"+u.Host+u.Path)
+
+	sum := sha256.Sum256([]byte("verifier"))
+	query := u.Query()
+	assert.Equal(t, "code", query.Get("response_type"))
+	assert.Equal(t, testClientId, query.Get("client_id"))
+	assert.Equal(t, testRedirectUrl, query.Get("redirect_uri"))
+	assert.Equal(t, "state", query.Get("state"))
+	assert.Equal(t, "nonce", query.Get("nonce"))
+	assert.Equal(t, "S256", query.Get("code_challenge_method"))
+	assert.Equal(t, base64.RawURLEncoding.EncodeToString(sum[:]), query.Get("code_challenge"))
+}
+
+func TestExchangeSendsVerifier(t *testing.T) {
+	p, idp := newTestProvider(t)
+
+	claims := idp.Claims("alice", "nonce")
+	claims["email"] = "alice@example.com"
+	claims["email_verified"] = true
+	claims["groups"] = []string{"engineering"}
+	idToken, err := idp.Sign(claims)
+	require.NoError(t, err)
+
+	code := idp.Code(idToken)
+	result, err := p.Exchange(context.Background(), code, "the-verifier", "nonce")
+	require.NoError(t, err)
+
+	requests := idp.TokenRequests()
+	require.Len(t, requests, 1)
+	assert.Equal(t, "authorization_code", requests[0].Get("grant_type"))
+	assert.Equal(t, code, requests[0].Get("code"))
+	assert.Equal(t, "the-verifier", requests[0].Get("code_verifier"))
+	assert.Equal(t, testRedirectUrl, requests[0].Get("redirect_uri"))
+	assert.Equal(t, "secret", requests[0].Get("client_secret"))
+
+	assert.Equal(t, &Claims{Issuer: idp.URL, Subject: "alice", Email: "alice@example.com", EmailVerified: true,
+		Groups: []string{"engineering"}}, result)
+}
+
+func TestVerifyRejects(t *testing.T) {
+	p, idp := newTestProvider(t)
+
+	rogue, err := oidctest.NewKey("key-0")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		claims func(jwt.MapClaims)
+		rogue  bool
+	}{
+		{name: "bad signature", rogue: true},
+		{name: "issuer", claims: func(c jwt.MapClaims) { c["iss"] = "https://attacker.example.com" }},
+		{name: "audience", claims: func(c jwt.MapClaims) { c["aud"] = "other-client" }},
+		{name: "audience list", claims: func(c jwt.MapClaims) { c["aud"] = []string{"other-client", "another"} }},
+		{name: "nonce", claims: func(c jwt.MapClaims) { c["nonce"] = "replayed" }},
+		{name: "missing nonce", claims: func(c jwt.MapClaims) { delete(c, "nonce") }},
+		{name: "missing expiry", claims: func(c jwt.MapClaims) { delete(c, "exp") }},
+		{name: "expired", claims: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() }},
+		{name: "missing subject", claims: func(c jwt.MapClaims) { delete(c, "sub") }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := idp.Claims("alice", "nonce")
+			if nil != tt.claims {
+				tt.claims(claims)
+			}
+
+			var idToken string
+			if tt.rogue {
+				idToken, err = oidctest.SignWith(rogue, claims)
+			} else {
+				idToken, err = idp.Sign(claims)
+			}
+			require.NoError(t, err)
+
+			_, err := exchange(t, p, idp, idToken, "nonce")
+			assert.Error(t, err)
+		})
+	}
+
+	t.Run("unsigned", func(t *testing.T) {
+		idToken, err := jwt.NewWithClaims(jwt.SigningMethodNone, idp.Claims("alice", "nonce")).SignedString(jwt.UnsafeAllowNoneSignatureType)
+		require.NoError(t, err)
+
+		_, err = exchange(t, p, idp, idToken, "nonce")
+		assert.Error(t, err)
+	})
+
+	t.Run("audience in list", func(t *testing.T) {
+		claims := idp.Claims("alice", "nonce")
+		claims["aud"] = []string{"other-client", testClientId}
+		idToken, err := idp.Sign(claims)
+		require.NoError(t, err)
+
+		_, err = exchange(t, p, idp, idToken, "nonce")
+		assert.NoError(t, err)
+	})
+}
+
+func TestKeyRotation(t *testing.T) {
+	p, idp := newTestProvider(t)
+
+	idToken, err := idp.Sign(idp.Claims("alice", "nonce"))
+	require.NoError(t, err)
+	_, err = exchange(t, p, idp, idToken, "nonce")
+	require.NoError(t, err)
+
+	require.NoError(t, idp.Rotate())
+	rotated, err := idp.Sign(idp.Claims("alice", "nonce"))
+	require.NoError(t, err)
+
+	// an unknown kid right after fetching the keys does not refetch them
+	_, err = exchange(t, p, idp, rotated, "nonce")
+	assert.Error(t, err)
+
+	p.mu.Lock()
+	p.fetchedAt = time.Now().Add(-time.Minute * 2)
+	p.mu.Unlock()
+
+	_, err = exchange(t, p, idp, rotated, "nonce")
+	assert.NoError(t, err)
+
+	// the keys fetched now no longer hold the retired kid
+	_, err = exchange(t, p, idp, idToken, "nonce")
+	assert.Error(t, err)
+}
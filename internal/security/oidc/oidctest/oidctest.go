@@ -0,0 +1,183 @@
+// Package oidctest runs an in-process OpenID Connect identity provider for tests. It serves discovery, the JWKS and
+// the token endpoint, ID tokens are issued for codes registered with Code.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Key is an RSA signing key of the provider.
+type Key struct {
+	Id      string
+	Private *rsa.PrivateKey
+}
+
+func NewKey(id string) (*Key, error) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if nil != err {
+		return nil, err
+	}
+
+	return &Key{Id: id, Private: private}, nil
+}
+
+type Server struct {
+	*httptest.Server
+	ClientId string
+
+	mu       sync.Mutex
+	issuer   string
+	key      *Key
+	rotation int
+	codes    map[string]string
+	requests []url.Values
+}
+
+// NewServer starts a provider for the client, Close stops it.
+func NewServer(clientId string) (*Server, error) {
+	key, err := NewKey("key-0")
+	if nil != err {
+		return nil, err
+	}
+
+	s := &Server{ClientId: clientId, key: key, codes: make(map[string]string)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", s.discovery)
+	mux.HandleFunc("/jwks", s.jwks)
+	mux.HandleFunc("/token", s.token)
+	s.Server = httptest.NewServer(mux)
+	s.issuer = s.URL
+
+	return s, nil
+}
+
+// SetDiscoveryIssuer makes discovery announce another issuer than the URL of the server.
+func (s *Server) SetDiscoveryIssuer(issuer string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.issuer = issuer
+}
+
+// Rotate replaces the signing key, the JWKS only serves the new key afterwards.
+func (s *Server) Rotate() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rotation++
+	key, err := NewKey(fmt.Sprintf("key-%d", s.rotation))
+	if nil != err {
+		return err
+	}
+	s.key = key
+
+	return nil
+}
+
+// Claims returns valid ID token claims of the subject for the nonce.
+func (s *Server) Claims(subject string, nonce string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":   s.URL,
+		"aud":   s.ClientId,
+		"sub":   subject,
+		"nonce": nonce,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Minute * 5).Unix(),
+	}
+}
+
+// Sign signs the claims with the current key.
+func (s *Server) Sign(claims jwt.MapClaims) (string, error) {
+	s.mu.Lock()
+	key := s.key
+	s.mu.Unlock()
+
+	return SignWith(key, claims)
+}
+
+func SignWith(key *Key, claims jwt.MapClaims) (string, error) {
+	t := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	t.Header["kid"] = key.Id
+	return t.SignedString(key.Private)
+}
+
+// Code registers a single use authorization code the token endpoint redeems for the ID token.
+func (s *Server) Code(idToken string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	code := fmt.Sprintf("code-%d", len(s.codes)+1)
+	s.codes[code] = idToken
+	return code
+}
+
+// TokenRequests returns the forms posted to the token endpoint.
+func (s *Server) TokenRequests() []url.Values {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]url.Values(nil), s.requests...)
+}
+
+func (s *Server) discovery(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	issuer := s.issuer
+	s.mu.Unlock()
+
+	writeJSON(w, map[string]string{
+		"issuer":                 issuer,
+		"authorization_endpoint": s.URL + "/authorize",
+		"token_endpoint":         s.URL + "/token",
+		"jwks_uri":               s.URL + "/jwks",
+	})
+}
+
+func (s *Server) jwks(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	key := s.key
+	s.mu.Unlock()
+
+	public := key.Private.PublicKey
+	writeJSON(w, map[string]interface{}{"keys": []map[string]string{{
+		"kid": key.Id,
+		"kty": "RSA",
+		"alg": "RS256",
+		"use": "sig",
+		"n":   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+	}}})
+}
+
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); nil != err || r.Method != http.MethodPost {
+		http.Error(w, "invalid_request", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, r.PostForm)
+	idToken, ok := s.codes[r.PostForm.Get("code")]
+	delete(s.codes, r.PostForm.Get("code"))
+	s.mu.Unlock()
+
+	if !ok || r.PostForm.Get("code_verifier") == "" || r.PostForm.Get("client_id") != s.ClientId {
+		http.Error(w, "invalid_grant", http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, map[string]string{"access_token": "access", "token_type": "Bearer", "id_token": idToken})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
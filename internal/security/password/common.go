@@ -0,0 +1,63 @@
+package password
+
+import "strings"
+
+// commonPasswords is a bundled offline list of the most used passwords taken from public breach corpora,
+// entries are lowercase since isCommon compares case insensitive.
+var commonPasswords = func() map[string]struct{} {
+	words := strings.Fields(commonList)
+	m := make(map[string]struct{}, len(words))
+	for _, w := range words {
+		m[w] = struct{}{}
+	}
+	return m
+}()
+
+const commonList = `
+123456 password 12345678 qwerty 123456789 12345 1234 111111 1234567 dragon 123123 baseball abc123 football
+monkey letmein 696969 shadow master 666666 qwertyuiop 123321 mustang 1234567890 michael 654321 superman
+1qaz2wsx 7777777 121212 000000 qazwsx 123qwe killer trustno1 jordan jennifer zxcvbnm asdfgh hunter buster
+soccer harley batman andrew tigger sunshine iloveyou 2000 charlie robert thomas hockey ranger daniel starwars
+klaster 112233 george computer michelle jessica pepper 1111 zxcvbn 555555 11111111 131313 freedom 777777
+pass maggie 159753 aaaaaa ginger princess joshua cheese amanda summer love ashley nicole chelsea biteme
+matthew access yankees 987654321 dallas austin thunder taylor matrix william corvette hello martin heather
+secret merlin diamond 1234qwer gfhjkm hammer silver 222222 88888888 anthony justin test bailey q1w2e3r4t5
+patrick internet scooter orange 11111 golfer cookie richard samantha bigdog guitar jackson whatever mickey
+chicken sparky snoopy maverick phoenix camaro peanut morgan welcome falcon cowboy ferrari samsung andrea
+smokey steelers joseph mercedes dakota arsenal eagles melissa boomer booboo spider nascar monster tigers
+yellow xxxxxx 123123123 gateway marina diablo bulldog qwer1234 compaq purple hardcore banana junior hannah
+123654 porsche lakers iceman money cowboys 987654 london tennis 999999 ncc1701 coffee scooby 0000 miller
+boston q1w2e3r4 brandon yamaha chester mother forever johnny edward 333333 oliver redsox player nikita
+knight fender barney midnight please brandy chicago badboy slayer rangers charles angel flower bigdaddy
+rabbit wizard jasper enter rachel chris steven winner adidas victoria natasha 1q2w3e4r jasmine winter
+prince panties marine ghbdtn fishing cocacola casper james 232323 raiders 888888 marlboro gandalf asdfasdf
+crystal 87654321 12344321 golden 8675309 disney ginger1 maxwell batman1 starwars1 password1 password12
+password123 passw0rd p@ssw0rd p@ssword pa55word pa$$word qwerty123 qwerty1 qwertyui 1q2w3e4r5t 1q2w3e
+1qazxsw2 zaq12wsx zaq1zaq1 zaq1xsw2 abcd1234 abcdef abcdefg abcdefgh abc12345 a1b2c3 a1b2c3d4 aa123456
+asdf1234 asdfghjk asdfghjkl qweasd qweasdzxc qazwsxedc 1qaz2wsx3edc iloveyou1 iloveyou2 ilovegod loveme
+lovely loveyou trustme admin admin123 administrator root toor changeme default guest login user1234 welcome1
+welcome123 letmein1 secret123 master123 monkey123 dragon123 football1 baseball1 shadow1 sunshine1 princess1
+superman1 michael1 jordan23 liverpool chelsea1 arsenal1 manchester barcelona realmadrid juventus pokemon
+minecraft fortnite roblox naruto batman123 spiderman ironman starwars123 blink182 metallica nirvana eminem
+beatles 123abc 1234abcd 0987654321 147258369 741852963 963852741 147258 159357 258456 135790 123098 102030
+101010 121314 112211 212121 252525 123321123 1122334455 11223344 12341234 123451234 666999 6969 69696969
+00000000 99999999 55555555 44444444 33333333 22222222 77777777 12121212 13131313 1111111111 0000000000
+qwertyuiop1 asdfghjkl1 zxcvbnm1 zxcvbnm123 mnbvcxz poiuytrewq lkjhgfdsa 1qw23er4 q1w2e3 qwe123 qwe12345
+qwerty12345 qwerty1234 azerty azertyuiop 123azerty 1234azerty soleil doudou chouchou loulou marseille
+nicolas jordan1 alexander alexandra benjamin jonathan christopher elizabeth stephanie victoria1 princesa
+bonita tequiero teamo cariño mariposa estrella hallo passwort schatz fussball killer1 hunter2 hunter1
+shadow12 sunflower butterfly rainbow blessed blessing jesus jesus1 jesuschrist christ heaven angel1 angels
+blue123 red123 green purple1 orange1 yellow1 black white silver1 golden1 computer1 internet1 samsung1
+iphone apple apple123 google facebook twitter instagram linkedin youtube microsoft windows windows7 linux
+ubuntu oracle mysql postgres database server network security secure private letmein123 opensesame superstar
+rockstar superuser success money123 cash dollar million lucky lucky7 lucky13 golf tiger tiger1 lion eagle
+dolphin dolphins panther panthers wolf wolves bear bears hawk falcons ravens bengals packers broncos giants
+jets patriots vikings saints texans chargers colts titans bills browns redskins lakers1 celtics bulls
+knicks spurs heat yankees1 mets cubs dodgers astros braves phillies pirates angels1 athletics mariners
+orioles royals twins tigers1 indians summer1 summer2020 summer2021 winter1 spring autumn monday friday
+sunday january february march april june july august september october november december birthday happy
+happy1 smile freedom1 liberty america usa123 canada australia england france germany italy spain mexico
+brazil india china japan russia qwerty7 qwerty8 secret1 test123 test1234 testing demo sample example temp
+temp123 pass123 pass1234 mypass mypassword yourpassword nopassword letmein12 iloveu iloveu2 babygirl baby123
+sweety sweetheart honey cutie pretty beautiful sexy hottie lover lovers
+`
@@ -0,0 +1,167 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+)
+
+// ErrUnknownHash is returned for hashes no registered hasher identifies, such as the empty password of provisioned users.
+var ErrUnknownHash = errors.New("unknown password hash")
+
+// Hasher turns passwords into self describing hashes, the encoding carries the algorithm and its parameters
+// so hashes made with older settings can still be verified and upgraded.
+type Hasher interface {
+	Hash(password string) (string, error)
+	// Verify reports whether the password matches the encoded hash, it is only called with hashes the hasher identifies.
+	Verify(password string, encoded string) (bool, error)
+	// Identify reports whether the encoded hash was made by this algorithm.
+	Identify(encoded string) bool
+	// Outdated reports whether the encoded hash uses weaker parameters than the hasher is configured with.
+	Outdated(encoded string) bool
+}
+
+// Manager hashes new passwords with the preferred hasher and verifies the hashes of every registered hasher.
+type Manager struct {
+	preferred Hasher
+	hashers   []Hasher
+}
+
+func NewManager(preferred Hasher, others ...Hasher) *Manager {
+	return &Manager{preferred: preferred, hashers: append([]Hasher{preferred}, others...)}
+}
+
+func (m *Manager) Hash(password string) (string, error) {
+	return m.preferred.Hash(password)
+}
+
+// Verify checks the password against the encoded hash, rehash is set when the password matches a hash made by
+// another algorithm or with weaker parameters than the preferred hasher, callers then store a new hash.
+func (m *Manager) Verify(password string, encoded string) (ok bool, rehash bool, err error) {
+	for _, hasher := range m.hashers {
+		if !hasher.Identify(encoded) {
+			continue
+		}
+		if ok, err = hasher.Verify(password, encoded); nil != err || !ok {
+			return false, false, err
+		}
+		return true, hasher != m.preferred || hasher.Outdated(encoded), nil
+	}
+
+	return false, false, ErrUnknownHash
+}
+
+// Argon2id hashes with the parameters recommended by RFC 9106, memory is in KiB.
+// Hashes are encoded in the PHC string format: $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>.
+type Argon2id struct {
+	Time       uint32
+	Memory     uint32
+	Threads    uint8
+	SaltLength uint32
+	KeyLength  uint32
+}
+
+const argon2idPrefix = "$argon2id$"
+
+func (a Argon2id) Hash(password string) (string, error) {
+	salt := make([]byte, a.SaltLength)
+	if _, err := rand.Read(salt); nil != err {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, a.Time, a.Memory, a.Threads, a.KeyLength)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version, a.Memory, a.Time, a.Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (a Argon2id) Verify(password string, encoded string) (bool, error) {
+	params, salt, key, err := decodeArgon2id(encoded)
+	if nil != err {
+		return false, err
+	}
+
+	other := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, other) == 1, nil
+}
+
+func (a Argon2id) Identify(encoded string) bool {
+	return strings.HasPrefix(encoded, argon2idPrefix)
+}
+
+func (a Argon2id) Outdated(encoded string) bool {
+	params, salt, key, err := decodeArgon2id(encoded)
+	if nil != err {
+		return true
+	}
+
+	return params.Time < a.Time || params.Memory < a.Memory || params.Threads < a.Threads ||
+		uint32(len(salt)) < a.SaltLength || uint32(len(key)) < a.KeyLength
+}
+
+func decodeArgon2id(encoded string) (Argon2id, []byte, []byte, error) {
+	var params Argon2id
+
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return params, nil, nil, errors.New("invalid argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); nil != err {
+		return params, nil, nil, errors.Wrap(err, "invalid argon2id version")
+	}
+	if version != argon2.Version {
+		return params, nil, nil, errors.Errorf("unsupported argon2id version %d", version)
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads); nil != err {
+		return params, nil, nil, errors.Wrap(err, "invalid argon2id parameters")
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if nil != err {
+		return params, nil, nil, errors.Wrap(err, "invalid argon2id salt")
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if nil != err {
+		return params, nil, nil, errors.Wrap(err, "invalid argon2id key")
+	}
+
+	return params, salt, key, nil
+}
+
+// Bcrypt verifies the hashes made before Argon2id was introduced, it can still be preferred where Argon2id is not wanted.
+type Bcrypt struct {
+	Cost int
+}
+
+func (b Bcrypt) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), b.Cost)
+	if nil != err {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+func (b Bcrypt) Verify(password string, encoded string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if bcrypt.ErrMismatchedHashAndPassword == err {
+		return false, nil
+	}
+
+	return nil == err, err
+}
+
+func (b Bcrypt) Identify(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+func (b Bcrypt) Outdated(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return nil != err || cost < b.Cost
+}
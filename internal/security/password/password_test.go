@@ -0,0 +1,97 @@
+package password
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"testing"
+)
+
+// testArgon2id keeps the memory small so the tests stay fast.
+var testArgon2id = Argon2id{Time: 2, Memory: 8 * 1024, Threads: 1, SaltLength: 16, KeyLength: 32}
+
+func mustHash(t *testing.T, h Hasher, password string) string {
+	t.Helper()
+	encoded, err := h.Hash(password)
+	require.NoError(t, err)
+	return encoded
+}
+
+func TestManagerVerify(t *testing.T) {
+	const pass = "correct horse battery"
+
+	weaker := testArgon2id
+	weaker.Time = 1
+	shortSalt := testArgon2id
+	shortSalt.SaltLength = 8
+
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte(pass), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	manager := NewManager(testArgon2id, Bcrypt{Cost: bcrypt.MinCost})
+
+	tests := []struct {
+		name     string
+		password string
+		encoded  string
+		ok       bool
+		rehash   bool
+		err      error
+		// malformed hashes fail with a parse error rather than ErrUnknownHash
+		malformed bool
+	}{
+		{name: "current argon2id", password: pass, encoded: mustHash(t, testArgon2id, pass), ok: true},
+		{name: "wrong password", password: "wrong", encoded: mustHash(t, testArgon2id, pass)},
+		{name: "weaker time", password: pass, encoded: mustHash(t, weaker, pass), ok: true, rehash: true},
+		{name: "shorter salt", password: pass, encoded: mustHash(t, shortSalt, pass), ok: true, rehash: true},
+		{name: "bcrypt upgraded to argon2id", password: pass, encoded: string(bcryptHash), ok: true, rehash: true},
+		{name: "bcrypt wrong password", password: "wrong", encoded: string(bcryptHash)},
+		{name: "empty hash", password: pass, encoded: "", err: ErrUnknownHash},
+		{name: "unknown hash", password: pass, encoded: "$md5$abc", err: ErrUnknownHash},
+		{name: "malformed argon2id", password: pass, encoded: "$argon2id$v=19$m=8192", malformed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, rehash, err := manager.Verify(tt.password, tt.encoded)
+			if tt.malformed {
+				assert.Error(t, err)
+			} else {
+				assert.Equal(t, tt.err, err)
+			}
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.rehash, rehash)
+		})
+	}
+}
+
+func TestManagerVerifyPreferredBcrypt(t *testing.T) {
+	const pass = "correct horse battery"
+
+	manager := NewManager(Bcrypt{Cost: bcrypt.MinCost + 1}, testArgon2id)
+
+	tests := []struct {
+		name    string
+		encoded string
+		rehash  bool
+	}{
+		{name: "argon2id downgraded to preferred bcrypt", encoded: mustHash(t, testArgon2id, pass), rehash: true},
+		{name: "lower bcrypt cost", encoded: mustHash(t, Bcrypt{Cost: bcrypt.MinCost}, pass), rehash: true},
+		{name: "current bcrypt cost", encoded: mustHash(t, Bcrypt{Cost: bcrypt.MinCost + 1}, pass)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, rehash, err := manager.Verify(pass, tt.encoded)
+			require.NoError(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, tt.rehash, rehash)
+		})
+	}
+}
+
+func TestArgon2idEncoding(t *testing.T) {
+	encoded := mustHash(t, testArgon2id, "secret")
+	assert.Regexp(t, `^\$argon2id\$v=19\$m=8192,t=2,p=1\$[A-Za-z0-9+/]{22}\$[A-Za-z0-9+/]{43}$`, encoded)
+	assert.NotEqual(t, encoded, mustHash(t, testArgon2id, "secret"), "every hash gets a fresh salt")
+}
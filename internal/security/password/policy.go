@@ -0,0 +1,118 @@
+package password
+
+import (
+	"github.com/pkg/errors"
+	"math"
+	"strings"
+	"unicode"
+)
+
+var (
+	ErrTooShort = errors.New("password is too short")
+	ErrTooWeak  = errors.New("password is too weak, use a longer password with mixed characters")
+	ErrCommon   = errors.New("password is too common or appeared in a data breach")
+	ErrPersonal = errors.New("password must not contain the username or email")
+)
+
+// Policy rejects passwords that are short, guessable or found in the bundled list of breached and common passwords.
+type Policy struct {
+	MinLength int
+	// MinEntropy is the estimated strength in bits, repeated and sequential characters do not add to it.
+	MinEntropy float64
+}
+
+// Check validates the password, personal holds values such as the username and email the password must not contain.
+func (p Policy) Check(password string, personal ...string) error {
+	runes := []rune(password)
+	if len(runes) < p.MinLength {
+		return ErrTooShort
+	}
+
+	lower := strings.ToLower(password)
+	if isCommon(lower) {
+		return ErrCommon
+	}
+
+	for _, value := range personal {
+		value = strings.ToLower(value)
+		if i := strings.Index(value, "@"); i >= 0 {
+			value = value[:i]
+		}
+		if len(value) >= 3 && strings.Contains(lower, value) {
+			return ErrPersonal
+		}
+	}
+
+	if Entropy(password) < p.MinEntropy {
+		return ErrTooWeak
+	}
+
+	return nil
+}
+
+// Entropy estimates the strength of the password in bits from the character classes used, characters that repeat
+// or continue a sequence of the previous one are not counted so "aaaaaaaa" and "12345678" score as a single character.
+func Entropy(password string) float64 {
+	var lower, upper, digit, symbol, other bool
+	effective := 0
+	var prev rune
+	for i, r := range password {
+		switch {
+		case unicode.IsLower(r) && r < unicode.MaxASCII:
+			lower = true
+		case unicode.IsUpper(r) && r < unicode.MaxASCII:
+			upper = true
+		case unicode.IsDigit(r) && r < unicode.MaxASCII:
+			digit = true
+		case r < unicode.MaxASCII:
+			symbol = true
+		default:
+			other = true
+		}
+
+		if i == 0 || r-prev > 1 || prev-r > 1 {
+			effective++
+		}
+		prev = r
+	}
+
+	pool := 0
+	if lower {
+		pool += 26
+	}
+	if upper {
+		pool += 26
+	}
+	if digit {
+		pool += 10
+	}
+	if symbol {
+		pool += 33
+	}
+	if other {
+		pool += 100
+	}
+	if pool == 0 {
+		return 0
+	}
+
+	return float64(effective) * math.Log2(float64(pool))
+}
+
+// isCommon matches the lowercase password and its base without trailing digits and symbols, "Password123!" is as
+// guessable as "password".
+func isCommon(lower string) bool {
+	if _, ok := commonPasswords[lower]; ok {
+		return true
+	}
+
+	base := strings.TrimRightFunc(lower, func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	if len(base) < 4 || base == lower {
+		return false
+	}
+
+	_, ok := commonPasswords[base]
+	return ok
+}
@@ -0,0 +1,45 @@
+package password
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPolicyCheck(t *testing.T) {
+	policy := Policy{MinLength: 8, MinEntropy: 40}
+
+	tests := []struct {
+		name     string
+		password string
+		personal []string
+		err      error
+	}{
+		{name: "too short", password: "Xk9!", err: ErrTooShort},
+		{name: "common", password: "password", err: ErrCommon},
+		{name: "common any case", password: "PassWord", err: ErrCommon},
+		{name: "common base with digits", password: "password123", err: ErrCommon},
+		{name: "common base with symbols", password: "Sunshine2024!", err: ErrCommon},
+		{name: "short base is not matched", password: "Love9876!xQ", err: nil},
+		{name: "username", password: "xjohndoe#2024", personal: []string{"johndoe", "jd@example.com"}, err: ErrPersonal},
+		{name: "email local part", password: "Zz-jd.smith-91", personal: []string{"js", "JD.Smith@example.com"}, err: ErrPersonal},
+		{name: "short personal values are ignored", password: "Tr0ub4dor&3", personal: []string{"tr"}, err: nil},
+		{name: "repeated characters", password: "zzzzzzzzzzzz", err: ErrTooWeak},
+		{name: "sequence", password: "abcdefghijkl", err: ErrTooWeak},
+		{name: "alternating sequence", password: "ghghghghghgh", err: ErrTooWeak},
+		{name: "digits only", password: "80417263", err: ErrTooWeak},
+		{name: "passphrase", password: "correct horse battery", err: nil},
+		{name: "mixed classes", password: "Tr0ub4dor&3", err: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.err, policy.Check(tt.password, tt.personal...))
+		})
+	}
+}
+
+func TestEntropy(t *testing.T) {
+	assert.Equal(t, float64(0), Entropy(""))
+	assert.Less(t, Entropy("aaaaaaaa"), Entropy("aqzmxkwp"))
+	assert.Less(t, Entropy("aqzmxkwp"), Entropy("aQzM1k#p"))
+}
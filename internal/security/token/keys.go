@@ -0,0 +1,280 @@
+package token
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/log"
+	"io/ioutil"
+	"math/big"
+	"refactory/notes/internal/config"
+	"strings"
+)
+
+// SigningMethodEdDSA signs tokens with Ed25519, jwt-go only ships the RSA, ECDSA and HMAC methods.
+var SigningMethodEdDSA = &signingMethodEdDSA{}
+
+type signingMethodEdDSA struct{}
+
+func init() {
+	jwt.RegisterSigningMethod(SigningMethodEdDSA.Alg(), func() jwt.SigningMethod { return SigningMethodEdDSA })
+}
+
+func (m *signingMethodEdDSA) Alg() string {
+	return "EdDSA"
+}
+
+func (m *signingMethodEdDSA) Sign(signingString string, key interface{}) (string, error) {
+	private, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+
+	return jwt.EncodeSegment(ed25519.Sign(private, []byte(signingString))), nil
+}
+
+func (m *signingMethodEdDSA) Verify(signingString, signature string, key interface{}) error {
+	public, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return jwt.ErrInvalidKeyType
+	}
+
+	sig, err := jwt.DecodeSegment(signature)
+	if nil != err {
+		return err
+	}
+	if !ed25519.Verify(public, []byte(signingString), sig) {
+		return jwt.ErrSignatureInvalid
+	}
+
+	return nil
+}
+
+type key struct {
+	kid     string
+	method  jwt.SigningMethod
+	private crypto.Signer
+	public  crypto.PublicKey
+}
+
+// keyring holds the key new tokens are signed with and every key tokens are still accepted from during a rotation.
+type keyring struct {
+	signing *key
+	verify  map[string]*key
+	order   []string
+}
+
+var ring *keyring
+
+// LoadKeys reads the signing key from jwt_private_key and the retired public keys from jwt_public_keys, a comma separated
+// list of kid=path pairs. Keys are PEM encoded RSA or Ed25519 keys. Without a signing key an ephemeral Ed25519 key is
+// generated in development, tokens then do not survive a restart and are not shared between instances.
+func LoadKeys() error {
+	r := &keyring{verify: make(map[string]*key)}
+
+	var signer crypto.Signer
+	if config.Cfg().JwtPrivateKey == "" {
+		if !config.Cfg().IsDev {
+			return errors.New("jwt_private_key is required")
+		}
+		log.Warn("jwt_private_key is not set, signing tokens with an ephemeral key")
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		if nil != err {
+			return err
+		}
+		signer = private
+	} else {
+		var err error
+		if signer, err = readPrivateKey(config.Cfg().JwtPrivateKey); nil != err {
+			return errors.Wrap(err, "reading jwt_private_key")
+		}
+	}
+
+	signing, err := newKey(config.Cfg().JwtKeyId, signer.Public())
+	if nil != err {
+		return err
+	}
+	signing.private = signer
+	r.signing = signing
+	r.add(signing)
+
+	for _, pair := range strings.Split(config.Cfg().JwtPublicKeys, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		kidPath := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(kidPath) != 2 {
+			return errors.Errorf("jwt_public_keys entry %q is not kid=path", pair)
+		}
+		public, err := readPublicKey(kidPath[1])
+		if nil != err {
+			return errors.Wrapf(err, "reading public key %s", kidPath[0])
+		}
+		k, err := newKey(kidPath[0], public)
+		if nil != err {
+			return err
+		}
+		r.add(k)
+	}
+
+	ring = r
+	return nil
+}
+
+func (r *keyring) add(k *key) {
+	if _, ok := r.verify[k.kid]; !ok {
+		r.order = append(r.order, k.kid)
+	}
+	r.verify[k.kid] = k
+}
+
+func newKey(kid string, public crypto.PublicKey) (*key, error) {
+	k := &key{kid: kid, public: public}
+	switch public.(type) {
+	case *rsa.PublicKey:
+		k.method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		k.method = SigningMethodEdDSA
+	default:
+		return nil, errors.Errorf("unsupported key type %T", public)
+	}
+
+	if k.kid == "" {
+		der, err := x509.MarshalPKIXPublicKey(public)
+		if nil != err {
+			return nil, err
+		}
+		sum := sha256.Sum256(der)
+		k.kid = hex.EncodeToString(sum[:8])
+	}
+
+	return k, nil
+}
+
+func readPrivateKey(path string) (crypto.Signer, error) {
+	block, err := readPem(path)
+	if nil != err {
+		return nil, err
+	}
+
+	if private, err := x509.ParsePKCS8PrivateKey(block.Bytes); nil == err {
+		signer, ok := private.(crypto.Signer)
+		if !ok {
+			return nil, errors.Errorf("unsupported key type %T", private)
+		}
+		return signer, nil
+	}
+
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
+}
+
+func readPublicKey(path string) (crypto.PublicKey, error) {
+	block, err := readPem(path)
+	if nil != err {
+		return nil, err
+	}
+
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+func readPem(path string) (*pem.Block, error) {
+	raw, err := ioutil.ReadFile(path)
+	if nil != err {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(raw)
+	if nil == block {
+		return nil, errors.Errorf("%s is not PEM encoded", path)
+	}
+
+	return block, nil
+}
+
+// Keyfunc picks the verification key by the kid header and checks the issuer and the audience of the token.
+func Keyfunc(t *jwt.Token) (interface{}, error) {
+	if nil == ring {
+		return nil, errors.New("jwt keys are not loaded")
+	}
+
+	kid, _ := t.Header["kid"].(string)
+	k, ok := ring.verify[kid]
+	if !ok {
+		return nil, errors.Errorf("unknown kid %q", kid)
+	}
+	if t.Method.Alg() != k.method.Alg() {
+		return nil, errors.Errorf("unexpected signing method %s", t.Method.Alg())
+	}
+
+	claims, ok := t.Claims.(*Token)
+	if !ok {
+		return nil, errors.New("unexpected claims")
+	}
+	if !claims.VerifyIssuer(config.Cfg().JwtIssuer, true) || !claims.VerifyAudience(config.Cfg().JwtAudience, true) {
+		return nil, errors.New("issuer or audience mismatch")
+	}
+
+	return k.public, nil
+}
+
+func sign(claims Token) (string, error) {
+	if nil == ring {
+		return "", errors.New("jwt keys are not loaded")
+	}
+
+	t := jwt.NewWithClaims(ring.signing.method, claims)
+	t.Header["kid"] = ring.signing.kid
+	return t.SignedString(ring.signing.private)
+}
+
+// JWK is a public key in the JSON Web Key format.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicKeys returns every key tokens are accepted from, so that other services can verify our tokens.
+func PublicKeys() JWKS {
+	result := JWKS{Keys: []JWK{}}
+	if nil == ring {
+		return result
+	}
+
+	for _, kid := range ring.order {
+		k := ring.verify[kid]
+		jwk := JWK{Kid: k.kid, Use: "sig", Alg: k.method.Alg()}
+		switch public := k.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+		result.Keys = append(result.Keys, jwk)
+	}
+
+	return result
+}
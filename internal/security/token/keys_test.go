@@ -0,0 +1,275 @@
+package token
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"refactory/notes/internal/app/model"
+	"refactory/notes/internal/config"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testKeys are generated once, RSA key generation is slow.
+var testKeys struct {
+	rsa     *rsa.PrivateKey
+	ed25519 ed25519.PrivateKey
+}
+
+func init() {
+	var err error
+	if testKeys.rsa, err = rsa.GenerateKey(rand.Reader, 2048); nil != err {
+		panic(err)
+	}
+	if _, testKeys.ed25519, err = ed25519.GenerateKey(rand.Reader); nil != err {
+		panic(err)
+	}
+}
+
+// setKeys points the key config at PEM files of the signing key and the retired public keys, and loads them.
+func setKeys(t *testing.T, kid string, signer crypto.Signer, retired map[string]crypto.PublicKey) {
+	t.Helper()
+
+	cfg := *config.Cfg()
+	t.Cleanup(func() {
+		*config.Cfg() = cfg
+		ring = nil
+	})
+
+	dir := t.TempDir()
+	der, err := x509.MarshalPKCS8PrivateKey(signer)
+	require.NoError(t, err)
+	config.Cfg().JwtPrivateKey = writePem(t, dir, "private.pem", "PRIVATE KEY", der)
+	config.Cfg().JwtKeyId = kid
+	config.Cfg().JwtPublicKeys = ""
+	for retiredKid, public := range retired {
+		der, err := x509.MarshalPKIXPublicKey(public)
+		require.NoError(t, err)
+		path := writePem(t, dir, retiredKid+".pem", "PUBLIC KEY", der)
+		config.Cfg().JwtPublicKeys = fmt.Sprintf("%s,%s=%s", config.Cfg().JwtPublicKeys, retiredKid, path)
+	}
+	config.Cfg().JwtIssuer = "https://notes.example.com"
+	config.Cfg().JwtAudience = "rsp-notes"
+	config.Cfg().AccessTokenTTL = time.Minute
+
+	require.NoError(t, LoadKeys())
+}
+
+func writePem(t *testing.T, dir string, name string, kind string, der []byte) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der}), 0600))
+	return path
+}
+
+func parse(raw string) (*Token, error) {
+	claims := &Token{}
+	_, err := jwt.ParseWithClaims(raw, claims, Keyfunc)
+	return claims, err
+}
+
+func TestSignRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		signer crypto.Signer
+		alg    string
+	}{
+		{name: "RS256", signer: testKeys.rsa, alg: "RS256"},
+		{name: "EdDSA", signer: testKeys.ed25519, alg: "EdDSA"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setKeys(t, "key-1", tt.signer, nil)
+
+			raw, err := GenerateToken(model.Session{UserId: 7, Username: "alice", RoleId: model.RoleUserId, SessionId: "device-1"})
+			require.NoError(t, err)
+
+			parsed, _, err := new(jwt.Parser).ParseUnverified(raw, &Token{})
+			require.NoError(t, err)
+			assert.Equal(t, tt.alg, parsed.Header["alg"])
+			assert.Equal(t, "key-1", parsed.Header["kid"])
+
+			claims, err := parse(raw)
+			require.NoError(t, err)
+			assert.Equal(t, 7, claims.UserId)
+			assert.Equal(t, "alice", claims.Username)
+			assert.Equal(t, "device-1", claims.Sid)
+			assert.Equal(t, "https://notes.example.com", claims.Issuer)
+			assert.Equal(t, "rsp-notes", claims.Audience)
+		})
+	}
+}
+
+func TestSignRsaPkcs1(t *testing.T) {
+	setKeys(t, "key-1", testKeys.ed25519, nil)
+	config.Cfg().JwtPrivateKey = writePem(t, t.TempDir(), "private.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(testKeys.rsa))
+	require.NoError(t, LoadKeys())
+
+	raw, err := GenerateToken(model.Session{UserId: 7, Username: "alice"})
+	require.NoError(t, err)
+	_, err = parse(raw)
+	assert.NoError(t, err)
+}
+
+func TestKeyfuncRejects(t *testing.T) {
+	setKeys(t, "key-1", testKeys.ed25519, map[string]crypto.PublicKey{"key-0": testKeys.rsa.Public()})
+
+	valid := newClaims(model.Session{UserId: 7, Username: "alice"}, "jti", time.Now().Add(time.Minute))
+
+	tests := []struct {
+		name   string
+		method jwt.SigningMethod
+		key    interface{}
+		kid    interface{}
+		claims func(c *Token)
+		err    string
+	}{
+		{name: "unknown kid", method: SigningMethodEdDSA, key: testKeys.ed25519, kid: "key-2", err: "unknown kid"},
+		{name: "missing kid", method: SigningMethodEdDSA, key: testKeys.ed25519, kid: nil, err: "unknown kid"},
+		{name: "hmac with the kid of an EdDSA key", method: jwt.SigningMethodHS256, key: []byte("secret"), kid: "key-1",
+			err: "unexpected signing method"},
+		{name: "EdDSA with the kid of an RSA key", method: SigningMethodEdDSA, key: testKeys.ed25519, kid: "key-0",
+			err: "unexpected signing method"},
+		{name: "wrong issuer", method: SigningMethodEdDSA, key: testKeys.ed25519, kid: "key-1",
+			claims: func(c *Token) { c.Issuer = "https://evil.example.com" }, err: "issuer or audience mismatch"},
+		{name: "missing issuer", method: SigningMethodEdDSA, key: testKeys.ed25519, kid: "key-1",
+			claims: func(c *Token) { c.Issuer = "" }, err: "issuer or audience mismatch"},
+		{name: "wrong audience", method: SigningMethodEdDSA, key: testKeys.ed25519, kid: "key-1",
+			claims: func(c *Token) { c.Audience = "other-service" }, err: "issuer or audience mismatch"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := valid
+			if nil != tt.claims {
+				tt.claims(&claims)
+			}
+			token := jwt.NewWithClaims(tt.method, claims)
+			if nil != tt.kid {
+				token.Header["kid"] = tt.kid
+			}
+			raw, err := token.SignedString(tt.key)
+			require.NoError(t, err)
+
+			_, err = parse(raw)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
+
+func TestEdDSARejectsTamperedSignature(t *testing.T) {
+	setKeys(t, "key-1", testKeys.ed25519, nil)
+
+	raw, err := GenerateToken(model.Session{UserId: 7, Username: "alice"})
+	require.NoError(t, err)
+
+	_, other, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	forged := jwt.NewWithClaims(SigningMethodEdDSA, newClaims(model.Session{UserId: 1, Username: "admin"}, "jti", time.Now().Add(time.Minute)))
+	forged.Header["kid"] = "key-1"
+	forgedRaw, err := forged.SignedString(other)
+	require.NoError(t, err)
+
+	_, err = parse(forgedRaw)
+	assert.Error(t, err)
+
+	// the payload of a valid token swapped in under its signature
+	parts := strings.Split(raw, ".")
+	forgedParts := strings.Split(forgedRaw, ".")
+	_, err = parse(parts[0] + "." + forgedParts[1] + "." + parts[2])
+	assert.Error(t, err)
+}
+
+func TestRotatedKeysStillVerify(t *testing.T) {
+	setKeys(t, "key-1", testKeys.rsa, nil)
+	raw, err := GenerateToken(model.Session{UserId: 7, Username: "alice"})
+	require.NoError(t, err)
+
+	// the RSA key is retired and published as public key only, new tokens are signed with the Ed25519 key
+	setKeys(t, "key-2", testKeys.ed25519, map[string]crypto.PublicKey{"key-1": testKeys.rsa.Public()})
+	_, err = parse(raw)
+	assert.NoError(t, err)
+
+	fresh, err := GenerateToken(model.Session{UserId: 7, Username: "alice"})
+	require.NoError(t, err)
+	parsed, _, err := new(jwt.Parser).ParseUnverified(fresh, &Token{})
+	require.NoError(t, err)
+	assert.Equal(t, "key-2", parsed.Header["kid"])
+
+	kids := []string{}
+	for _, jwk := range PublicKeys().Keys {
+		kids = append(kids, jwk.Kid)
+	}
+	assert.Equal(t, []string{"key-2", "key-1"}, kids)
+}
+
+func TestPublicKeysVerifyTokens(t *testing.T) {
+	tests := []struct {
+		name   string
+		signer crypto.Signer
+	}{
+		{name: "RS256", signer: testKeys.rsa},
+		{name: "EdDSA", signer: testKeys.ed25519},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setKeys(t, "", tt.signer, nil)
+
+			raw, err := GenerateToken(model.Session{UserId: 7, Username: "alice"})
+			require.NoError(t, err)
+
+			jwks := PublicKeys()
+			require.Len(t, jwks.Keys, 1)
+			jwk := jwks.Keys[0]
+			assert.NotEmpty(t, jwk.Kid, "a kid is derived from the key when none is configured")
+			assert.Equal(t, "sig", jwk.Use)
+
+			// verify the way another service would, only from the published key
+			_, err = jwt.ParseWithClaims(raw, &Token{}, func(token *jwt.Token) (interface{}, error) {
+				if token.Header["kid"] != jwk.Kid || token.Method.Alg() != jwk.Alg {
+					return nil, fmt.Errorf("no published key for %v %s", token.Header["kid"], token.Method.Alg())
+				}
+				return publicKey(t, jwk), nil
+			})
+			assert.NoError(t, err)
+		})
+	}
+}
+
+// publicKey decodes a JWK the way a relying party would.
+func publicKey(t *testing.T, jwk JWK) interface{} {
+	t.Helper()
+
+	switch jwk.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		require.NoError(t, err)
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		require.NoError(t, err)
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	case "OKP":
+		require.Equal(t, "Ed25519", jwk.Crv)
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		require.NoError(t, err)
+		return ed25519.PublicKey(x)
+	}
+
+	t.Fatalf("unexpected key type %s", jwk.Kty)
+	return nil
+}
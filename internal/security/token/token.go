@@ -1,28 +1,107 @@
 package token
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"github.com/dgrijalva/jwt-go"
 	"refactory/notes/internal/app/model"
+	"refactory/notes/internal/config"
 	"time"
 )
 
+// AccessTokenPrefix tells personal access tokens apart from JWTs in the Authorization header.
+const AccessTokenPrefix = "pat_"
+
 type Token struct {
 	jwt.StandardClaims
-	UserId   int    `json:"user_id"`
-	Username string `json:"username"`
-	RoleId   int    `json:"role_id"`
+	UserId   int      `json:"user_id"`
+	Username string   `json:"username"`
+	RoleId   int      `json:"role_id"`
+	Sid      string   `json:"sid,omitempty"`
+	Org      int      `json:"org,omitempty"`
+	Scopes   []string `json:"scopes,omitempty"`
+	Act      *Actor   `json:"act,omitempty"`
+}
+
+// Actor is the admin acting as the user of an impersonation token, after the act claim of RFC 8693.
+type Actor struct {
+	Sub             string `json:"sub"`
+	UserId          int    `json:"user_id"`
+	ImpersonationId int    `json:"impersonation_id"`
 }
 
 func GenerateToken(session model.Session) (string, error) {
-	claims := Token{
+	jti, err := RandomString(16)
+	if nil != err {
+		return "", err
+	}
+
+	return sign(newClaims(session, jti, time.Now().Add(config.Cfg().AccessTokenTTL)))
+}
+
+// GenerateImpersonation returns a token of the session acting on behalf of the admin, it comes without refresh token.
+func GenerateImpersonation(session model.Session, jti string, actor Actor, expiresAt time.Time) (string, error) {
+	claims := newClaims(session, jti, expiresAt)
+	claims.Act = &actor
+
+	return sign(claims)
+}
+
+func newClaims(session model.Session, jti string, expiresAt time.Time) Token {
+	return Token{
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(time.Minute * 30).Unix(),
+			Id:        jti,
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: expiresAt.Unix(),
+			Issuer:    config.Cfg().JwtIssuer,
+			Audience:  config.Cfg().JwtAudience,
 		},
 		UserId:   session.UserId,
 		Username: session.Username,
 		RoleId:   session.RoleId,
+		Sid:      session.SessionId,
+		Org:      session.OrganizationId,
+	}
+}
+
+// RandomString returns n crypto random bytes encoded as hex.
+func RandomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); nil != err {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// NewAccessToken returns a random personal access token and the hash it is stored under.
+func NewAccessToken() (string, string, error) {
+	raw, err := RandomString(32)
+	if nil != err {
+		return "", "", err
 	}
+	raw = AccessTokenPrefix + raw
+
+	return raw, HashAccessToken(raw), nil
+}
+
+func HashAccessToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// RevokedKey is the cache key holding the unix time before which every token of the user is rejected.
+func RevokedKey(userId int) string {
+	return fmt.Sprintf("revoked:user:%d", userId)
+}
+
+// FamilyRevokedKey is the cache key marking a device session as revoked, together with its refresh and access tokens.
+func FamilyRevokedKey(family string) string {
+	return fmt.Sprintf("refresh:family:%s", family)
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte("secret"))
+// DeniedKey is the cache key marking a single access token as revoked until it expires.
+func DeniedKey(jti string) string {
+	return fmt.Sprintf("revoked:token:%s", jti)
 }
@@ -0,0 +1,121 @@
+package totp
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 seed of RFC 6238 Appendix B, the ASCII string "12345678901234567890", encoded as base32.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestValidateRfcVectors(t *testing.T) {
+	// the 8 digit codes of Appendix B truncated to the 6 digits authenticator apps use
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{unix: 59, code: "287082"},
+		{unix: 1111111109, code: "081804"},
+		{unix: 1111111111, code: "050471"},
+		{unix: 1234567890, code: "005924"},
+		{unix: 2000000000, code: "279037"},
+		{unix: 20000000000, code: "353130"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			step, ok := Validate(rfcSecret, tt.code, time.Unix(tt.unix, 0))
+			assert.True(t, ok)
+			assert.Equal(t, tt.unix/Period, step)
+		})
+	}
+}
+
+func TestValidateSkew(t *testing.T) {
+	key, err := encoding.DecodeString(rfcSecret)
+	require.NoError(t, err)
+	now := time.Unix(1111111111, 0)
+	current := now.Unix() / Period
+
+	tests := []struct {
+		name   string
+		offset int64
+		ok     bool
+	}{
+		{name: "two periods early", offset: -2},
+		{name: "previous period", offset: -1, ok: true},
+		{name: "current period", offset: 0, ok: true},
+		{name: "next period", offset: 1, ok: true},
+		{name: "two periods late", offset: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Validate(rfcSecret, generate(key, current+tt.offset), now)
+			assert.Equal(t, tt.ok, ok)
+			if tt.ok {
+				// the matched step is returned, not the current one, so a replay within the window hits the same step
+				assert.Equal(t, current+tt.offset, step)
+			}
+		})
+	}
+}
+
+func TestValidateRejects(t *testing.T) {
+	now := time.Unix(59, 0)
+
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+	}{
+		{name: "wrong code", secret: rfcSecret, code: "287083"},
+		{name: "short code", secret: rfcSecret, code: "28708"},
+		{name: "eight digit code", secret: rfcSecret, code: "94287082"},
+		{name: "invalid secret", secret: "not base32!", code: "287082"},
+		{name: "empty secret", secret: "", code: "287082"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, ok := Validate(tt.secret, tt.code, now)
+			assert.False(t, ok)
+		})
+	}
+}
+
+func TestValidateNormalizesSecret(t *testing.T) {
+	_, ok := Validate(" gezdgnbvgy3tqojqgezdgnbvgy3tqojq ", "287082", time.Unix(59, 0))
+	assert.True(t, ok)
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	require.NoError(t, err)
+
+	key, err := encoding.DecodeString(secret)
+	require.NoError(t, err)
+	assert.Len(t, key, 20)
+
+	now := time.Now()
+	code, err := Code(secret, now)
+	require.NoError(t, err)
+	_, ok := Validate(secret, code, now)
+	assert.True(t, ok)
+}
+
+func TestURI(t *testing.T) {
+	u, err := url.Parse(URI("RSP Notes", "alice", rfcSecret))
+	require.NoError(t, err)
+
+	assert.Equal(t, "otpauth", u.Scheme)
+	assert.Equal(t, "totp", u.Host)
+	assert.Equal(t, "/RSP Notes:alice", u.Path)
+	assert.Equal(t, rfcSecret, u.Query().Get("secret"))
+	assert.Equal(t, "RSP Notes", u.Query().Get("issuer"))
+	assert.Equal(t, "6", u.Query().Get("digits"))
+	assert.Equal(t, "30", u.Query().Get("period"))
+}
@@ -0,0 +1,117 @@
+package watcher
+
+import (
+	"context"
+	redisv8 "github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/log"
+	"refactory/notes/internal/config"
+	"refactory/notes/internal/db/redis"
+	"refactory/notes/internal/security/token"
+	"sync"
+	"time"
+)
+
+// Watcher is a Casbin watcher on redis pub/sub. Every policy change is published with the id of the instance
+// and the other instances reload their policy, bursts of changes are reloaded once.
+// The policy is also reloaded periodically so that an instance that missed a message while reconnecting catches up.
+type Watcher struct {
+	cache    redis.Client
+	id       string
+	pubsub   *redisv8.PubSub
+	mu       sync.Mutex
+	callback func(string)
+	done     chan struct{}
+	once     sync.Once
+}
+
+func NewWatcher(ctx context.Context, cache redis.Client) (*Watcher, error) {
+	id, err := token.RandomString(8)
+	if nil != err {
+		return nil, errors.Wrap(err, "generate watcher id")
+	}
+
+	pubsub := cache.Conn().Subscribe(ctx, config.Cfg().PolicyChannel)
+	if _, err := pubsub.Receive(ctx); nil != err {
+		pubsub.Close()
+		return nil, errors.Wrap(err, "[rdr] NewWatcher - subscribe")
+	}
+
+	w := &Watcher{cache: cache, id: id, pubsub: pubsub, done: make(chan struct{})}
+	go w.listen()
+
+	return w, nil
+}
+
+func (w *Watcher) SetUpdateCallback(callback func(string)) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.callback = callback
+
+	return nil
+}
+
+// Update tells the other instances to reload their policy.
+func (w *Watcher) Update() error {
+	if err := w.cache.Conn().Publish(context.Background(), config.Cfg().PolicyChannel, w.id).Err(); nil != err {
+		return errors.Wrap(err, "[rdr] Watcher - publish update")
+	}
+
+	return nil
+}
+
+func (w *Watcher) Close() {
+	w.once.Do(func() {
+		close(w.done)
+		w.pubsub.Close()
+	})
+}
+
+func (w *Watcher) listen() {
+	messages := w.pubsub.Channel()
+	ticker := time.NewTicker(config.Cfg().PolicyReload)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			w.reload("")
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			if msg.Payload == w.id {
+				continue
+			}
+
+			// one reload covers every change published in the meantime
+		drain:
+			for {
+				select {
+				case _, ok := <-messages:
+					if !ok {
+						break drain
+					}
+				default:
+					break drain
+				}
+			}
+			w.reload(msg.Payload)
+		}
+	}
+}
+
+func (w *Watcher) reload(source string) {
+	w.mu.Lock()
+	callback := w.callback
+	w.mu.Unlock()
+
+	if nil == callback {
+		return
+	}
+
+	log.Debugf("reloading casbin policy, published by %q", source)
+	callback(source)
+}
@@ -11,14 +11,24 @@ import (
 	"refactory/notes/internal/app/handler"
 	"refactory/notes/internal/app/repository"
 	"refactory/notes/internal/app/service"
+	"refactory/notes/internal/config"
 	"refactory/notes/internal/db/redis"
 	"refactory/notes/internal/security/middleware"
 )
 
 type handlerModule struct {
-	user  handler.UserHandler
-	notes handler.NotesHandler
-	media handler.MediaHandler
+	user          handler.UserHandler
+	notes         handler.NotesHandler
+	media         handler.MediaHandler
+	webhook       handler.WebhookHandler
+	quota         handler.QuotaHandler
+	role          handler.RoleHandler
+	policy        handler.PolicyHandler
+	token         handler.AccessTokenHandler
+	privacy       handler.PrivacyHandler
+	invitation    handler.InvitationHandler
+	impersonation handler.ImpersonationHandler
+	organization  handler.OrganizationHandler
 }
 
 // @title RSP Notes API
@@ -28,59 +38,202 @@ type handlerModule struct {
 // @securityDefinitions.apiKey ApiKeyAuth
 // @in header
 // @name Authorization
-func NewRouter(validate *validator.Validate, db *sqlx.DB, cache redis.Client, enforcer *casbin.Enforcer) *echo.Echo {
+func NewRouter(validate *validator.Validate, db *sqlx.DB, cache redis.Client, enforcer *casbin.SyncedEnforcer) *echo.Echo {
+	authMiddleware := middleware.NewAuthentication(cache, repository.NewAccessTokenRepository(db), repository.NewImpersonationRepository(db), enforcer)
 	authenticationMiddleware := middleware.NewAuthorization(enforcer)
+	idempotencyMiddleware := middleware.NewIdempotency(cache)
+	orgMiddleware := middleware.NewOrganization(repository.NewOrganizationRepository(db, enforcer))
 	e := echo.New()
 
+	e.IPExtractor = ipExtractor()
 	e.Validator = &CustomValidator{validate}
 
 	module := getModule(db, cache, enforcer)
+	e.GET("/.well-known/jwks.json", handler.Jwks)
 	api := e.Group("/api")
-	api.POST("/registrasi", module.user.CreateUser)
-	api.POST("/verification", module.user.VerifyCode, middleware.Claim(), middleware.Auth)
+	api.POST("/registrasi", module.user.CreateUser, idempotencyMiddleware.Handle())
+	api.POST("/verification", module.user.VerifyCode, middleware.Claim(), authMiddleware.Auth)
+	api.POST("/verification/resend", module.user.ResendVerification)
+	api.GET("/verification/link", module.user.VerifyLink)
 	api.POST("/login", module.user.Login)
+	api.POST("/login/2fa", module.user.LoginTwoFactor)
+	api.GET("/oidc/login", module.user.OidcLogin)
+	api.GET("/oidc/callback", module.user.OidcCallback)
+	api.POST("/token/refresh", module.user.Refresh)
+	api.POST("/logout", module.user.Logout, middleware.Claim(), authMiddleware.Auth, authMiddleware.Direct)
+	api.POST("/password/forgot", module.user.ForgotPassword)
+	api.POST("/password/reset", module.user.ResetPassword)
 
-	user := api.Group("/users", middleware.Claim(), middleware.Auth, authenticationMiddleware.Enforce())
+	user := api.Group("/users", middleware.Claim(), authMiddleware.Auth, authenticationMiddleware.Enforce())
 	user.GET("", module.user.ListUser)
 	user.GET("/:id", module.user.DetailUser)
 	user.PUT("/:id", module.user.EditUser)
 	user.DELETE("/:id", module.user.DeleteUser)
 
-	notes := api.Group("/notes", middleware.Claim(), middleware.Auth, authenticationMiddleware.Enforce())
-	notes.POST("", module.notes.CreateNotes)
+	me := api.Group("/me", middleware.Claim(), authMiddleware.Auth)
+	me.GET("", module.user.Me)
+	me.PUT("", module.user.UpdateMe, authMiddleware.Direct)
+	me.DELETE("", module.privacy.RequestErasure, authMiddleware.Direct)
+	me.GET("/export", module.privacy.Export, authMiddleware.Direct)
+	me.POST("/password", module.user.ChangePassword, authMiddleware.Direct)
+	me.POST("/email/verify", module.user.VerifyEmailChange, authMiddleware.Direct)
+	me.DELETE("/email", module.user.CancelEmailChange, authMiddleware.Direct)
+	me.POST("/2fa/enroll", module.user.EnrollTwoFactor, authMiddleware.Direct)
+	me.POST("/2fa/verify", module.user.VerifyTwoFactor, authMiddleware.Direct)
+	me.POST("/oidc/link", module.user.OidcLink, authMiddleware.Direct)
+	me.GET("/sessions", module.user.ListDevice)
+	me.DELETE("/sessions", module.user.RevokeOtherDevices, authMiddleware.Direct)
+	me.DELETE("/sessions/:id", module.user.RevokeDevice, authMiddleware.Direct)
+	me.POST("/tokens", module.token.CreateAccessToken, authMiddleware.Direct)
+	me.GET("/tokens", module.token.ListAccessToken)
+	me.DELETE("/tokens/:id", module.token.RevokeAccessToken, authMiddleware.Direct)
+	me.GET("/impersonations", module.impersonation.ListMyImpersonation)
+	me.DELETE("/impersonation", module.impersonation.EndCurrentImpersonation)
+
+	notes := api.Group("/notes", middleware.Claim(), authMiddleware.Auth, orgMiddleware.Select, authenticationMiddleware.Enforce())
+	notes.POST("", module.notes.CreateNotes, idempotencyMiddleware.Handle())
 	notes.GET("", module.notes.ListNotes)
+	notes.GET("/stats", module.notes.NotesStats)
 	notes.GET("/:id", module.notes.GetNotes)
 	notes.PUT("/:id", module.notes.EditNotes)
 	notes.DELETE("/:id", module.notes.DeleteNotes)
 
+	api.GET("/sync", module.notes.Sync, middleware.Claim(), authMiddleware.Auth, orgMiddleware.SelectDeleted, authenticationMiddleware.Enforce())
+
+	orgs := api.Group("/orgs", middleware.Claim(), authMiddleware.Auth)
+	orgs.POST("", module.organization.CreateOrganization)
+	orgs.GET("", module.organization.ListOrganization)
+	orgs.DELETE("/:id", module.organization.DeleteOrganization, authMiddleware.Direct)
+	orgs.POST("/:id/token", module.organization.OrganizationToken, authMiddleware.Direct)
+	orgs.GET("/:id/members", module.organization.ListMember)
+	orgs.POST("/:id/members", module.organization.AddMember, authMiddleware.Direct)
+	orgs.PUT("/:id/members/:user_id", module.organization.UpdateMember, authMiddleware.Direct)
+	orgs.DELETE("/:id/members/:user_id", module.organization.RemoveMember, authMiddleware.Direct)
+
 	media := api.Group("/media")
-	media.POST("", module.media.UploadMedia, middleware2.BodyLimit("10M"), middleware.Claim(), middleware.Auth)
+	media.POST("", module.media.UploadMedia, middleware2.BodyLimit("10M"), middleware.Claim(), authMiddleware.Auth, idempotencyMiddleware.Handle())
 	media.GET("/:id", module.media.DownloadMedia)
 
-	admin := api.Group("/admin", middleware.Claim(), middleware.Auth, authenticationMiddleware.Enforce())
+	webhook := api.Group("/webhooks", middleware.Claim(), authMiddleware.Auth, authenticationMiddleware.Enforce())
+	webhook.POST("", module.webhook.CreateWebhook, authMiddleware.Direct)
+	webhook.GET("", module.webhook.ListWebhook)
+	webhook.DELETE("/:id", module.webhook.DeleteWebhook, authMiddleware.Direct)
+	webhook.GET("/:id/deliveries", module.webhook.ListDelivery)
+	webhook.POST("/deliveries/:id/replay", module.webhook.ReplayDelivery, authMiddleware.Direct)
+
+	admin := api.Group("/admin", middleware.Claim(), authMiddleware.Auth, authenticationMiddleware.Enforce())
 	admin.PUT("/notes/:id", module.notes.ReActiveNotes)
 	admin.PUT("/users/:id", module.user.ActiveUser)
+	admin.GET("/users/export", module.user.ExportUser)
+	admin.GET("/stats", module.notes.AdminStats)
+	admin.GET("/users/:id/quota", module.quota.GetQuota)
+	admin.PUT("/users/:id/quota", module.quota.UpdateQuota)
+	admin.DELETE("/users/:id/2fa", module.user.ResetTwoFactor)
+	admin.DELETE("/users/:id/lock", module.user.UnlockUser)
+	admin.PUT("/users/:id/role", module.role.AssignRole)
+	admin.DELETE("/users/:id/role", module.role.UnassignRole)
+	admin.GET("/roles", module.role.ListRole)
+	admin.POST("/roles", module.role.CreateRole)
+	admin.GET("/roles/:id", module.role.DetailRole)
+	admin.PUT("/roles/:id", module.role.EditRole)
+	admin.DELETE("/roles/:id", module.role.DeleteRole)
+	admin.GET("/policies", module.policy.ListPolicy)
+	admin.POST("/policies", module.policy.AddPolicy)
+	admin.DELETE("/policies", module.policy.RemovePolicy)
+	admin.POST("/policies/test", module.policy.TestPolicy)
+	admin.GET("/policies/audit", module.policy.ListAudit)
+	admin.GET("/invitations", module.invitation.ListInvitation)
+	admin.POST("/invitations", module.invitation.CreateInvitation)
+	admin.POST("/invitations/:id/resend", module.invitation.ResendInvitation)
+	admin.DELETE("/invitations/:id", module.invitation.RevokeInvitation)
+	admin.POST("/users/:id/impersonate", module.impersonation.Impersonate, authMiddleware.Direct)
+	admin.GET("/impersonations", module.impersonation.ListImpersonation)
+	admin.DELETE("/impersonations/:id", module.impersonation.EndImpersonation)
 
 	api.GET("/swagger/*", echoSwagger.WrapHandler)
 
 	return e
 }
 
-func getModule(db *sqlx.DB, cache redis.Client, enforcer *casbin.Enforcer) handlerModule {
+func getModule(db *sqlx.DB, cache redis.Client, enforcer *casbin.SyncedEnforcer) handlerModule {
+	// webhook module
+	webhookRepo := repository.NewWebhookRepository(db)
+	webhookService := service.NewWebhookService(webhookRepo)
+	webhookHandler := handler.NewWebhookHandler(webhookService)
+
+	// quota module
+	quotaRepo := repository.NewQuotaRepository(db)
+	quotaService := service.NewQuotaService(quotaRepo)
+	quotaHandler := handler.NewQuotaHandler(quotaService)
+
 	// user module
 	userRepo := repository.NewUserRepository(db, cache, enforcer)
-	userService := service.NewUserService(userRepo)
+	twoFactorRepo := repository.NewTwoFactorRepository(db, cache)
+	identityRepo := repository.NewIdentityRepository(db, cache, enforcer)
+	roleRepo := repository.NewRoleRepository(db, enforcer)
+	invitationRepo := repository.NewInvitationRepository(db)
+	userService := service.NewUserService(userRepo, twoFactorRepo, identityRepo, roleRepo, invitationRepo, webhookService)
 	userHandler := handler.NewUserHandler(userService)
 
+	// role module
+	roleService := service.NewRoleService(roleRepo, userRepo)
+	roleHandler := handler.NewRoleHandler(roleService)
+
+	// invitation module
+	invitationService := service.NewInvitationService(invitationRepo)
+	invitationHandler := handler.NewInvitationHandler(invitationService)
+
+	// access token module
+	accessTokenRepo := repository.NewAccessTokenRepository(db)
+	accessTokenService := service.NewAccessTokenService(accessTokenRepo)
+	accessTokenHandler := handler.NewAccessTokenHandler(accessTokenService)
+
+	// policy module
+	policyRepo := repository.NewPolicyRepository(db, enforcer)
+	policyService := service.NewPolicyService(policyRepo)
+	policyHandler := handler.NewPolicyHandler(policyService)
+
 	// notes module
-	notesRepo := repository.NewNotesRepository(db)
-	notesService := service.NewNotesService(notesRepo)
+	notesRepo := repository.NewNotesRepository(db, cache)
+	notesService := service.NewNotesService(notesRepo, webhookService, quotaService)
 	notesHandler := handler.NewNotesHandler(notesService)
 
 	// media module
 	mediaRepo := repository.NewMediaRepository(db)
-	mediaService := service.NewMediaService(mediaRepo)
+	mediaService := service.NewMediaService(mediaRepo, quotaService)
 	mediaHandler := handler.NewMediaHandler(mediaService)
 
-	return handlerModule{user: userHandler, notes: notesHandler, media: mediaHandler}
+	// privacy module
+	privacyRepo := repository.NewPrivacyRepository(db, enforcer)
+	privacyService := service.NewPrivacyService(privacyRepo, mediaRepo, userRepo)
+	privacyHandler := handler.NewPrivacyHandler(privacyService)
+
+	// impersonation module
+	impersonationRepo := repository.NewImpersonationRepository(db)
+	impersonationService := service.NewImpersonationService(impersonationRepo, userRepo)
+	impersonationHandler := handler.NewImpersonationHandler(impersonationService)
+
+	// organization module
+	organizationRepo := repository.NewOrganizationRepository(db, enforcer)
+	organizationService := service.NewOrganizationService(organizationRepo)
+	organizationHandler := handler.NewOrganizationHandler(organizationService)
+
+	return handlerModule{user: userHandler, notes: notesHandler, media: mediaHandler, webhook: webhookHandler, quota: quotaHandler, role: roleHandler, policy: policyHandler, token: accessTokenHandler,
+		privacy: privacyHandler, invitation: invitationHandler, impersonation: impersonationHandler,
+		organization: organizationHandler}
+}
+
+// ipExtractor only reads X-Forwarded-For when the request came through one of the configured proxies, otherwise
+// clients could pick the address the login throttle counts against.
+func ipExtractor() echo.IPExtractor {
+	proxies, _ := config.Cfg().TrustedProxies()
+	if len(proxies) == 0 {
+		return echo.ExtractIPDirect()
+	}
+
+	options := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, proxy := range proxies {
+		options = append(options, echo.TrustIPRange(proxy))
+	}
+	return echo.ExtractIPFromXFFHeader(options...)
 }
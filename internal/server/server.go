@@ -1,24 +1,36 @@
 package server
 
 import (
+	"context"
 	sqlxadapter "github.com/Blank-Xu/sqlx-adapter"
 	"github.com/casbin/casbin/v2"
 	"github.com/go-playground/validator/v10"
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
+	"github.com/prometheus/common/log"
 	"net/http"
 	"refactory/notes/internal/config"
 	"refactory/notes/internal/db/postgres"
 	"refactory/notes/internal/db/redis"
+	"refactory/notes/internal/security/token"
+	"refactory/notes/internal/security/watcher"
 	"refactory/notes/internal/translator"
 )
 
 func Start() error {
+	if err := config.Cfg().Validate(); nil != err {
+		return errors.Wrap(err, "validating config")
+	}
+
 	validate, err := translator.GetValidator()
 	if nil != err {
 		return errors.Wrap(err, "registering translator")
 	}
 
+	if err := token.LoadKeys(); nil != err {
+		return errors.Wrap(err, "loading jwt keys")
+	}
+
 	httpServer := &http.Server{
 		Addr: config.Cfg().WebAddress,
 	}
@@ -33,7 +45,7 @@ func Start() error {
 		return errors.Wrap(err, "initialize caching")
 	}
 
-	enforcer, err := createEnforcer(db)
+	enforcer, err := createEnforcer(db, cache)
 	if nil != err {
 		return err
 	}
@@ -56,13 +68,13 @@ func (cv CustomValidator) Validate(i interface{}) error {
 	return cv.validator.Struct(i)
 }
 
-func createEnforcer(db *sqlx.DB) (*casbin.Enforcer, error) {
+func createEnforcer(db *sqlx.DB, cache redis.Client) (*casbin.SyncedEnforcer, error) {
 	adapter, err := sqlxadapter.NewAdapter(db, "rules")
 	if nil != err {
 		return nil, err
 	}
 
-	enforcer, err := casbin.NewEnforcer("./casbin/model.conf", adapter)
+	enforcer, err := casbin.NewSyncedEnforcer("./casbin/model.conf", adapter)
 	if nil != err {
 		return nil, err
 	}
@@ -78,5 +90,20 @@ func createEnforcer(db *sqlx.DB) (*casbin.Enforcer, error) {
 	}
 
 	enforcer.EnableAutoSave(true)
+
+	// policy changes made by any instance are reloaded by the others
+	policyWatcher, err := watcher.NewWatcher(context.Background(), cache)
+	if nil != err {
+		return nil, err
+	}
+	if err := enforcer.SetWatcher(policyWatcher); nil != err {
+		return nil, err
+	}
+	policyWatcher.SetUpdateCallback(func(string) {
+		if err := enforcer.LoadPolicy(); nil != err {
+			log.Error(errors.Wrap(err, "reload casbin policy"))
+		}
+	})
+
 	return enforcer, nil
 }
@@ -4,9 +4,11 @@ import (
 	"github.com/go-playground/validator/v10"
 	"github.com/labstack/echo/v4"
 	"github.com/pkg/errors"
+	"math"
 	"net/http"
 	"refactory/notes/internal/app"
 	"refactory/notes/internal/translator"
+	"strconv"
 )
 
 type GeneralResponse struct {
@@ -50,6 +52,13 @@ const (
 	unauthenticated
 	duplicateCode
 	notfoundCode
+	quotaExceededCode
+	idempotencyCode
+	invalidCode
+	tooManyAttemptsCode
+	inUseCode
+	lockedCode
+	weakPasswordCode
 )
 
 var defaultResponse GeneralResponse = GeneralResponse{Meta: Meta{Version: "1.0.0", Copyright: "Copyright 2021 Refactory.id", Authors: []string{"Zacky Mughni Mubarok"}}}
@@ -66,6 +75,11 @@ func ResponseError(c echo.Context, err error) error {
 	}
 
 	if vErrs, ok := errors.Cause(err).(app.Error); ok {
+		// weak password errors carry the reason the password policy rejected the password
+		if vErrs.Code == app.WeakPasswordCode.Int() {
+			return c.JSON(http.StatusBadRequest, defaultResponse.AddErrors(Error{Code: weakPasswordCode, Message: vErrs.Message}))
+		}
+
 		switch vErrs {
 		case app.UnauthorizedError:
 			return c.JSON(http.StatusUnauthorized, defaultResponse.AddErrors(Error{Code: unauthorized, Message: "You are Unauthorized to use this resource"}))
@@ -73,8 +87,27 @@ func ResponseError(c echo.Context, err error) error {
 			return c.JSON(http.StatusUnauthorized, defaultResponse.AddErrors(Error{Code: unauthenticated, Message: "You are Unauthenticated"}))
 		case app.DuplicateError:
 			return c.JSON(http.StatusConflict, defaultResponse.AddErrors(Error{Code: duplicateCode, Message: "Data Already Exists"}))
+		case app.BadRequestError:
+			return c.JSON(http.StatusBadRequest, defaultResponse.AddErrors(Error{Code: badRequestCode, Message: "Bad Request"}))
 		case app.NotFoundError:
 			return c.JSON(http.StatusNotFound, defaultResponse.AddErrors(Error{Code: notfoundCode, Message: "Data Not Found"}))
+		case app.InvalidCodeError:
+			return c.JSON(http.StatusBadRequest, defaultResponse.AddErrors(Error{Code: invalidCode, Message: "Invalid or expired code"}))
+		case app.TooManyAttemptsError:
+			return c.JSON(http.StatusTooManyRequests, defaultResponse.AddErrors(Error{Code: tooManyAttemptsCode, Message: vErrs.Message}))
+		case app.LockedError:
+			if retryAfter, ok := app.RetryAfter(err); ok {
+				c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			}
+			return c.JSON(http.StatusTooManyRequests, defaultResponse.AddErrors(Error{Code: lockedCode, Message: vErrs.Message}))
+		case app.InUseError:
+			return c.JSON(http.StatusConflict, defaultResponse.AddErrors(Error{Code: inUseCode, Message: vErrs.Message}))
+		case app.QuotaExceededError:
+			return c.JSON(http.StatusRequestEntityTooLarge, defaultResponse.AddErrors(Error{Code: quotaExceededCode, Message: "Quota Exceeded"}))
+		case app.IdempotencyMismatchError:
+			return c.JSON(http.StatusUnprocessableEntity, defaultResponse.AddErrors(Error{Code: idempotencyCode, Message: vErrs.Message}))
+		case app.IdempotencyConflictError:
+			return c.JSON(http.StatusConflict, defaultResponse.AddErrors(Error{Code: idempotencyCode, Message: vErrs.Message}))
 		}
 	}
 
@@ -0,0 +1,3 @@
+delete from rules where p_type = 'p' and v1 = '/api/webhooks*';
+drop table if exists notes.webhook_deliveries cascade;
+drop table if exists notes.webhooks cascade;
@@ -0,0 +1,59 @@
+create table if not exists notes.webhooks
+(
+    id         serial                  not null
+    constraint webhooks_pk
+    primary key,
+    user_id    int                     not null
+    constraint webhooks_user_id_fk
+    references notes."user",
+    url        varchar                 not null,
+    secret     varchar                 not null,
+    events     varchar[]               not null,
+    is_active  boolean   default true  not null,
+    created_at timestamp default now() not null
+);
+
+create index if not exists webhooks_user_id_index
+    on notes.webhooks (user_id);
+
+create table if not exists notes.webhook_deliveries
+(
+    id              serial                     not null
+    constraint webhook_deliveries_pk
+    primary key,
+    webhook_id      int                        not null
+    constraint webhook_deliveries_webhook_id_fk
+    references notes.webhooks
+    on delete cascade,
+    event           varchar                    not null,
+    payload         jsonb                      not null,
+    status          varchar   default 'pending' not null,
+    attempts        int       default 0        not null,
+    response_code   int       default 0        not null,
+    last_error      varchar   default ''       not null,
+    next_attempt_at timestamp default now()    not null,
+    delivered_at    timestamp,
+    created_at      timestamp default now()    not null
+);
+
+create index if not exists webhook_deliveries_pending_index
+    on notes.webhook_deliveries (status, next_attempt_at);
+
+create table if not exists rules
+(
+    p_type varchar(32)  default '' not null,
+    v0     varchar(255) default '' not null,
+    v1     varchar(255) default '' not null,
+    v2     varchar(255) default '' not null,
+    v3     varchar(255) default '' not null,
+    v4     varchar(255) default '' not null,
+    v5     varchar(255) default '' not null
+);
+
+insert into rules (p_type, v0, v1, v2)
+select 'p', 'user', '/api/webhooks*', '*'
+where not exists(select 1 from rules where p_type = 'p' and v0 = 'user' and v1 = '/api/webhooks*');
+
+insert into rules (p_type, v0, v1, v2)
+select 'p', 'admin', '/api/webhooks*', '*'
+where not exists(select 1 from rules where p_type = 'p' and v0 = 'admin' and v1 = '/api/webhooks*');
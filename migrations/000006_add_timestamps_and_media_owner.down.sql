@@ -0,0 +1,7 @@
+alter table notes.media
+    drop column if exists user_id,
+    drop column if exists created_at;
+
+alter table notes.notes
+    drop column if exists created_at,
+    drop column if exists updated_at;
@@ -0,0 +1,21 @@
+alter table notes.notes
+    add column if not exists created_at timestamp default now() not null,
+    add column if not exists updated_at timestamp default now() not null;
+
+create index if not exists notes_user_id_created_at_index
+    on notes.notes (user_id, created_at);
+
+alter table notes.media
+    add column if not exists user_id int
+        constraint media_user_id_fk
+            references notes."user",
+    add column if not exists created_at timestamp default now() not null;
+
+update notes.media m
+set user_id = u.id
+from notes."user" u
+where u.media_id = m.id
+  and m.user_id is null;
+
+create index if not exists media_user_id_index
+    on notes.media (user_id);
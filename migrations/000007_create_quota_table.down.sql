@@ -0,0 +1 @@
+drop table if exists notes.quotas cascade;
\ No newline at end of file
@@ -0,0 +1,12 @@
+create table if not exists notes.quotas
+(
+    user_id         int                     not null
+    constraint quotas_pk
+    primary key
+    constraint quotas_user_id_fk
+    references notes."user",
+    max_notes       int,
+    max_body_size   int,
+    max_media_bytes bigint,
+    updated_at      timestamp default now() not null
+);
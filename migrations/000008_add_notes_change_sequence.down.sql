@@ -0,0 +1,6 @@
+delete from rules where p_type = 'p' and v1 = '/api/sync';
+drop trigger if exists notes_change_seq_trigger on notes.notes;
+drop function if exists notes.notes_bump_change_seq();
+alter table notes.notes
+    drop column if exists change_seq;
+drop sequence if exists notes.notes_change_seq;
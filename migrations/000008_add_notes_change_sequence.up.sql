@@ -0,0 +1,28 @@
+create sequence if not exists notes.notes_change_seq;
+
+alter table notes.notes
+    add column if not exists change_seq bigint default nextval('notes.notes_change_seq') not null;
+
+create or replace function notes.notes_bump_change_seq() returns trigger as
+$$
+begin
+    new.change_seq := nextval('notes.notes_change_seq');
+    return new;
+end;
+$$ language plpgsql;
+
+drop trigger if exists notes_change_seq_trigger on notes.notes;
+
+create trigger notes_change_seq_trigger
+    before update
+    on notes.notes
+    for each row
+execute procedure notes.notes_bump_change_seq();
+
+create index if not exists notes_user_id_change_seq_index
+    on notes.notes (user_id, change_seq);
+
+insert into rules (p_type, v0, v1, v2)
+select 'p', r.role, '/api/sync', 'GET'
+from (values ('user'), ('admin')) as r(role)
+where not exists(select 1 from rules where p_type = 'p' and v0 = r.role and v1 = '/api/sync');
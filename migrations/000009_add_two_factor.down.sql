@@ -0,0 +1,4 @@
+drop table if exists notes.recovery_codes cascade;
+alter table notes."user"
+    drop column if exists totp_secret,
+    drop column if exists totp_enabled;
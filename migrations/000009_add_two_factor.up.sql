@@ -0,0 +1,20 @@
+alter table notes."user"
+    add column if not exists totp_secret  varchar,
+    add column if not exists totp_enabled boolean default false not null;
+
+create table if not exists notes.recovery_codes
+(
+    id         serial                  not null
+    constraint recovery_codes_pk
+    primary key,
+    user_id    int                     not null
+    constraint recovery_codes_user_id_fk
+    references notes."user"
+    on delete cascade,
+    code_hash  varchar                 not null,
+    used_at    timestamp,
+    created_at timestamp default now() not null
+);
+
+create unique index if not exists recovery_codes_user_id_code_hash_uindex
+    on notes.recovery_codes (user_id, code_hash);
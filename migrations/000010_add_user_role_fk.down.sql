@@ -0,0 +1,2 @@
+alter table notes."user"
+    drop constraint if exists user_role_id_fk;
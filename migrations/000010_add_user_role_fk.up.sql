@@ -0,0 +1,15 @@
+insert into notes.roles (id, name)
+values (1, 'user'),
+       (2, 'admin')
+on conflict do nothing;
+
+select setval(pg_get_serial_sequence('notes.roles', 'id'), greatest((select max(id) from notes.roles), 2));
+
+alter table notes."user"
+    add column if not exists role_id int default 1 not null;
+
+update notes."user" set role_id = 1 where role_id is null or role_id not in (select id from notes.roles);
+
+alter table notes."user"
+    drop constraint if exists user_role_id_fk,
+    add constraint user_role_id_fk foreign key (role_id) references notes.roles;
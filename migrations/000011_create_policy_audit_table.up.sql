@@ -0,0 +1,16 @@
+create table if not exists notes.policy_audits
+(
+    id         serial                  not null
+    constraint policy_audits_pk
+    primary key,
+    user_id    int                     not null
+    constraint policy_audits_user_id_fk
+    references notes."user",
+    action     varchar                 not null,
+    p_type     varchar                 not null,
+    rule       varchar[]               not null,
+    created_at timestamp default now() not null
+);
+
+create index if not exists policy_audits_created_at_index
+    on notes.policy_audits (created_at);
@@ -0,0 +1,2 @@
+delete from rules where p_type = 'p' and v0 like 'scope:%';
+drop table if exists notes.access_tokens cascade;
@@ -0,0 +1,36 @@
+create table if not exists notes.access_tokens
+(
+    id           serial                  not null
+    constraint access_tokens_pk
+    primary key,
+    user_id      int                     not null
+    constraint access_tokens_user_id_fk
+    references notes."user"
+    on delete cascade,
+    name         varchar                 not null,
+    token_hash   varchar                 not null,
+    scopes       varchar[]               not null,
+    expires_at   timestamp,
+    last_used_at timestamp,
+    revoked_at   timestamp,
+    created_at   timestamp default now() not null
+);
+
+create unique index if not exists access_tokens_token_hash_uindex
+    on notes.access_tokens (token_hash);
+
+create index if not exists access_tokens_user_id_index
+    on notes.access_tokens (user_id);
+
+-- every scope is a casbin subject, a personal access token needs one of its scopes to allow the route
+insert into rules (p_type, v0, v1, v2)
+select r.p_type, r.v0, r.v1, r.v2
+from (values ('p', 'scope:notes:read', '/api/notes*', 'GET'),
+             ('p', 'scope:notes:read', '/api/sync', 'GET'),
+             ('p', 'scope:notes:write', '/api/notes*', 'POST'),
+             ('p', 'scope:notes:write', '/api/notes*', 'PUT'),
+             ('p', 'scope:notes:write', '/api/notes*', 'DELETE'),
+             ('p', 'scope:media:write', '/api/media', 'POST'),
+             ('p', 'scope:webhooks:read', '/api/webhooks*', 'GET'),
+             ('p', 'scope:webhooks:write', '/api/webhooks*', '*')) as r(p_type, v0, v1, v2)
+where not exists(select 1 from rules where p_type = r.p_type and v0 = r.v0 and v1 = r.v1 and v2 = r.v2);
@@ -0,0 +1,20 @@
+create table if not exists notes.user_identities
+(
+    id         serial                  not null
+    constraint user_identities_pk
+    primary key,
+    user_id    int                     not null
+    constraint user_identities_user_id_fk
+    references notes."user"
+    on delete cascade,
+    issuer     varchar                 not null,
+    subject    varchar                 not null,
+    email      varchar                 not null default '',
+    created_at timestamp default now() not null
+);
+
+create unique index if not exists user_identities_issuer_subject_uindex
+    on notes.user_identities (issuer, subject);
+
+create unique index if not exists user_identities_user_id_issuer_uindex
+    on notes.user_identities (user_id, issuer);
@@ -0,0 +1,9 @@
+delete from notes.policy_audits where user_id is null;
+
+alter table notes.policy_audits
+    alter column user_id set not null;
+
+drop index if exists notes.user_erase_at_index;
+
+alter table notes."user"
+    drop column if exists erase_at;
@@ -0,0 +1,10 @@
+alter table notes."user"
+    add column if not exists erase_at timestamp;
+
+create index if not exists user_erase_at_index
+    on notes."user" (erase_at)
+    where erase_at is not null;
+
+-- audit records outlive the users they mention, erasure clears the reference
+alter table notes.policy_audits
+    alter column user_id drop not null;
@@ -0,0 +1 @@
+drop table if exists notes.invitations cascade;
@@ -0,0 +1,25 @@
+create table if not exists notes.invitations
+(
+    id          serial                  not null
+    constraint invitations_pk
+    primary key,
+    email       varchar                 not null,
+    role_id     int                     not null
+    constraint invitations_role_id_fk
+    references notes.roles,
+    token_hash  varchar                 not null,
+    invited_by  int
+    constraint invitations_invited_by_fk
+    references notes."user"
+    on delete set null,
+    expires_at  timestamp               not null,
+    accepted_at timestamp,
+    revoked_at  timestamp,
+    created_at  timestamp default now() not null
+);
+
+create unique index if not exists invitations_token_hash_uindex
+    on notes.invitations (token_hash);
+
+create index if not exists invitations_email_index
+    on notes.invitations (lower(email));
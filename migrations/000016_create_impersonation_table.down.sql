@@ -0,0 +1,2 @@
+drop table if exists notes.impersonation_requests cascade;
+drop table if exists notes.impersonations cascade;
@@ -0,0 +1,40 @@
+create table if not exists notes.impersonations
+(
+    id         serial                  not null
+    constraint impersonations_pk
+    primary key,
+    admin_id   int
+    constraint impersonations_admin_id_fk
+    references notes."user"
+    on delete set null,
+    user_id    int                     not null
+    constraint impersonations_user_id_fk
+    references notes."user"
+    on delete cascade,
+    reason     varchar                 not null,
+    jti        varchar                 not null,
+    expires_at timestamp               not null,
+    ended_at   timestamp,
+    created_at timestamp default now() not null
+);
+
+create index if not exists impersonations_user_id_index
+    on notes.impersonations (user_id);
+
+create table if not exists notes.impersonation_requests
+(
+    id               serial                  not null
+    constraint impersonation_requests_pk
+    primary key,
+    impersonation_id int                     not null
+    constraint impersonation_requests_impersonation_id_fk
+    references notes.impersonations
+    on delete cascade,
+    method           varchar                 not null,
+    path             varchar                 not null,
+    status           int                     not null,
+    created_at       timestamp default now() not null
+);
+
+create index if not exists impersonation_requests_impersonation_id_index
+    on notes.impersonation_requests (impersonation_id);
@@ -0,0 +1,16 @@
+delete from rules where p_type = 'p' and v0 like 'org:%';
+delete from rules where p_type = 'g' and v2 like 'org:%';
+
+update rules set v1 = v2, v2 = v3, v3 = ''
+where p_type = 'p' and coalesce(v3, '') <> '';
+
+update rules set v2 = ''
+where p_type = 'g' and v2 = 'personal';
+
+drop index if exists notes.notes_organization_id_change_seq_index;
+
+alter table notes.notes
+    drop column if exists organization_id;
+
+drop table if exists notes.organization_members cascade;
+drop table if exists notes.organizations cascade;
@@ -0,0 +1,62 @@
+create table if not exists notes.organizations
+(
+    id         serial                  not null
+    constraint organizations_pk
+    primary key,
+    name       varchar                 not null,
+    created_by int
+    constraint organizations_created_by_fk
+    references notes."user"
+    on delete set null,
+    created_at timestamp default now() not null
+);
+
+create table if not exists notes.organization_members
+(
+    organization_id int                     not null
+    constraint organization_members_organization_id_fk
+    references notes.organizations
+    on delete cascade,
+    user_id         int                     not null
+    constraint organization_members_user_id_fk
+    references notes."user"
+    on delete cascade,
+    role            varchar                 not null,
+    created_at      timestamp default now() not null,
+    constraint organization_members_pk
+    primary key (organization_id, user_id)
+);
+
+create index if not exists organization_members_user_id_index
+    on notes.organization_members (user_id);
+
+-- notes without organization are personal notes of their user
+alter table notes.notes
+    add column if not exists organization_id int
+    constraint notes_organization_id_fk
+    references notes.organizations
+    on delete cascade;
+
+create index if not exists notes_organization_id_change_seq_index
+    on notes.notes (organization_id, change_seq);
+
+-- casbin requests carry a domain, personal for the own notes of the user and org:<id> for an organization,
+-- scopes of personal access tokens apply in every domain
+update rules set v3 = v2, v2 = v1, v1 = '*'
+where p_type = 'p' and v0 like 'scope:%' and coalesce(v3, '') = '';
+
+update rules set v3 = v2, v2 = v1, v1 = 'personal'
+where p_type = 'p' and v0 not like 'scope:%' and coalesce(v3, '') = '';
+
+update rules set v2 = 'personal'
+where p_type = 'g' and coalesce(v2, '') = '';
+
+insert into rules (p_type, v0, v1, v2, v3)
+select r.p_type, r.v0, r.v1, r.v2, r.v3
+from (values ('p', 'org:owner', 'org:*', '/api/notes*', '*'),
+             ('p', 'org:owner', 'org:*', '/api/sync', 'GET'),
+             ('p', 'org:member', 'org:*', '/api/notes*', '*'),
+             ('p', 'org:member', 'org:*', '/api/sync', 'GET'),
+             ('p', 'org:viewer', 'org:*', '/api/notes*', 'GET'),
+             ('p', 'org:viewer', 'org:*', '/api/sync', 'GET')) as r(p_type, v0, v1, v2, v3)
+where not exists(select 1 from rules where p_type = r.p_type and v0 = r.v0 and v1 = r.v1 and v2 = r.v2 and v3 = r.v3);
@@ -0,0 +1,13 @@
+drop index if exists notes.notes_organization_id_change_txid_index;
+drop index if exists notes.notes_user_id_change_txid_index;
+
+create or replace function notes.notes_bump_change_seq() returns trigger as
+$$
+begin
+    new.change_seq := nextval('notes.notes_change_seq');
+    return new;
+end;
+$$ language plpgsql;
+
+alter table notes.notes
+    drop column if exists change_txid;
@@ -0,0 +1,23 @@
+-- change_seq is taken when a row is written, not when it is committed, so a sync that pages by it alone can move
+-- past a row of a transaction still in flight. change_txid records the writing transaction and sync only returns rows
+-- of transactions older than every transaction in flight, ordered by (change_txid, change_seq).
+alter table notes.notes
+    add column if not exists change_txid bigint default 0 not null;
+
+alter table notes.notes
+    alter column change_txid set default txid_current();
+
+create or replace function notes.notes_bump_change_seq() returns trigger as
+$$
+begin
+    new.change_seq := nextval('notes.notes_change_seq');
+    new.change_txid := txid_current();
+    return new;
+end;
+$$ language plpgsql;
+
+create index if not exists notes_user_id_change_txid_index
+    on notes.notes (user_id, change_txid, change_seq);
+
+create index if not exists notes_organization_id_change_txid_index
+    on notes.notes (organization_id, change_txid, change_seq);
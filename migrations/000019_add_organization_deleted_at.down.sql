@@ -0,0 +1,4 @@
+delete from notes.organizations where deleted_at is not null;
+
+alter table notes.organizations
+    drop column if exists deleted_at;
@@ -0,0 +1,3 @@
+-- deleted organizations are kept with their members so sync can still serve the tombstones of their notes
+alter table notes.organizations
+    add column if not exists deleted_at timestamptz;